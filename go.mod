@@ -15,6 +15,7 @@ require (
 	github.com/micro/go-micro v1.18.0
 	github.com/micro/go-plugins/broker/nsq v0.0.0-20200119172437-4fe21aa238fd
 	github.com/pborman/uuid v1.2.0 // indirect
+	github.com/prometheus/client_golang v1.8.0
 	github.com/rifflock/lfshook v0.0.0-20180920164130-b9218ef580f5
 	github.com/shiena/ansicolor v0.0.0-20151119151921-a422bbe96644 // indirect
 	github.com/sirupsen/logrus v1.4.2
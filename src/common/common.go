@@ -14,6 +14,10 @@ const (
 
 	// RunTypeStandAlone for running service alone
 	RunTypeStandAlone = "standalone"
+	// RunTypeConvertTemplates for converting csv template file to json template file
+	RunTypeConvertTemplates = "convert-templates"
+	// RunTypeValidateTemplates for dry running every template against its sample page
+	RunTypeValidateTemplates = "validate-templates"
 
 	// Version for service release version
 	Version = "v1"
@@ -78,6 +82,40 @@ const (
 	SchedulerChannelNum = 5
 	// SchedulerTaskQueueSize for scheduler task queue size
 	SchedulerTaskQueueSize = 10
+	// SchedulerAging for seconds a task waits to be served like one priority level higher
+	SchedulerAging = 10
+	// SchedulerQueueSize for max tasks waiting of one priority in one dispatcher
+	SchedulerQueueSize = 100
+	// SchedulerPools for control pools created at start by "name=size" split by ",", sizes of tasks are used if empty
+	SchedulerPools = ""
+	// QueueEnable for keep page urls in file backed crawl queue until parsed
+	QueueEnable = true
+	// QueuePath for log file of crawl queue
+	QueuePath = "./data/queue/crawl.log"
+	// QueueMaxLeases for times a page url leased without ack or fail before it is failed
+	QueueMaxLeases = 3
+	// QueueCompactEvery for num of acks and fails to rewrite log of crawl queue
+	QueueCompactEvery = 10000
+	// QueueFsync for sync log of crawl queue after every record
+	QueueFsync = false
+	// IntakeOverflow for behavior of intake when page urls waiting are full, block, reject or spill
+	IntakeOverflow = "block"
+	// IntakeTimeout for seconds block waits for room before reject, negative means forever
+	IntakeTimeout = 5
+	// IntakeMaxReady for max page urls ready in crawl queue, 0 means no bound
+	IntakeMaxReady = 1000
+	// IntakeMaxInFlight for max nsq messages in flight of each subscriber, 0 means capacity of scheduler
+	IntakeMaxInFlight = 0
+	// MetricsAddress for address of own listener of /metrics, empty means only micro web service serves it
+	MetricsAddress = ""
+	// MetricsSupervise for keep log loop of supervise beside /metrics
+	MetricsSupervise = false
+	// ShutdownTimeout for seconds to drain tasks and flush results after SIGINT or SIGTERM
+	ShutdownTimeout = 30
+	// HTTPCtrlName for name of control pool which parse pages
+	HTTPCtrlName = "http"
+	// HTTPCtrlNum for the size of concurrent routine pool which parse pages
+	HTTPCtrlNum = 30
 
 	// UseMicro for use micro service
 	UseMicro = false
@@ -99,10 +137,20 @@ const (
 	RegistryAddress = "localhost"
 	// RegistryPort for micro registry port using etcs
 	RegistryPort = "2379"
+	// BrokerType for micro broker, nsq, memory or http
+	BrokerType = "nsq"
+	// BrokerHTTPAddress for listen address of http broker
+	BrokerHTTPAddress = ":0"
+	// RegistryType for micro registry, etcd, mdns or static
+	RegistryType = "etcd"
+	// RegistryServices for nodes of static registry, name=host:port split by ","
+	RegistryServices = ""
 	// TopicSUBname for nsq receive topic
 	TopicSUBName = "zfky.topic.service"
 	// TopicPUBName for nsq send topic
 	TopicPUBName = "zfky.topic.client"
+	// TopicCrawlName for nsq receive topic of crawl requests
+	TopicCrawlName = "zfky.topic.crawl"
 	// ChannelName for nsq channel name
 	ChannelName = "queue.service"
 
@@ -115,6 +163,8 @@ const (
 	// RedisPartition for redis partition
 	RedisPartition = 0
 
+	// DBConns for mysql data source name, empty means mysql is not used
+	DBConns = ""
 	// DBMaxIdleCONNS FOR mysql max idle connections
 	DBMaxIdleCONNS = 10
 	// DBMaxOpenCONNS for  mysql max idle connections
@@ -137,18 +187,148 @@ const (
 	PostURLPattern = `%s://%s/product/product/index`
 	// HTTPTimeOut for http request timeout
 	HTTPTimeOut = 5
+	// HTTPRequestTimeout for seconds of whole http request including body
+	HTTPRequestTimeout = 30
+	// HTTPHeaderTimeout for seconds waiting response header
+	HTTPHeaderTimeout = 20
+	// HTTPRetry for retry times of transient failure: dns temporary, timeout, connection, 5xx and 429
+	HTTPRetry = 2
+	// HTTPBackoff for milliseconds of first retry backoff, doubled every retry with jitter
+	HTTPBackoff = 500
+	// HTTPBackoffMax for max milliseconds of retry backoff
+	HTTPBackoffMax = 10000
+	// HTTPRetryAfterMax for max seconds to obey Retry-After of 429 response, give up if longer
+	HTTPRetryAfterMax = 60
 
 	// SeleniumAddrPattern for webdriver address pattern
-	//SeleniumAddrPattern = `http://localhost:%d/wd/hub`
-	SeleniumAddrPattern = `http://192.168.3.9:%d/wd/hub`
+	SeleniumAddrPattern = `http://localhost:%d/wd/hub`
 	// seleniumPort for web driver port
 	SeleniumPort = 8083
 	// SeleniumPath for path of selenium-server-standalone
 	SeleniumPath = "vendor/selenium-server-standalone-3.141.59.jar"
 	// GeckoDriverPath for path of geckodriver
 	GeckoDriverPath = "vendor/geckodriver"
+	// WebDriverBrowser for browser of web driver, firefox or chrome
+	WebDriverBrowser = "firefox"
+	// WebDriverHeadless for run browser without display
+	WebDriverHeadless = false
+	// WebDriverLaunchNone for use web driver server started by others
+	WebDriverLaunchNone = "none"
+	// WebDriverLaunchGecko for launch local geckodriver
+	WebDriverLaunchGecko = "geckodriver"
+	// WebDriverLaunchSelenium for launch local selenium-server-standalone
+	WebDriverLaunchSelenium = "selenium"
+	// WebDriverLaunchTimeout for max seconds waiting for local web driver server ready
+	WebDriverLaunchTimeout = 30
+	// WebDriverLaunchRestartDelay for seconds before restart exited local web driver server
+	WebDriverLaunchRestartDelay = 5
+	// WebDriverPoolSize for num of web driver sessions, each session is leased by one task at a time
+	WebDriverPoolSize = 2
+	// WebDriverMaxAge for seconds a session keeps running before restart
+	WebDriverMaxAge = 86400
+	// WebDriverLeaseTimeout for max seconds waiting for idle web driver session
+	WebDriverLeaseTimeout = 120
+	// WebDriverPageLoadTimeout for max seconds web driver waiting for page load
+	WebDriverPageLoadTimeout = 180
+	// WebDriverMaxWait for max milliseconds polling wait conditions if template do not set
+	WebDriverMaxWait = 30000
+	// WebDriverWaitInterval for milliseconds between two polls of wait conditions
+	WebDriverWaitInterval = 200
+	// WebDriverNetworkIdle for milliseconds without new resource request that network is idle
+	WebDriverNetworkIdle = 500
+	// WebDriverOrderSleep for seconds sleep after click order if template do not set order wait conditions
+	WebDriverOrderSleep = 3
+
+	// TemplatePath for path of site template file
+	TemplatePath = "./conf/templateResource.csv"
+	// TemplateWatchGap for time gap of checking template file modified, 0 means do not watch
+	TemplateWatchGap = 10
+	// TemplateMaxHistory for max versions kept for each domain template
+	TemplateMaxHistory = 5
+	// AdminToken for bearer token of /admin routes, empty means admin routes are disabled
+	AdminToken = ""
+
+	// PolitenessRate for default pages per second of each host
+	PolitenessRate = 1.0
+	// PolitenessBurst for default max pages at once of each host
+	PolitenessBurst = 2
+	// PolitenessMaxConcurrency for default max pages parsing at the same time of each host
+	PolitenessMaxConcurrency = 2
+	// PolitenessDeferGap for milliseconds a deferred page waits when host reached max concurrency
+	PolitenessDeferGap = 500
+	// PolitenessRobots for whether check robots.txt of hosts not in allow list
+	PolitenessRobots = false
+	// PolitenessRobotsTTL for seconds robots.txt of host is cached
+	PolitenessRobotsTTL = 86400
+	// PolitenessUserAgent for user agent token matched in robots.txt
+	PolitenessUserAgent = "siteResService"
+
+	// CacheEnable for whether cache fetched pages
+	CacheEnable = true
+	// CacheTTL for default seconds fetched pages are cached, stale http pages are revalidated by ETag and Last-Modified
+	CacheTTL = 600
+	// CacheDir for dir of cached pages, empty means cache in memory only
+	CacheDir = ""
+	// CacheMaxEntries for max pages cached, the oldest one is dropped when full
+	CacheMaxEntries = 10000
+
+	// StoreBackend for backend of parse results store: file, mysql or none
+	StoreBackend = "file"
+	// StoreDir for dir of file backed parse results store
+	StoreDir = "./data/results"
+	// StoreMaxAge for max seconds stored parse result is served before parsing page again
+	StoreMaxAge = 86400
+
+	// JobTTL for seconds finished crawl job is kept for status polling
+	JobTTL = 3600
+	// JobMaxURLs for max urls of one crawl job
+	JobMaxURLs = 1000
+
+	// WebhookSecret for secret key of HMAC-SHA256 signature of callbacks, secret in WebhookSecretFile is used if empty
+	WebhookSecret = ""
+	// WebhookSecretFile for file of secret generated when WebhookSecret is empty
+	WebhookSecretFile = "./data/webhook.secret"
+	// WebhookAllowPrivate for post callbacks to loopback and private addresses
+	WebhookAllowPrivate = false
+	// WebhookQueueSize for max callbacks waiting to be sent, more are written to dead letter
+	WebhookQueueSize = 1000
+	// WebhookTimeout for seconds of one callback request
+	WebhookTimeout = 10
+	// WebhookRetry for retry times of failed callback
+	WebhookRetry = 5
+	// WebhookBackoff for milliseconds of first callback retry backoff, doubled every retry with jitter
+	WebhookBackoff = 1000
+	// WebhookBackoffMax for max milliseconds of callback retry backoff
+	WebhookBackoffMax = 60000
+	// WebhookWorkers for num of routines sending callbacks
+	WebhookWorkers = 4
+	// WebhookDeadLetter for file appended with callbacks failed after all retries
+	WebhookDeadLetter = "./data/webhook.dead"
+
+	// FetcherBrowser for whether fetch pages of web template and parse failed pages by web driver
+	FetcherBrowser = true
+	// FetcherFixtureDir for dir of saved pages, fetch all pages from this dir instead of network if set
+	FetcherFixtureDir = ""
 )
 
+// PageMessage represents page url received by subscriber or read from source, with options of its event or crawl request
+type PageMessage struct {
+	ID			string  // event id, empty if not from event
+	URL			string
+	Callback	string  // parse result is posted to this url if set
+	Priority	int  // higher priority is scheduled first
+	UseStored	bool  // serve stored parse result if parsed within max age
+	Fields		[]string  // fields posted to callback, all fields if empty
+	CargoID		string
+	QueueID		uint64  // id in crawl queue, acked or failed when parse finished, 0 if not queued
+}
+
+// ParseResult represents site resource parsed from page, with id of event or job which triggered parsing
+type ParseResult struct {
+	ID		string  // event id or job id, empty if queried by api
+	Info	*ProInfo
+}
+
 // PubInfo represents info which publisher need
 type PubInfo struct {
 	Topic string
@@ -187,10 +367,29 @@ type ProInfo struct {
 	Spec    	[][]string  // specifications with image
 	Good		[][]string  // set meal
 	Template	string
+	TemplateVersion	int  // version of domain template which parsed this info
+}
+
+// WaitCondition represents conditions polled by web driver until page is rendered, all set conditions must be satisfied
+type WaitCondition struct {
+	Selector	string	`json:"selector,omitempty"`  // css selector which must appear
+	NetworkIdle	bool	`json:"network_idle,omitempty"`  // no new resource request for a while
+	Script		string	`json:"script,omitempty"`  // js expression which must be true
+	MaxWait		int		`json:"max_wait,omitempty"`  // max milliseconds to poll, document must be complete at least
+}
+
+// PolitenessPolicy represents crawl limits of one host, zero value means use global default
+type PolitenessPolicy struct {
+	Rate			float64	`json:"rate,omitempty"`  // pages per second
+	Burst			int		`json:"burst,omitempty"`  // max pages at once
+	MaxConcurrency	int		`json:"max_concurrency,omitempty"`  // max pages parsing at the same time
 }
 
 // LabelsParse represents label required for parsing page
 type LabelsParse struct {
+	Domain		string		// domain of this template
+	Version		int			// template version, increase when labels of domain changed
+	SampleURL	string		// sample page url for validating template
 	Character	string		// for distinguish the method of parsing page
 	Order		[]string		// for order label
 	Cover 		[]string	// head image label
@@ -199,6 +398,10 @@ type LabelsParse struct {
 	Desc		[]string
 	Good		[]string
 	Spec		[]string
+	Wait		*WaitCondition	// polled by web driver after main page opened, nil means page loaded is enough
+	OrderWait	*WaitCondition	// polled by web driver after click order, nil means sleep a fixed time
+	Politeness	*PolitenessPolicy	// crawl limits of this domain, nil means use global default
+	CacheTTL	int			// seconds pages of this domain are cached, 0 means use global default, negative means do not cache
 }
 
 // CargoExtInfo represents ext info
@@ -0,0 +1,162 @@
+/*
+  Package http for classify failures of page fetch
+*/
+
+package http
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// classes of fetch failure
+const (
+	ErrClassDNS			= "dns"
+	ErrClassTimeout		= "timeout"
+	ErrClassTLS			= "tls"
+	ErrClassNetwork		= "network"  // connection refused, reset and so on
+	ErrClassClient		= "4xx"
+	ErrClassServer		= "5xx"
+	ErrClassRateLimit	= "429"
+	ErrClassBrowser		= "browser"  // web driver failed, not caused by site
+)
+
+// FetchError represents final failure of fetch after retry
+type FetchError struct {
+	Class		string
+	URL			string
+	StatusCode	int  // 0 if no response
+	RetryAfter	time.Duration  // Retry-After of 429 or 503 response
+	Attempts	int
+	Err			error
+}
+
+// Error returns message of fetch error
+func (e *FetchError) Error() string {
+	msg := fmt.Sprintf("fetch %s failed (%s) after %d attempts", e.URL, e.Class, e.Attempts)
+	if e.StatusCode > 0 {
+		msg += fmt.Sprintf(", status %d", e.StatusCode)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+
+	return msg
+}
+
+// Transient returns true if retry may succeed
+func (e *FetchError) Transient() bool {
+	switch e.Class {
+	case ErrClassTimeout, ErrClassNetwork, ErrClassServer, ErrClassRateLimit:
+		return true
+	case ErrClassDNS:
+		var dnsErr *net.DNSError
+		return errors.As(e.Err, &dnsErr) && (dnsErr.IsTemporary || dnsErr.IsTimeout)
+	}
+
+	return false
+}
+
+// SiteDown returns true if site can not serve the page, false means page was served (such as 404)
+func (e *FetchError) SiteDown() bool {
+	return e.Class != ErrClassClient && e.Class != ErrClassBrowser
+}
+
+// ErrorClass returns class of fetch error, empty if err is not a fetch error
+func ErrorClass(err error) string {
+	var fe *FetchError
+	if errors.As(err, &fe) {
+		return fe.Class
+	}
+
+	return ""
+}
+
+// IsSiteDown returns true if err is a fetch error caused by site
+func IsSiteDown(err error) bool {
+	var fe *FetchError
+	return errors.As(err, &fe) && fe.SiteDown()
+}
+
+// classifyError returns class of error returned by http client or web driver
+func classifyError(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrClassDNS
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrClassTimeout
+	}
+
+	var certErr x509.CertificateInvalidError
+	var hostErr x509.HostnameError
+	var authErr x509.UnknownAuthorityError
+	if errors.As(err, &certErr) || errors.As(err, &hostErr) || errors.As(err, &authErr) {
+		return ErrClassTLS
+	}
+
+	// tls errors are not exported, web driver reports errors of browser by message
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "tls:") || strings.Contains(msg, "x509:") || strings.Contains(msg, "nssFailure"):
+		return ErrClassTLS
+	case strings.Contains(msg, "dnsNotFound"):
+		return ErrClassDNS
+	case strings.Contains(msg, "netTimeout") || strings.Contains(msg, "timeout"):
+		return ErrClassTimeout
+	}
+
+	var urlErr *url.Error
+	var opErr *net.OpError
+	if errors.As(err, &opErr) || errors.As(err, &urlErr) || strings.Contains(msg, "connectionFailure") {
+		return ErrClassNetwork
+	}
+
+	return ErrClassBrowser
+}
+
+// classifyStatus returns class of response status, empty if success
+func classifyStatus(statusCode int) string {
+	switch {
+	case statusCode == 429:
+		return ErrClassRateLimit
+	case statusCode >= 500:
+		return ErrClassServer
+	case statusCode >= 400:
+		return ErrClassClient
+	}
+
+	return ""
+}
+
+// parseRetryAfter returns duration of Retry-After header in seconds or http date, 0 if not set
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if len(value) <= 0 {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := time.Parse(time.RFC1123, value); err == nil {
+		if d := t.Sub(time.Now()); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
@@ -7,6 +7,8 @@ package http
 import (
 	"os"
 	"fmt"
+	"errors"
+	"math/rand"
 	"time"
 	"bytes"
 	"strings"
@@ -19,9 +21,8 @@ import (
 	"net/url"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/tebeka/selenium"
-	"github.com/tebeka/selenium/firefox"
 	"github.com/astaxie/beego"
+	"github.com/tebeka/selenium"
 	log "github.com/sirupsen/logrus"
 
 	cm "siteResService/src/common"
@@ -30,9 +31,14 @@ import (
 
 // ServiceHTTP represents http request
 type ServiceHTTP struct {
-	wd					*selenium.WebDriver
-	wdLastRestartTime	time.Time  // for restart web driver
-	RequestCounter		uint64  // calculation num of http request, must use by atomic !!!
+	wdConf			*WebDriverConfig
+	wdLauncher		*WebDriverLauncher  // local web driver server, nil if use remote server
+	wdPool			*WebDriverPool  // browser sessions leased per task
+	transport		*http.Transport  // shared by http clients
+	cache			*ResponseCache
+	RequestCounter	uint64  // calculation num of http request, must use by atomic !!!
+	RetryCounter	uint64  // calculation num of retried request, must use by atomic !!!
+	FailCounter		uint64  // calculation num of failed request after retry, must use by atomic !!!
 }
 
 var instance *ServiceHTTP
@@ -57,9 +63,13 @@ func GetHTTPInstance() *ServiceHTTP {
 }
 
 // init ServiceHTTP client
+// web driver sessions are started lazily when leased, so service can run without selenium
 func (h *ServiceHTTP) init() {
-	h.wd = initWebDriver()
-	h.wdLastRestartTime = time.Now()
+	h.wdConf = loadWebDriverConfig()
+	h.wdLauncher = newWebDriverLauncher(h.wdConf)
+	h.wdPool = newWebDriverPool(h.startWebDriver, h.wdConf.PoolSize)
+	h.transport = newTransport()
+	h.cache = newResponseCache()
 
 	atomic.StoreUint64(&h.RequestCounter, 0) // init counter to 0
 }
@@ -71,101 +81,41 @@ func DefaultHeader() map[string]string {
 	return headers
 }
 
-// getTransportHttpClient for get http client with transport
-func getTransportHttpClient() *http.Client {
-	timeout := beego.AppConfig.DefaultInt("http::timeout", cm.HTTPTimeOut)
-
-	connHTTP := &http.Client{
-		Transport: &http.Transport{
-			Dial: func(netw, addr string) (net.Conn, error) {
-				connHTTP, err := net.DialTimeout(netw, addr, time.Duration(timeout) * time.Second)
-				if err != nil {
-					log.WithFields(log.Fields{
-						"error":	err.Error(),
-					}).Error("dail timeout")
-					return nil, err
-				}
-				connHTTP.SetDeadline(time.Now().Add(time.Second * 15))
-				return connHTTP, nil
-
-			},
-			MaxIdleConnsPerHost:   64,
-			ResponseHeaderTimeout: time.Millisecond * 20000,
-			DisableKeepAlives:     false,
-		},
+// newTransport returns transport shared by http clients, connection is reused between requests of same host
+func newTransport() *http.Transport {
+	timeout := time.Duration(beego.AppConfig.DefaultInt("http::timeout", cm.HTTPTimeOut)) * time.Second
+	headerTimeout := beego.AppConfig.DefaultInt("http::headerTimeout", cm.HTTPHeaderTimeout)
+
+	return &http.Transport{
+		Proxy:					http.ProxyFromEnvironment,
+		DialContext:			(&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:	timeout,
+		MaxIdleConnsPerHost:	64,
+		IdleConnTimeout:		90 * time.Second,
+		ResponseHeaderTimeout:	time.Duration(headerTimeout) * time.Second,
+		DisableKeepAlives:		false,
 	}
+}
 
-	jar, err := cookiejar.New(nil)
-	if err != nil {
-		panic(err)
+// newClient returns http client with timeout of whole request and its own cookie jar
+func (h *ServiceHTTP) newClient() *http.Client {
+	timeout := beego.AppConfig.DefaultInt("http::requestTimeout", cm.HTTPRequestTimeout)
+	client := &http.Client{
+		Transport:	h.transport,
+		Timeout:	time.Duration(timeout) * time.Second,
 	}
-	connHTTP.Jar = jar
-
-	return connHTTP
-}
 
-// initWebDriver for init web driver of firefox
-func initWebDriver() *selenium.WebDriver {
-	// Connect to the WebDriver instance running locally.
-	fireCaps := firefox.Capabilities{}
-	pre := make(map[string]interface{})
-	pre["browser.tabs.remote.autostart"] = false
-	pre["browser.privatebrowsing.autostart"] = true
-	pre["browser.migrate.chrome.history.maxAgeInDays"] = 0
-	pre["network.cookie.maxNumber"] = 3
-	pre["browser.cache.memory.enable"] = false
-	pre["browser.cache.disk.enable"] = false
-	pre["browser.sessionhistory.max_total_viewers"] = 3
-	fireCaps.Prefs = pre
-	//caps := selenium.Capabilities{"browserName": "firefox"}
-	caps := selenium.Capabilities{"browserName": "internet explorer"}
-	caps.AddFirefox(fireCaps)
-	
-	addr := fmt.Sprintf(cm.SeleniumAddrPattern, cm.SeleniumPort)
-	wd, err := selenium.NewRemote(caps, addr)
+	jar, err := cookiejar.New(nil)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"error":	err.Error(),
-		}).Panic("can not get selenium remote instance by initWebDriver")
-
 		panic(err)
 	}
+	client.Jar = jar
 
-	// set timeout
-	wd.SetPageLoadTimeout(time.Duration(180) * time.Second)
-	wd.SetAsyncScriptTimeout(time.Duration(180) * time.Second)
-	
-	log.Info("init web driver success...")
-
-	return &wd
-}
-
-func (h *ServiceHTTP) restartWebDriver() {
-	if h.wd != nil {
-		err := (*h.wd).Quit()
-		h.wd = nil
-		if err != nil {
-			log.WithFields(log.Fields{
-				"error":	err.Error(),
-			}).Error("quit browser failed by restartWebDriver")
-		}
-	}
-
-	for {
-		h.wd = initWebDriver()
-		if h.wd != nil {
-			log.Info("restart web driver success...")
-
-			break
-		}
-
-		log.Error("restart web driver failed, keep trying")
-		time.Sleep(time.Duration(5) * time.Second)
-	}
+	return client
 }
 
 // convertCustomResponse for convert response to custom response
-func convertCustomResponse(resp *http.Response) *CustomResponse {
+func convertCustomResponse(resp *http.Response) (*CustomResponse, error) {
 	cusResp := &CustomResponse{
 		Headers: make(map[string]string),
 	}
@@ -174,36 +124,53 @@ func convertCustomResponse(resp *http.Response) *CustomResponse {
 		cusResp.Headers[header] = resp.Header.Get(header)
 	}
 	cusResp.StatusCode = resp.StatusCode
-	body, _ := ioutil.ReadAll(resp.Body)
+	body, err := ioutil.ReadAll(resp.Body)
 	cusResp.Body = body
 
-	return cusResp
+	return cusResp, err
 }
 
-// RequestPost for request post
-func (h *ServiceHTTP) RequestPost(url string, body string, headers map[string]string) *CustomResponse {
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer([]byte(body)))
-	if err != nil {
-		log.WithFields(log.Fields{
-			"url":	url,
-		}).Error("can not new request at RequestPost")
+// backoff returns wait before retry of attempt (from 1) of http requests
+func backoff(attempt int) time.Duration {
+	base := beego.AppConfig.DefaultInt("http::backoff", cm.HTTPBackoff)
+	max := beego.AppConfig.DefaultInt("http::backoffMax", cm.HTTPBackoffMax)
+
+	return Backoff(attempt, base, max)
+}
 
-		return nil
+// Backoff returns wait before retry of attempt (from 1), base and max are milliseconds,
+// exponential with jitter in [d/2, d]
+func Backoff(attempt int, base int, max int) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if d <= 0 {
+		return 0
 	}
+	d = d / 2 + rand.Intn(d / 2 + 1)
 
+	return time.Duration(d) * time.Millisecond
+}
+
+// doOnce returns response of one request, request is built every attempt so body is never reused
+func (h *ServiceHTTP) doOnce(client *http.Client, method string, url string, body []byte, headers map[string]string) (*CustomResponse, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
 	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
 
-	httpClient := getTransportHttpClient()
-	resp, err := httpClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"url":	url,
-		}).Error("can not get body at RequestPost")
-
-		return &CustomResponse{}
+		return nil, err
 	}
+	defer resp.Body.Close()
 
 	// count request num
 	atomic.AddUint64(&h.RequestCounter, 1)
@@ -211,16 +178,82 @@ func (h *ServiceHTTP) RequestPost(url string, body string, headers map[string]st
 	return convertCustomResponse(resp)
 }
 
-// GetJsonRequestPost returns []byte by request post
-func (h *ServiceHTTP) GetJsonRequestPost(pageURL string) []byte {
+// Do returns response of request, transient failures are retried with backoff,
+// returns *FetchError if failed at last, response is also returned if site responded with non 2xx status
+func (h *ServiceHTTP) Do(method string, url string, body []byte, headers map[string]string) (*CustomResponse, error) {
+	retry := beego.AppConfig.DefaultInt("http::retry", cm.HTTPRetry)
+	retryAfterMax := time.Duration(beego.AppConfig.DefaultInt("http::retryAfterMax", cm.HTTPRetryAfterMax)) * time.Second
+
+	client := h.newClient()
+	for attempt := 1; ; attempt++ {
+		resp, err := h.doOnce(client, method, url, body, headers)
+
+		var fe *FetchError
+		if err != nil {
+			fe = &FetchError{Class: classifyError(err), URL: url, Attempts: attempt, Err: err}
+		} else if class := classifyStatus(resp.StatusCode); len(class) > 0 {
+			fe = &FetchError{Class: class, URL: url, StatusCode: resp.StatusCode, Attempts: attempt}
+			fe.RetryAfter = parseRetryAfter(resp.Headers["Retry-After"])
+		} else {
+			return resp, nil
+		}
+
+		if attempt > retry || !fe.Transient() || fe.RetryAfter > retryAfterMax {
+			atomic.AddUint64(&h.FailCounter, 1)
+			log.WithFields(log.Fields{
+				"url":			url,
+				"class":		fe.Class,
+				"statusCode":	fe.StatusCode,
+				"attempts":		attempt,
+			}).Warn("request failed by Do")
+
+			return resp, fe
+		}
+
+		wait := backoff(attempt)
+		if fe.RetryAfter > wait {
+			wait = fe.RetryAfter
+		}
+		atomic.AddUint64(&h.RetryCounter, 1)
+
+		// debug
+		log.WithFields(log.Fields{
+			"url":		url,
+			"class":	fe.Class,
+			"attempt":	attempt,
+			"wait":		wait,
+		}).Debug("retry request by Do")
+
+		time.Sleep(wait)
+	}
+}
+
+// RequestPost for request post
+func (h *ServiceHTTP) RequestPost(url string, body string, headers map[string]string) *CustomResponse {
+	resp, err := h.Do("POST", url, []byte(body), headers)
+	if resp == nil {
+		log.WithFields(log.Fields{
+			"url":		url,
+			"error":	err.Error(),
+		}).Error("can not get body at RequestPost")
+
+		return &CustomResponse{}
+	}
+
+	return resp
+}
+
+// FetchJSONPost returns json body by request post, error is *FetchError if request failed,
+// body is cached for ttl, 0 means do not cache
+func (h *ServiceHTTP) FetchJSONPost(pageURL string, ttl time.Duration) ([]byte, error) {
 	u, _ := url.Parse(pageURL)
 	index := strings.LastIndex(u.RequestURI(), "/")
 	if index < 0 || index >= len(u.RequestURI()){
 		log.WithFields(log.Fields{
 			"pageURL":	pageURL,
-		}).Warn("not a legal post url by GetJsonRequestPost")
+		}).Warn("not a legal post url by FetchJSONPost")
 
-		return nil
+		return nil, errors.New("not a legal post url")
 	}
 
 	char := u.RequestURI()[strings.LastIndex(u.RequestURI(), "/")+1:]  // get url's last characteristic
@@ -230,114 +263,88 @@ func (h *ServiceHTTP) GetJsonRequestPost(pageURL string) []byte {
 	headers["User-Agent"] = cm.HeaderUserAgent
 	headers["content-type"] = cm.HeaderContentType
 	headers["Accept"] = `application/json, text/plain, */*`
-	resp := h.RequestPost(postURL, fmt.Sprintf("subdom=%s", char), headers)
-	if resp == nil || resp.StatusCode != 200 {
+	resp, err := h.DoCached("POST", postURL, []byte(fmt.Sprintf("subdom=%s", char)), headers, ttl)
+	if err != nil {
 		log.WithFields(log.Fields{
 			"pageURL":	pageURL,
-		}).Error("http request post page failed by GetJsonRequestPost")
+			"error":	err.Error(),
+		}).Error("http request post page failed by FetchJSONPost")
 
-		return nil
+		return nil, err
 	}
 
-	return resp.Body
+	return resp.Body, nil
 }
 
-// RequestGet return pointer of CustomResponse instance for request get
-func (h *ServiceHTTP) RequestGet(url string, headers map[string]string) *CustomResponse {
-	req, err := http.NewRequest("GET", url, strings.NewReader(""))
-	if err != nil {
-		log.WithFields(log.Fields{
-			"url":	url,
-		}).Error("can not new request by RequestGet")
-
-		return nil
-	}
+// GetJsonRequestPost returns []byte by request post
+func (h *ServiceHTTP) GetJsonRequestPost(pageURL string) []byte {
+	body, _ := h.FetchJSONPost(pageURL, 0)
 
-	for k, v := range headers {
-		req.Header.Set(k, v)
-	}
+	return body
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
+// RequestGet return pointer of CustomResponse instance for request get, nil if site did not respond
+func (h *ServiceHTTP) RequestGet(url string, headers map[string]string) *CustomResponse {
+	resp, err := h.Do("GET", url, nil, headers)
+	if resp == nil {
 		log.WithFields(log.Fields{
-			"url":	url,
+			"url":		url,
+			"error":	err.Error(),
 		}).Error("can not get body by RequestGet")
-
-		return nil
 	}
 
-	defer resp.Body.Close()
-
-	// count request num
-	atomic.AddUint64(&h.RequestCounter, 1)
-
-	return convertCustomResponse(resp)
+	return resp
 }
 
-// GetDocRequestGet returns doc pointer of goquery.Document instance by request get
-func (h *ServiceHTTP) GetDocRequestGet(pageURL string) *goquery.Document {
-	resp := h.RequestGet(pageURL, DefaultHeader())
-	if resp == nil {
-		return nil
-	}
-	if resp.StatusCode != 200 {
-		log.WithFields(log.Fields{
-			"statusCode":	resp.StatusCode,
-			"body":			string(resp.Body),
-		}).Error("request html error by GetDocRequestGet")
+// FetchDoc returns pointer of goquery.Document instance by request get, error is *FetchError if request failed,
+// page is cached for ttl, 0 means do not cache
+func (h *ServiceHTTP) FetchDoc(pageURL string, ttl time.Duration) (*goquery.Document, error) {
+	resp, err := h.DoCached("GET", pageURL, nil, DefaultHeader(), ttl)
+	if err != nil {
+		fields := log.Fields{
+			"pageURL":	pageURL,
+			"error":	err.Error(),
+		}
+		if resp != nil {
+			fields["body"] = string(resp.Body)
+		}
+		log.WithFields(fields).Error("request html error by FetchDoc")
 
-		return nil
+		return nil, err
 	}
 
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(resp.Body)))
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(resp.Body))
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error":	err.Error(),
-		}).Error("new document failed by GetDocRequestGet")
+		}).Error("new document failed by FetchDoc")
 
-		return nil
+		return nil, err
 	}
 
+	return doc, nil
+}
+
+// GetDocRequestGet returns doc pointer of goquery.Document instance by request get
+func (h *ServiceHTTP) GetDocRequestGet(pageURL string) *goquery.Document {
+	doc, _ := h.FetchDoc(pageURL, 0)
+
 	return doc
 }
 
 // RequestWithTransportGet request get with transport
 func (h *ServiceHTTP) RequestTransportGet(url string) *CustomResponse {
-	req, err := http.NewRequest("GET", url, strings.NewReader(""))
-	if err != nil {
-		log.WithFields(log.Fields{
-			"url":	url,
-		}).Error("can not new request at RequestWithTransportGet")
-
-		return nil
-	}
-
-	retry := 3
-	resp := new(http.Response)
-	var errD error
-	httpClient := getTransportHttpClient()
-	for i := 0; i < retry; i++ {
-		resp, errD = httpClient.Do(req)
-		if errD == nil && resp != nil && resp.StatusCode == 200 {
-			break
-		}
-	}
-
-	if errD != nil {
+	resp, err := h.Do("GET", url, nil, nil)
+	if resp == nil {
 		log.WithFields(log.Fields{
-			"url":	url,
+			"url":		url,
+			"error":	err.Error(),
 		}).Error("can not get body at RequestWithTransportGet")
 
 		return &CustomResponse{}
 	}
 
-	defer resp.Body.Close()
-
-	// count request num
-	atomic.AddUint64(&h.RequestCounter, 1)
-
-	return convertCustomResponse(resp)
+	return resp
 }
 
 // DownloadImage returns success flag and image name
@@ -412,42 +419,36 @@ func (h *ServiceHTTP) DownloadImage(url string, dir string, rename string) (stri
 	return imageName, true
 }
 
-// GetURLWebDriver for get specified url using web driver
-func (h *ServiceHTTP) GetURLWebDriver(url string) *selenium.WebDriver {
-	// debug
-	last := time.Now()
-
-	// https://blog.csdn.net/weixin_30906425/article/details/98371286
-	now := time.Now()
-	subTime := now.Sub(h.wdLastRestartTime)
-	if subTime >= (time.Duration(24) * time.Hour) {
-		log.Info("this browser has been running for more than one day do restart")
-		h.wdLastRestartTime = now
-		h.restartWebDriver()
-	}
+// LeaseWebDriver returns pointer of WebDriverLease instance, lease must be released after use
+func (h *ServiceHTTP) LeaseWebDriver() (*WebDriverLease, error) {
+	return h.wdPool.Lease()
+}
 
-	if err := (*h.wd).Get(url); err != nil {
-		log.WithFields(log.Fields{
-			"url":   url,
-			"error": err.Error(),
-		}).Error("can not open url by web driver by GetURLWebDriver")
+// WebDriverPool returns pool of web driver sessions
+func (h *ServiceHTTP) WebDriverPool() *WebDriverPool {
+	return h.wdPool
+}
 
-		return nil
-	}
+// startWebDriver returns new browser session, start local web driver server first if configured
+func (h *ServiceHTTP) startWebDriver() (*selenium.WebDriver, error) {
+	if h.wdLauncher != nil {
+		if err := h.wdLauncher.Start(); err != nil {
+			log.WithFields(log.Fields{
+				"launch":	h.wdConf.Launch,
+				"error":	err.Error(),
+			}).Error("can not start local web driver server by startWebDriver")
 
-	// debug
-	now = time.Now()
-	log.WithFields(log.Fields{
-		"time":	now.Sub(last),
-	}).Debug("test duration, web driver get url by GetURLWebDriver")
-	last = now
+			return nil, err
+		}
+	}
 
-	return h.wd
+	return initWebDriver(h.wdConf)
 }
 
-// QuitWebDriver for quit web driver
+// QuitWebDriver for quit all web driver sessions and stop local web driver server
 func (h *ServiceHTTP) QuitWebDriver() {
-	if (*h.wd) != nil {
-		(*h.wd).Quit()
+	h.wdPool.Close()
+	if h.wdLauncher != nil {
+		h.wdLauncher.Stop()
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,310 @@
+/*
+  Package http for cache responses of page fetch
+*/
+
+package http
+
+import (
+	"container/list"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/astaxie/beego"
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+
+	cm "siteResService/src/common"
+	ut "siteResService/src/util"
+)
+
+// CacheMethodWeb for method of cache key of pages rendered by web driver
+const CacheMethodWeb = "WEB"
+
+// CacheEntry represents one cached response, saved as <key md5>.json if cache dir is set
+type CacheEntry struct {
+	Key				string				`json:"key"`
+	URL				string				`json:"url"`  // current url, differs from requested url if redirected
+	StatusCode		int					`json:"status_code"`
+	Body			[]byte				`json:"body"`
+	Headers			map[string]string	`json:"headers,omitempty"`
+	ETag			string				`json:"etag,omitempty"`
+	LastModified	string				`json:"last_modified,omitempty"`
+	Extra			[]byte				`json:"extra,omitempty"`  // order page source rendered by web driver
+	Stored			time.Time			`json:"stored"`  // time fetched or revalidated
+}
+
+// cacheItem represents one entry in lru list, entry is nil until file of entry in dir is read
+type cacheItem struct {
+	id		string  // md5 of key, name of entry file
+	entry	*CacheEntry
+}
+
+// ResponseCache represents cache of responses keyed by method and url, kept in memory and optional dir,
+// entries in memory and files in dir are counted together and the least recently used one is dropped when full
+type ResponseCache struct {
+	lock				sync.Mutex
+	lru					*list.List  // *cacheItem, the front is the most recently used
+	items				map[string]*list.Element  // id mapping element of lru
+	enable				bool
+	ttl					time.Duration  // default ttl
+	dir					string  // empty means memory only
+	maxEntries			int
+	HitCounter			uint64  // calculation num of fresh hit, must use by atomic !!!
+	RevalidateCounter	uint64  // calculation num of stale entry revalidated by 304, must use by atomic !!!
+	MissCounter			uint64  // calculation num of miss, must use by atomic !!!
+}
+
+// newResponseCache returns pointer of ResponseCache instance read from app.conf
+func newResponseCache() *ResponseCache {
+	c := new(ResponseCache)
+	c.lru = list.New()
+	c.items = make(map[string]*list.Element)
+	c.enable = beego.AppConfig.DefaultBool("cache::enable", cm.CacheEnable)
+	c.ttl = time.Duration(beego.AppConfig.DefaultInt("cache::ttl", cm.CacheTTL)) * time.Second
+	c.dir = beego.AppConfig.DefaultString("cache::dir", cm.CacheDir)
+	c.maxEntries = beego.AppConfig.DefaultInt("cache::maxEntries", cm.CacheMaxEntries)
+
+	if len(c.dir) > 0 {
+		if err := os.MkdirAll(c.dir, os.ModePerm); err != nil {
+			log.WithFields(log.Fields{
+				"dir":		c.dir,
+				"error":	err.Error(),
+			}).Error("can not make cache dir, cache in memory only")
+			c.dir = ""
+		}
+	}
+	if len(c.dir) > 0 {
+		c.loadDir()
+	}
+
+	return c
+}
+
+// loadDir for index entry files left in cache dir by modify time, files over max entries are removed
+func (c *ResponseCache) loadDir() {
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"dir":		c.dir,
+			"error":	err.Error(),
+		}).Error("can not read cache dir by loadDir")
+
+		return
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		id := strings.TrimSuffix(f.Name(), ".json")
+		c.items[id] = c.lru.PushFront(&cacheItem{id: id})
+	}
+	c.evict()
+
+	log.WithFields(log.Fields{
+		"dir":		c.dir,
+		"entries":	c.lru.Len(),
+	}).Info("load cache dir success")
+}
+
+// evict for drop the least recently used entries and their files until cache is not full, must hold lock
+func (c *ResponseCache) evict() {
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		item := c.lru.Remove(c.lru.Back()).(*cacheItem)
+		delete(c.items, item.id)
+		if len(c.dir) > 0 {
+			os.Remove(c.filePath(item.id))
+		}
+	}
+}
+
+// CacheKey returns key of request, body of post is part of key
+func CacheKey(method string, url string, body []byte) string {
+	if len(body) <= 0 {
+		return method + " " + url
+	}
+
+	return fmt.Sprintf("%s %s %s", method, url, ut.GetMD5(string(body)))
+}
+
+// TTL returns ttl of template cache ttl in seconds, 0 means default, 0 is returned if cache is disabled
+func (c *ResponseCache) TTL(seconds int) time.Duration {
+	if !c.enable || seconds < 0 {
+		return 0
+	}
+	if seconds == 0 {
+		return c.ttl
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// filePath returns path of entry file of id
+func (c *ResponseCache) filePath(id string) string {
+	return path.Join(c.dir, id + ".json")
+}
+
+// Get returns cached entry of key, entry read from dir is kept in memory
+func (c *ResponseCache) Get(key string) (*CacheEntry, bool) {
+	id := ut.GetMD5(key)
+	c.lock.Lock()
+	el, ok := c.items[id]
+	if !ok {
+		c.lock.Unlock()
+
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	e := el.Value.(*cacheItem).entry
+	c.lock.Unlock()
+	if e != nil && e.Key == key {
+		return e, true
+	}
+	if e != nil || len(c.dir) <= 0 {
+		return nil, false
+	}
+
+	dat, err := ioutil.ReadFile(c.filePath(id))
+	if err != nil {
+		return nil, false
+	}
+	e = new(CacheEntry)
+	if err := jsoniter.Unmarshal(dat, e); err != nil || e.Key != key {
+		return nil, false
+	}
+
+	c.lock.Lock()
+	if el, ok := c.items[id]; ok && el.Value.(*cacheItem).entry == nil {  // not evicted or put meanwhile
+		el.Value.(*cacheItem).entry = e
+	}
+	c.lock.Unlock()
+
+	return e, true
+}
+
+// Fresh returns entry of key if it is stored within ttl
+func (c *ResponseCache) Fresh(key string, ttl time.Duration) (*CacheEntry, bool) {
+	if ttl <= 0 {
+		return nil, false
+	}
+
+	e, ok := c.Get(key)
+	if !ok || time.Now().Sub(e.Stored) >= ttl {
+		return nil, false
+	}
+
+	return e, true
+}
+
+// Put for store entry, the least recently used entry is dropped if cache is full
+func (c *ResponseCache) Put(e *CacheEntry) {
+	id := ut.GetMD5(e.Key)
+	c.lock.Lock()
+	if el, ok := c.items[id]; ok {
+		el.Value.(*cacheItem).entry = e
+		c.lru.MoveToFront(el)
+	} else {
+		c.items[id] = c.lru.PushFront(&cacheItem{id: id, entry: e})
+		c.evict()
+	}
+	c.lock.Unlock()
+
+	if len(c.dir) <= 0 {
+		return
+	}
+	dat, err := jsoniter.Marshal(e)
+	if err == nil {
+		err = ioutil.WriteFile(c.filePath(id), dat, 0644)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"url":		e.URL,
+			"error":	err.Error(),
+		}).Error("can not save cache entry by Put")
+	}
+}
+
+// Touch for mark entry fresh again after revalidated
+func (c *ResponseCache) Touch(e *CacheEntry) {
+	touched := *e
+	touched.Stored = time.Now()
+	c.Put(&touched)
+}
+
+// Response returns response of entry
+func (e *CacheEntry) Response() *CustomResponse {
+	return &CustomResponse{StatusCode: e.StatusCode, Body: e.Body, Headers: e.Headers}
+}
+
+// DoCached returns response of request from cache if stored within ttl, stale entry is revalidated by
+// If-None-Match and If-Modified-Since, ttl 0 means do not cache
+func (h *ServiceHTTP) DoCached(method string, url string, body []byte, headers map[string]string, ttl time.Duration) (*CustomResponse, error) {
+	if ttl <= 0 {
+		return h.Do(method, url, body, headers)
+	}
+
+	key := CacheKey(method, url, body)
+	e, ok := h.cache.Get(key)
+	if ok && time.Now().Sub(e.Stored) < ttl {
+		atomic.AddUint64(&h.cache.HitCounter, 1)
+
+		return e.Response(), nil
+	}
+
+	// revalidate stale entry
+	reqHeaders := headers
+	if ok && (len(e.ETag) > 0 || len(e.LastModified) > 0) {
+		reqHeaders = make(map[string]string)
+		for k, v := range headers {
+			reqHeaders[k] = v
+		}
+		if len(e.ETag) > 0 {
+			reqHeaders["If-None-Match"] = e.ETag
+		}
+		if len(e.LastModified) > 0 {
+			reqHeaders["If-Modified-Since"] = e.LastModified
+		}
+	}
+
+	resp, err := h.Do(method, url, body, reqHeaders)
+	if err != nil {
+		return resp, err
+	}
+	if ok && resp.StatusCode == 304 {
+		atomic.AddUint64(&h.cache.RevalidateCounter, 1)
+		h.cache.Touch(e)
+
+		return e.Response(), nil
+	}
+	atomic.AddUint64(&h.cache.MissCounter, 1)
+
+	if resp.StatusCode == 200 {
+		h.cache.Put(&CacheEntry{
+			Key:			key,
+			URL:			url,
+			StatusCode:		resp.StatusCode,
+			Body:			resp.Body,
+			Headers:		resp.Headers,
+			ETag:			resp.Headers["Etag"],
+			LastModified:	resp.Headers["Last-Modified"],
+			Stored:			time.Now(),
+		})
+	}
+
+	return resp, nil
+}
+
+// ResponseCache returns cache of responses
+func (h *ServiceHTTP) ResponseCache() *ResponseCache {
+	return h.cache
+}
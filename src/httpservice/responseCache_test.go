@@ -0,0 +1,102 @@
+/*
+  Package http for test eviction of response cache in memory and dir
+*/
+
+package http
+
+import (
+	"container/list"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+
+	ut "siteResService/src/util"
+)
+
+// newTestCache returns response cache of dir with max entries, files left in dir are indexed
+func newTestCache(t *testing.T, dir string, maxEntries int) *ResponseCache {
+	t.Helper()
+
+	c := &ResponseCache{
+		lru:		list.New(),
+		items:		make(map[string]*list.Element),
+		enable:		true,
+		ttl:		time.Minute,
+		dir:		dir,
+		maxEntries:	maxEntries,
+	}
+	if len(dir) > 0 {
+		c.loadDir()
+	}
+
+	return c
+}
+
+// exists returns true if entry file of key is in dir of cache
+func exists(c *ResponseCache, key string) bool {
+	_, err := os.Stat(c.filePath(ut.GetMD5(key)))
+
+	return err == nil
+}
+
+// TestResponseCacheLRU checks the least recently used entry is dropped, not the oldest stored one
+func TestResponseCacheLRU(t *testing.T) {
+	c := newTestCache(t, "", 2)
+	c.Put(&CacheEntry{Key: "GET a", Stored: time.Now()})
+	c.Put(&CacheEntry{Key: "GET b", Stored: time.Now()})
+	if _, ok := c.Get("GET a"); !ok {
+		t.Fatal("entry a is not cached")
+	}
+	c.Put(&CacheEntry{Key: "GET c", Stored: time.Now()})
+
+	if _, ok := c.Get("GET b"); ok {
+		t.Fatal("entry b is kept, want it dropped as least recently used")
+	}
+	for _, key := range []string{"GET a", "GET c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Fatalf("entry %s is dropped", key)
+		}
+	}
+}
+
+// TestResponseCacheDir checks files left in dir are counted at start up and dropped by modify time
+func TestResponseCacheDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "responseCache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	left := &ResponseCache{dir: dir}  // files left by earlier run
+	keys := []string{"GET old", "GET mid", "GET new"}
+	for i, key := range keys {
+		file := left.filePath(ut.GetMD5(key))
+		dat, _ := jsoniter.Marshal(&CacheEntry{Key: key, Stored: time.Now()})
+		if err := ioutil.WriteFile(file, dat, 0644); err != nil {
+			t.Fatal(err)
+		}
+		mod := time.Now().Add(time.Duration(i - len(keys)) * time.Minute)
+		if err := os.Chtimes(file, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := newTestCache(t, dir, 2)
+	if exists(c, "GET old") {
+		t.Fatal("file of oldest entry is kept over max entries")
+	}
+	if e, ok := c.Get("GET mid"); !ok || e.Key != "GET mid" {
+		t.Fatal("entry left in dir is not read")
+	}
+
+	c.Put(&CacheEntry{Key: "GET put", Stored: time.Now()})
+	if exists(c, "GET new") {
+		t.Fatal("file of least recently used entry is kept")
+	}
+	if !exists(c, "GET mid") || !exists(c, "GET put") {
+		t.Fatal("file of used entry is dropped")
+	}
+}
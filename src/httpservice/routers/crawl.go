@@ -0,0 +1,96 @@
+/*
+  Package routers for crawl api of protobuf contract CrawlRequest and CrawlResult
+*/
+
+package routers
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+
+	pb "siteResService/src/proto"
+)
+
+// CodeInternalError for error code of failed encoding response
+const CodeInternalError = "internal_error"
+
+// content types of protobuf body, json is used otherwise
+var protobufTypes = []string{"application/protobuf", "application/x-protobuf", "application/octet-stream"}
+
+// isProtobuf returns true if content type is protobuf
+func isProtobuf(contentType string) bool {
+	for _, t := range protobufTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// crawl for parse page of CrawlRequest in json or protobuf body, CrawlResult is responded in same format,
+// status of failed crawl is same as /siteResource
+var crawl = func(w http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, errors.New("only support POST"))
+
+		return
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, err)
+
+		return
+	}
+	useProtobuf := isProtobuf(request.Header.Get("Content-Type"))
+	req := new(pb.CrawlRequest)
+	if useProtobuf {
+		err = proto.Unmarshal(body, req)
+	} else {
+		err = jsonpb.UnmarshalString(string(body), req)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, errors.New("request body is not a legal CrawlRequest: " + err.Error()))
+
+		return
+	}
+
+	atomic.AddUint64(instance.subCounter, 1) // count receive num
+
+	res := task.Crawl(req)
+	status := http.StatusOK
+	if res.Error != nil {
+		status = codeStatus(res.Error.Code)
+	}
+
+	if useProtobuf {
+		dat, err := proto.Marshal(res)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, CodeInternalError, err)
+
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(status)
+		w.Write(dat)
+
+		return
+	}
+
+	dat, err := (&jsonpb.Marshaler{OrigName: true}).MarshalToString(res)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternalError, err)
+
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte(dat))
+}
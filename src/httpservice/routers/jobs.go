@@ -0,0 +1,183 @@
+/*
+  Package routers for asynchronous crawl job api, described by docs/openapi.yaml
+*/
+
+package routers
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/astaxie/beego"
+	jsoniter "github.com/json-iterator/go"
+
+	cm "siteResService/src/common"
+	hs "siteResService/src/httpservice"
+	qu "siteResService/src/queue"
+	sc "siteResService/src/scheduler"
+	tk "siteResService/src/taskservice"
+)
+
+// error codes of job api
+const (
+	CodeJobNotFound		= "job_not_found"
+	CodeTooManyURLs		= "too_many_urls"
+	CodeTooBusy			= "too_busy"
+)
+
+// JobRequest represents request of submit crawl job
+type JobRequest struct {
+	URLs		[]string	`json:"urls"`
+	URL			string		`json:"url,omitempty"`  // one url, added to urls
+	Callback	string		`json:"callback,omitempty"`  // results are posted to this url when job is done
+	Priority	*int		`json:"priority,omitempty"`  // sc.PriorityHigh if not set
+	Timeout		int			`json:"timeout,omitempty"`  // seconds, urls not started in timeout fail
+}
+
+// JobSubmitResponse represents crawl job submitted
+type JobSubmitResponse struct {
+	ID		string	`json:"id"`
+	URLs	int		`json:"urls"`
+}
+
+// JobURLResponse represents status of one url of crawl job
+type JobURLResponse struct {
+	URL			string					`json:"url"`
+	Status		string					`json:"status"`  // queued, fetching, parsed or failed
+	Code		string					`json:"code,omitempty"`  // error code of failed
+	Class		string					`json:"class,omitempty"`  // class of fetch failure
+	Reason		string					`json:"reason,omitempty"`
+	Resource	map[string]interface{}	`json:"resource,omitempty"`  // selected fields of parsed
+}
+
+// JobResponse represents status of crawl job
+type JobResponse struct {
+	ID		string				`json:"id"`
+	Created	time.Time			`json:"created"`
+	Done	bool				`json:"done"`
+	Counts	map[string]int		`json:"counts"`  // num of urls by status
+	URLs	[]*JobURLResponse	`json:"urls"`
+}
+
+// retryAfter returns seconds a rejected job should wait before submitted again
+func retryAfter() int {
+	if seconds := beego.AppConfig.DefaultInt("intake::timeout", cm.IntakeTimeout); seconds > 0 {
+		return seconds
+	}
+
+	return 1
+}
+
+// submitJob for submit urls as one crawl job
+var submitJob = func(w http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, errors.New("only support POST"))
+
+		return
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, err)
+
+		return
+	}
+	req := new(JobRequest)
+	if err := jsoniter.Unmarshal(body, req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, errors.New("request body is not a legal json: " + err.Error()))
+
+		return
+	}
+	if len(req.URL) > 0 {
+		req.URLs = append(req.URLs, req.URL)
+	}
+
+	opts := tk.JobOptions{
+		Callback:	req.Callback,
+		Priority:	sc.PriorityHigh,
+		Timeout:	time.Duration(req.Timeout) * time.Second,
+	}
+	if req.Priority != nil {
+		if err := sc.CheckPriority(*req.Priority); err != nil {
+			writeError(w, http.StatusBadRequest, CodeBadPriority, err)
+
+			return
+		}
+		opts.Priority = *req.Priority
+	}
+	job, err := task.SubmitJob(req.URLs, opts)
+	if errors.Is(err, tk.ErrTooManyURLs) {
+		writeError(w, http.StatusRequestEntityTooLarge, CodeTooManyURLs, err)
+
+		return
+	}
+	if errors.Is(err, tk.ErrBadURL) {
+		writeError(w, http.StatusBadRequest, CodeBadURL, err)
+
+		return
+	}
+	if errors.Is(err, qu.ErrIntakeFull) {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter()))
+		writeError(w, http.StatusTooManyRequests, CodeTooBusy, err)
+
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, err)
+
+		return
+	}
+	atomic.AddUint64(instance.subCounter, uint64(len(req.URLs))) // count receive num
+
+	writeJSON(w, http.StatusAccepted, &JobSubmitResponse{ID: job.ID, URLs: len(job.Items)})
+}
+
+// getJob for get status of crawl job by /jobs/{id}, results are selected by query param fields
+var getJob = func(w http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, errors.New("only support GET"))
+
+		return
+	}
+
+	var fields []string
+	if f := request.URL.Query().Get("fields"); len(f) > 0 {
+		fields = strings.Split(f, ",")
+	}
+	if err := tk.CheckResourceFields(fields); err != nil {
+		writeError(w, http.StatusBadRequest, CodeUnknownField, err)
+
+		return
+	}
+
+	id := request.URL.Path[strings.LastIndex(request.URL.Path, "/") + 1:]
+	job, ok := task.Job(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, CodeJobNotFound, errors.New("job not found or expired: " + id))
+
+		return
+	}
+
+	res := &JobResponse{ID: job.ID, Created: job.Created, Done: job.Done(), Counts: make(map[string]int)}
+	for _, item := range job.Items {
+		status, pi, err := item.State()
+		urlRes := &JobURLResponse{URL: item.URL, Status: status}
+		if err != nil {
+			_, urlRes.Code = errorCode(err)
+			urlRes.Class = hs.ErrorClass(err)
+			urlRes.Reason = err.Error()
+		}
+		if pi != nil {
+			urlRes.Resource, _ = tk.SelectResource(pi, fields)
+		}
+		res.Counts[status]++
+		res.URLs = append(res.URLs, urlRes)
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
@@ -5,26 +5,44 @@
 package routers
 
 import (
+	"crypto/subtle"
 	"errors"
-	"fmt"
 	"io/ioutil"
+	"fmt"
 	"net/http"
 	"siteResService/src/data"
+	"strings"
 	"sync"
-	"sync/atomic"
 
 	"github.com/astaxie/beego"
 	jsoniter "github.com/json-iterator/go"
 	log "github.com/sirupsen/logrus"
 
 	cm "siteResService/src/common"
+	mt "siteResService/src/metrics"
 	tk "siteResService/src/taskservice"
+	st "siteResService/src/taskservice/sites"
+	ut "siteResService/src/util"
 )
 
 var instance *Router
 var task *tk.TaskService
 var initRouterOnce sync.Once
 
+// error codes of admin api
+const (
+	CodeUnauthorized	= "unauthorized"
+	CodeAdminDisabled	= "admin_disabled"
+	CodeReloadFailed	= "reload_failed"
+	CodeRollbackFailed	= "rollback_failed"
+)
+
+// ErrUnauthorized returned when admin request do not have admin token
+var ErrUnauthorized = errors.New("admin token is missing or wrong")
+
+// ErrAdminDisabled returned when admin token is not configured
+var ErrAdminDisabled = errors.New("admin routes are disabled, set admin::token")
+
 // Router represents Router
 type Router struct {
 	// mapping route with func
@@ -53,9 +71,27 @@ func (r *Router) initMapping() {
 	version := beego.AppConfig.DefaultString("version", cm.Version)
 	r.RouterMap = make(map[string]func(w http.ResponseWriter, request *http.Request))
 	r.RouterMap["/" + version + "/siteResource"] = getSiteResource
+	r.RouterMap["/" + version + "/jobs"] = submitJob
+	r.RouterMap["/" + version + "/jobs/"] = getJob
+	r.RouterMap["/" + version + "/crawl"] = crawl
 
 	// lijing
 	r.RouterMap["/" + version + "/import"] = data.ImportData
+
+	// template admin, need admin token
+	token := beego.AppConfig.DefaultString("admin::token", cm.AdminToken)
+	r.RouterMap["/" + version + "/admin/template/reload"] = adminOnly(token, reloadTemplates)
+	r.RouterMap["/" + version + "/admin/template/rollback"] = adminOnly(token, rollbackTemplate)
+	r.RouterMap["/" + version + "/admin/template/versions"] = adminOnly(token, getTemplateVersions)
+
+	// scheduler admin, need admin token
+	r.RouterMap["/" + version + "/admin/scheduler"] = adminOnly(token, getScheduler)
+	r.RouterMap["/" + version + "/admin/scheduler/pool"] = adminOnly(token, setPool)
+	r.RouterMap["/" + version + "/admin/scheduler/pause"] = adminOnly(token, pauseDispatcher)
+	r.RouterMap["/" + version + "/admin/scheduler/resume"] = adminOnly(token, resumeDispatcher)
+
+	// prometheus metrics, not versioned for scrapers
+	r.RouterMap["/metrics"] = mt.Handler().ServeHTTP
 }
 
 // add route
@@ -69,32 +105,99 @@ func (r *Router) AddRouter(router string,
 	return nil
 }
 
-// define func
-var getSiteResource = func(w http.ResponseWriter, request *http.Request) {
-	body, err := ioutil.ReadAll(request.Body)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error":	err.Error(),
-		}).Error("can not get post params by micro web service")
+// adminOnly returns handler which refuses request without header "Authorization: Bearer <token>",
+// all requests are refused if token is empty
+func adminOnly(token string, f func(w http.ResponseWriter, request *http.Request)) func(w http.ResponseWriter, request *http.Request) {
+	return func(w http.ResponseWriter, request *http.Request) {
+		if len(token) <= 0 {
+			writeError(w, http.StatusForbidden, CodeAdminDisabled, ErrAdminDisabled)
+
+			return
+		}
+
+		auth := request.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			log.WithFields(log.Fields{
+				"path":		request.URL.Path,
+				"remote":	request.RemoteAddr,
+			}).Warn("refuse admin request without token by adminOnly")
+
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, ErrUnauthorized)
+
+			return
+		}
+
+		f(w, request)
+	}
+}
+
+// writeJSON for write data as json response with status code
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte(ut.ToJson(data)))
+}
+
+// reloadTemplates for parse template file again and swap templates in use
+var reloadTemplates = func(w http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, errors.New("only support POST"))
 
 		return
 	}
 
-	resMap := make(map[string]string)
-	if err := jsoniter.Unmarshal(body, &resMap); err != nil{
+	site := st.GetSiteServiceInstance()
+	if err := site.ReloadTemplates(); err != nil {
 		log.WithFields(log.Fields{
 			"error":	err.Error(),
-		}).Error("can not Unmarshal post params to map by micro web service")
+		}).Error("reload templates failed by micro web service")
+
+		writeError(w, http.StatusInternalServerError, CodeReloadFailed, err)
 
 		return
 	}
 
-	atomic.AddUint64(instance.subCounter, 1) // count receive num
+	writeJSON(w, http.StatusOK, site.TemplateVersions())
+}
 
-	res := task.QueryResource(resMap["url"], resMap["title"])
-	response := fmt.Sprintf(`{"message": %v}`, res)
+// rollbackTemplate for roll back domain template to previous version
+var rollbackTemplate = func(w http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, errors.New("only support POST"))
 
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(response))
-}
\ No newline at end of file
+		return
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, err)
+
+		return
+	}
+
+	params := make(map[string]string)
+	if err := jsoniter.Unmarshal(body, &params); err != nil || len(params["domain"]) <= 0 {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, errors.New("need domain param"))
+
+		return
+	}
+
+	version, err := st.GetSiteServiceInstance().RollbackTemplate(params["domain"])
+	if err != nil {
+		writeError(w, http.StatusConflict, CodeRollbackFailed, fmt.Errorf("%w, current version %d", err, version))
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"domain":	params["domain"],
+		"version":	version,
+	})
+}
+
+// getTemplateVersions for list kept versions of each domain template
+var getTemplateVersions = func(w http.ResponseWriter, request *http.Request) {
+	writeJSON(w, http.StatusOK, st.GetSiteServiceInstance().TemplateVersions())
+}
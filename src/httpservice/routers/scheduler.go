@@ -0,0 +1,165 @@
+/*
+  Package routers for scheduler admin, dispatchers are listed, control pools are created, resized, paused and resumed
+*/
+
+package routers
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+
+	sc "siteResService/src/scheduler"
+)
+
+// error codes of scheduler admin api
+const (
+	CodeBadSize				= "bad_size"
+	CodeDispatcherNotFound	= "dispatcher_not_found"
+	CodeNotControl			= "not_control_pool"
+	CodePoolExists			= "pool_exists"
+)
+
+// PoolRequest represents body of scheduler admin requests
+type PoolRequest struct {
+	Name	string	`json:"name"`  // dispatcher name, "default" for tasks which do not need control
+	Size	int		`json:"size,omitempty"`  // max tasks running at the same time, only for pool request
+}
+
+// readPoolRequest returns request of body, error if body illegal or name is empty
+func readPoolRequest(request *http.Request) (*PoolRequest, error) {
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	req := new(PoolRequest)
+	if err := jsoniter.Unmarshal(body, req); err != nil {
+		return nil, errors.New("body is not a pool request: " + err.Error())
+	}
+	if len(req.Name) <= 0 {
+		return nil, errors.New("need name param")
+	}
+
+	return req, nil
+}
+
+// schedulerError returns http status and error code of scheduler admin error
+func schedulerError(err error) (int, string) {
+	switch err {
+	case sc.ErrBadSize:
+		return http.StatusBadRequest, CodeBadSize
+	case sc.ErrNoDispatcher:
+		return http.StatusNotFound, CodeDispatcherNotFound
+	case sc.ErrNotControl:
+		return http.StatusConflict, CodeNotControl
+	case sc.ErrPoolExists:
+		return http.StatusConflict, CodePoolExists
+	}
+
+	return http.StatusInternalServerError, CodeInternal
+}
+
+// writeSchedulerError for write scheduler admin error as error response
+func writeSchedulerError(w http.ResponseWriter, err error) {
+	status, code := schedulerError(err)
+	writeError(w, status, code, err)
+}
+
+// writeDispatcher for write state of dispatchers of name
+func writeDispatcher(w http.ResponseWriter, name string) {
+	for _, info := range sc.GetScheduler().Dispatchers() {
+		if info.Name == name {
+			writeJSON(w, http.StatusOK, info)
+
+			return
+		}
+	}
+
+	writeSchedulerError(w, sc.ErrNoDispatcher)
+}
+
+// getScheduler for list dispatchers with queue depth, active workers and throughput
+var getScheduler = func(w http.ResponseWriter, request *http.Request) {
+	writeJSON(w, http.StatusOK, sc.GetScheduler().Dispatchers())
+}
+
+// setPool for resize control pool of name, or create it if not exists
+var setPool = func(w http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, errors.New("only support POST"))
+
+		return
+	}
+
+	req, err := readPoolRequest(request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, err)
+
+		return
+	}
+
+	s := sc.GetScheduler()
+	err = s.ResizePool(req.Name, req.Size)
+	if err == sc.ErrNoDispatcher {
+		err = s.CreatePool(req.Name, req.Size)
+		if err == sc.ErrPoolExists {  // created by a task at the same time
+			err = s.ResizePool(req.Name, req.Size)
+		}
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"name":		req.Name,
+			"size":		req.Size,
+			"error":	err.Error(),
+		}).Error("set control pool failed by micro web service")
+
+		writeSchedulerError(w, err)
+
+		return
+	}
+
+	writeDispatcher(w, req.Name)
+}
+
+// pauseDispatcher for keep tasks of dispatcher in queue until resumed
+var pauseDispatcher = func(w http.ResponseWriter, request *http.Request) {
+	setPaused(w, request, true)
+}
+
+// resumeDispatcher for run tasks kept in queue of paused dispatcher
+var resumeDispatcher = func(w http.ResponseWriter, request *http.Request) {
+	setPaused(w, request, false)
+}
+
+// setPaused for pause or resume dispatcher of name in request
+func setPaused(w http.ResponseWriter, request *http.Request, paused bool) {
+	if request.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, errors.New("only support POST"))
+
+		return
+	}
+
+	req, err := readPoolRequest(request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, err)
+
+		return
+	}
+
+	if paused {
+		err = sc.GetScheduler().Pause(req.Name)
+	} else {
+		err = sc.GetScheduler().Resume(req.Name)
+	}
+	if err != nil {
+		writeSchedulerError(w, err)
+
+		return
+	}
+
+	writeDispatcher(w, req.Name)
+}
@@ -0,0 +1,177 @@
+/*
+  Package routers for site resource api, described by docs/openapi.yaml
+*/
+
+package routers
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+
+	hs "siteResService/src/httpservice"
+	tk "siteResService/src/taskservice"
+)
+
+// error codes of api, codes of failed parse are shared with rpc and callbacks
+const (
+	CodeBadRequest			= "bad_request"
+	CodeMethodNotAllowed	= "method_not_allowed"
+	CodeBadURL				= tk.CodeBadURL
+	CodeUnknownField		= tk.CodeUnknownField
+	CodeUnknownDomain		= tk.CodeUnknownDomain
+	CodeRobotsDisallowed	= tk.CodeRobotsDisallowed
+	CodeFetchFailed			= tk.CodeFetchFailed
+	CodeParseIncomplete		= tk.CodeParseIncomplete
+	CodeDeadlineExceeded	= tk.CodeDeadlineExceeded
+	CodeBadPriority			= tk.CodeBadPriority
+	CodeRateLimited			= tk.CodeRateLimited
+	CodeInternal			= tk.CodeInternal
+)
+
+// SiteResourceRequest represents request of site resource, GET uses query params url, fields and force_refresh
+type SiteResourceRequest struct {
+	URL				string		`json:"url"`
+	Fields			[]string	`json:"fields,omitempty"`  // fields selected, all fields if empty
+	Title			string		`json:"title,omitempty"`  // one field selected, kept for old callers
+	ForceRefresh	bool		`json:"force_refresh,omitempty"`  // parse page again even if result is stored
+}
+
+// SiteResourceResponse represents site resource of page url
+type SiteResourceResponse struct {
+	URL				string					`json:"url"`
+	Template		string					`json:"template,omitempty"`  // parser which parsed page
+	TemplateVersion	int						`json:"template_version,omitempty"`
+	Stored			bool					`json:"stored"`  // served by stored parse result
+	Resource		map[string]interface{}	`json:"resource"`  // selected fields
+}
+
+// ErrorResponse represents error of api
+type ErrorResponse struct {
+	Code		string	`json:"code"`
+	Message		string	`json:"message"`
+	Class		string	`json:"class,omitempty"`  // class of fetch failure, only set for fetch_failed
+}
+
+// codeStatus returns http status of error code of failed parse
+func codeStatus(code string) int {
+	switch code {
+	case CodeBadURL, CodeUnknownField, CodeBadPriority:
+		return http.StatusBadRequest
+	case CodeUnknownDomain:
+		return http.StatusNotFound
+	case CodeRobotsDisallowed:
+		return http.StatusForbidden
+	case CodeParseIncomplete:
+		return http.StatusUnprocessableEntity
+	case CodeRateLimited:
+		return http.StatusTooManyRequests
+	case CodeDeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case CodeInternal:
+		return http.StatusInternalServerError
+	}
+
+	return http.StatusBadGateway  // site failed or web driver failed
+}
+
+// errorCode returns http status and error code of error returned by parsing page
+func errorCode(err error) (int, string) {
+	code := tk.ErrorCode(err)
+
+	return codeStatus(code), code
+}
+
+// writeError for write error response with status code
+func writeError(w http.ResponseWriter, status int, code string, err error) {
+	res := &ErrorResponse{Code: code, Message: err.Error()}
+	if code == CodeFetchFailed {
+		res.Class = hs.ErrorClass(err)
+	}
+
+	writeJSON(w, status, res)
+}
+
+// parseSiteResourceRequest returns request of query params or json body
+func parseSiteResourceRequest(request *http.Request) (*SiteResourceRequest, error) {
+	req := new(SiteResourceRequest)
+	if request.Method == http.MethodGet {
+		query := request.URL.Query()
+		req.URL = query.Get("url")
+		if fields := query.Get("fields"); len(fields) > 0 {
+			req.Fields = strings.Split(fields, ",")
+		}
+		req.ForceRefresh, _ = strconv.ParseBool(query.Get("force_refresh"))
+	} else {
+		body, err := ioutil.ReadAll(request.Body)
+		if err != nil {
+			return nil, err
+		}
+		if err := jsoniter.Unmarshal(body, req); err != nil {
+			return nil, errors.New("request body is not a legal json: " + err.Error())
+		}
+	}
+
+	if len(req.Fields) <= 0 && len(req.Title) > 0 {
+		req.Fields = []string{req.Title}
+	}
+	req.Fields = tk.NormalizeFields(req.Fields)
+
+	return req, nil
+}
+
+// getSiteResource for query site resource of page url
+var getSiteResource = func(w http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost && request.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, errors.New("only support GET and POST"))
+
+		return
+	}
+
+	req, err := parseSiteResourceRequest(request)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":	err.Error(),
+		}).Error("can not get params of site resource by micro web service")
+
+		writeError(w, http.StatusBadRequest, CodeBadRequest, err)
+
+		return
+	}
+
+	atomic.AddUint64(instance.subCounter, 1) // count receive num
+
+	// check fields before parsing page
+	if err := tk.CheckResourceFields(req.Fields); err != nil {
+		writeError(w, http.StatusBadRequest, CodeUnknownField, err)
+
+		return
+	}
+
+	pi, stored, err := task.QuerySiteResource(req.URL, req.ForceRefresh)
+	if err != nil {
+		var limited *tk.RateLimitError
+		if errors.As(err, &limited) {
+			w.Header().Set("Retry-After", strconv.Itoa(limited.RetryAfterSeconds()))
+		}
+		status, code := errorCode(err)
+		writeError(w, status, code, err)
+
+		return
+	}
+
+	res, _ := tk.SelectResource(pi, req.Fields)
+	writeJSON(w, http.StatusOK, &SiteResourceResponse{
+		URL:				req.URL,
+		Template:			pi.Template,
+		TemplateVersion:	pi.TemplateVersion,
+		Stored:				stored,
+		Resource:			res,
+	})
+}
@@ -0,0 +1,240 @@
+/*
+  Package http for configure of web driver
+*/
+
+package http
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/astaxie/beego"
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+	"github.com/tebeka/selenium"
+	"github.com/tebeka/selenium/chrome"
+	"github.com/tebeka/selenium/firefox"
+
+	cm "siteResService/src/common"
+)
+
+// browsers supported by web driver
+const (
+	BrowserFirefox	= "firefox"
+	BrowserChrome	= "chrome"
+)
+
+// WebDriverConfig represents configure of web driver in "webdriver" section of app.conf
+type WebDriverConfig struct {
+	URL				string  // remote web driver url, derived from launcher if empty
+	Browser			string  // firefox or chrome
+	Headless		bool
+	UserAgent		string  // empty means default user agent of browser
+	Width			int  // window width, 0 means default size of browser
+	Height			int  // window height
+	Proxy			string  // http://host:port or socks5://host:port, empty means direct
+	Prefs			map[string]interface{}  // browser preferences
+	Launch			string  // local launcher: none, geckodriver or selenium
+	Port			int  // port of local launcher
+	SeleniumPath	string  // path of selenium-server-standalone
+	GeckoDriverPath	string  // path of geckodriver
+	Display			string  // DISPLAY of local launcher, empty means inherit, not needed if headless
+	PoolSize		int  // num of sessions, 1 if launch geckodriver which serves one session at a time
+}
+
+// defaultFirefoxPrefs returns prefs used when "webdriver::prefs" is not set
+func defaultFirefoxPrefs() map[string]interface{} {
+	pre := make(map[string]interface{})
+	pre["browser.tabs.remote.autostart"] = false
+	pre["browser.privatebrowsing.autostart"] = true
+	pre["browser.migrate.chrome.history.maxAgeInDays"] = 0
+	pre["network.cookie.maxNumber"] = 3
+	pre["browser.cache.memory.enable"] = false
+	pre["browser.cache.disk.enable"] = false
+	pre["browser.sessionhistory.max_total_viewers"] = 3
+
+	return pre
+}
+
+// parseWindowSize returns width and height of "1366x768", zero if not set or illegal
+func parseWindowSize(size string) (int, int) {
+	values := strings.Split(strings.ToLower(strings.TrimSpace(size)), "x")
+	if len(values) != 2 {
+		return 0, 0
+	}
+
+	width, errW := strconv.Atoi(values[0])
+	height, errH := strconv.Atoi(values[1])
+	if errW != nil || errH != nil {
+		return 0, 0
+	}
+
+	return width, height
+}
+
+// loadWebDriverConfig returns pointer of WebDriverConfig instance read from app.conf
+func loadWebDriverConfig() *WebDriverConfig {
+	c := new(WebDriverConfig)
+	c.URL = beego.AppConfig.DefaultString("webdriver::url", "")
+	c.Browser = strings.ToLower(beego.AppConfig.DefaultString("webdriver::browser", cm.WebDriverBrowser))
+	c.Headless = beego.AppConfig.DefaultBool("webdriver::headless", cm.WebDriverHeadless)
+	c.UserAgent = beego.AppConfig.DefaultString("webdriver::userAgent", "")
+	c.Width, c.Height = parseWindowSize(beego.AppConfig.DefaultString("webdriver::windowSize", ""))
+	c.Proxy = beego.AppConfig.DefaultString("webdriver::proxy", "")
+	c.Launch = strings.ToLower(beego.AppConfig.DefaultString("webdriver::launch", cm.WebDriverLaunchNone))
+	c.Port = beego.AppConfig.DefaultInt("webdriver::port", cm.SeleniumPort)
+	c.SeleniumPath = beego.AppConfig.DefaultString("webdriver::seleniumPath", cm.SeleniumPath)
+	c.GeckoDriverPath = beego.AppConfig.DefaultString("webdriver::geckoDriverPath", cm.GeckoDriverPath)
+	c.Display = beego.AppConfig.DefaultString("webdriver::display", "")
+
+	if prefs := beego.AppConfig.DefaultString("webdriver::prefs", ""); len(prefs) > 0 {
+		if err := jsoniter.UnmarshalFromString(prefs, &c.Prefs); err != nil {
+			log.WithFields(log.Fields{
+				"prefs":	prefs,
+				"error":	err.Error(),
+			}).Error("can not parse webdriver::prefs, use default prefs")
+		}
+	}
+	if c.Prefs == nil && c.Browser == BrowserFirefox {
+		c.Prefs = defaultFirefoxPrefs()
+	}
+
+	if c.Browser != BrowserFirefox && c.Browser != BrowserChrome {
+		log.WithFields(log.Fields{
+			"browser":	c.Browser,
+		}).Error("unknown webdriver::browser, use firefox")
+		c.Browser = BrowserFirefox
+	}
+
+	c.PoolSize = beego.AppConfig.DefaultInt("webdriver::poolSize", cm.WebDriverPoolSize)
+	if c.PoolSize <= 0 {
+		c.PoolSize = cm.WebDriverPoolSize
+	}
+	if c.Launch == cm.WebDriverLaunchGecko && c.PoolSize > 1 {
+		log.WithFields(log.Fields{
+			"poolSize":	c.PoolSize,
+		}).Error("local geckodriver serves one session at a time, use poolSize 1, launch selenium for more sessions")
+		c.PoolSize = 1
+	}
+
+	if len(c.URL) <= 0 {
+		if c.Launch == cm.WebDriverLaunchGecko {
+			c.URL = fmt.Sprintf("http://localhost:%d", c.Port)  // geckodriver serves at root path
+		} else {
+			c.URL = fmt.Sprintf(cm.SeleniumAddrPattern, c.Port)
+		}
+	}
+
+	return c
+}
+
+// proxy returns proxy of capabilities
+func (c *WebDriverConfig) proxy() (*selenium.Proxy, error) {
+	u, err := url.Parse(c.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	if len(u.Host) <= 0 {
+		return nil, fmt.Errorf("proxy %s do not have host", c.Proxy)
+	}
+
+	p := &selenium.Proxy{Type: selenium.Manual}
+	switch u.Scheme {
+	case "socks5", "socks4":
+		p.SOCKS = u.Host
+		p.SOCKSVersion, _ = strconv.Atoi(strings.TrimPrefix(u.Scheme, "socks"))
+	default:
+		p.HTTP = u.Host
+		p.SSL = u.Host
+	}
+
+	return p, nil
+}
+
+// capabilities returns capabilities of browser
+func (c *WebDriverConfig) capabilities() selenium.Capabilities {
+	caps := selenium.Capabilities{"browserName": c.Browser}
+
+	switch c.Browser {
+	case BrowserChrome:
+		chromeCaps := chrome.Capabilities{Prefs: c.Prefs, W3C: true}
+		if c.Headless {
+			chromeCaps.Args = append(chromeCaps.Args, "--headless", "--disable-gpu")
+		}
+		if len(c.UserAgent) > 0 {
+			chromeCaps.Args = append(chromeCaps.Args, "--user-agent=" + c.UserAgent)
+		}
+		if c.Width > 0 && c.Height > 0 {
+			chromeCaps.Args = append(chromeCaps.Args, fmt.Sprintf("--window-size=%d,%d", c.Width, c.Height))
+		}
+		caps.AddChrome(chromeCaps)
+	default:
+		prefs := make(map[string]interface{})
+		for k, v := range c.Prefs {
+			prefs[k] = v
+		}
+		if len(c.UserAgent) > 0 {
+			prefs["general.useragent.override"] = c.UserAgent
+		}
+		fireCaps := firefox.Capabilities{Prefs: prefs}
+		if c.Headless {
+			fireCaps.Args = append(fireCaps.Args, "-headless")
+		}
+		if c.Width > 0 && c.Height > 0 {
+			fireCaps.Args = append(fireCaps.Args, "-width", strconv.Itoa(c.Width), "-height", strconv.Itoa(c.Height))
+		}
+		caps.AddFirefox(fireCaps)
+	}
+
+	if len(c.Proxy) > 0 {
+		p, err := c.proxy()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"proxy":	c.Proxy,
+				"error":	err.Error(),
+			}).Error("can not parse webdriver::proxy, connect directly")
+		} else {
+			caps.AddProxy(*p)
+		}
+	}
+
+	return caps
+}
+
+// initWebDriver for connect remote web driver and open a browser session
+func initWebDriver(c *WebDriverConfig) (*selenium.WebDriver, error) {
+	wd, err := selenium.NewRemote(c.capabilities(), c.URL)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"url":		c.URL,
+			"browser":	c.Browser,
+			"error":	err.Error(),
+		}).Error("can not get selenium remote instance by initWebDriver")
+
+		return nil, err
+	}
+
+	// set timeout, rendering after load is polled by wait conditions of template
+	timeout := beego.AppConfig.DefaultInt("webdriver::pageLoadTimeout", cm.WebDriverPageLoadTimeout)
+	wd.SetPageLoadTimeout(time.Duration(timeout) * time.Second)
+	wd.SetAsyncScriptTimeout(time.Duration(timeout) * time.Second)
+
+	if c.Width > 0 && c.Height > 0 {
+		if err := wd.ResizeWindow("", c.Width, c.Height); err != nil {
+			log.WithFields(log.Fields{
+				"error":	err.Error(),
+			}).Warn("can not resize window by initWebDriver")
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"url":		c.URL,
+		"browser":	c.Browser,
+		"headless":	c.Headless,
+	}).Info("init web driver success...")
+
+	return &wd, nil
+}
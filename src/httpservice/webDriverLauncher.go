@@ -0,0 +1,210 @@
+/*
+  Package http for launch local web driver server
+*/
+
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	cm "siteResService/src/common"
+)
+
+// WebDriverLauncher represents supervised local geckodriver or selenium-server process
+type WebDriverLauncher struct {
+	conf		*WebDriverConfig
+	lock		sync.Mutex  // serialize start and stop
+	cmd			*exec.Cmd  // running process, nil if not started
+	stopped		bool  // set by Stop, process is not restarted after stopped
+	exited		chan struct{}  // closed when running process exited
+}
+
+// newWebDriverLauncher returns pointer of WebDriverLauncher instance, nil if launcher is not configured
+func newWebDriverLauncher(conf *WebDriverConfig) *WebDriverLauncher {
+	if conf.Launch != cm.WebDriverLaunchGecko && conf.Launch != cm.WebDriverLaunchSelenium {
+		return nil
+	}
+
+	return &WebDriverLauncher{conf: conf}
+}
+
+// command returns command of local web driver server
+func (l *WebDriverLauncher) command() *exec.Cmd {
+	port := strconv.Itoa(l.conf.Port)
+
+	var cmd *exec.Cmd
+	if l.conf.Launch == cm.WebDriverLaunchGecko {
+		cmd = exec.Command(l.conf.GeckoDriverPath, "--port", port)
+	} else {
+		cmd = exec.Command("java", "-Dwebdriver.gecko.driver=" + l.conf.GeckoDriverPath,
+			"-jar", l.conf.SeleniumPath, "-port", port)
+	}
+
+	cmd.Env = os.Environ()
+	if len(l.conf.Display) > 0 {
+		cmd.Env = append(cmd.Env, "DISPLAY=" + l.conf.Display)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd
+}
+
+// addr returns address of local server
+func (l *WebDriverLauncher) addr() string {
+	return net.JoinHostPort("localhost", strconv.Itoa(l.conf.Port))
+}
+
+// waitReady returns nil when port of local server accepts connection and process started is still running,
+// port is checked free before start, so the process answering is the one started
+func (l *WebDriverLauncher) waitReady(exited chan struct{}) error {
+	addr := l.addr()
+	deadline := time.Now().Add(time.Duration(cm.WebDriverLaunchTimeout) * time.Second)
+	for time.Now().Before(deadline) {
+		select {
+		case <-exited:
+			return errors.New("local web driver server exited when starting")
+		default:
+		}
+
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+
+			select {
+			case <-exited:  // failed to listen, port is answered by other process
+				return errors.New("local web driver server exited when starting")
+			default:
+			}
+
+			return nil
+		}
+		time.Sleep(time.Duration(200) * time.Millisecond)
+	}
+
+	return fmt.Errorf("local web driver server is not ready at %s", addr)
+}
+
+// start returns exited chan of started process, must hold lock, caller waits ready after unlock
+func (l *WebDriverLauncher) start() (chan struct{}, error) {
+	if conn, err := net.DialTimeout("tcp", l.addr(), time.Second); err == nil {
+		conn.Close()
+
+		return nil, fmt.Errorf("port of local web driver server %s is used by other process", l.addr())
+	}
+
+	cmd := l.command()
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	exited := make(chan struct{})
+	l.cmd = cmd
+	l.exited = exited
+	go l.supervise(cmd, exited)
+
+	log.WithFields(log.Fields{
+		"launch":	l.conf.Launch,
+		"pid":		cmd.Process.Pid,
+		"port":		l.conf.Port,
+	}).Info("start local web driver server")
+
+	return exited, nil
+}
+
+// supervise for wait process exit and restart it unless stopped
+func (l *WebDriverLauncher) supervise(cmd *exec.Cmd, exited chan struct{}) {
+	err := cmd.Wait()
+	close(exited)
+
+	l.lock.Lock()
+	if l.cmd == cmd {
+		l.cmd = nil
+	}
+	stopped := l.stopped
+	l.lock.Unlock()
+	if stopped {
+		return
+	}
+
+	fields := log.Fields{"launch": l.conf.Launch}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	log.WithFields(fields).Error("local web driver server exited, restart it")
+
+	time.Sleep(time.Duration(cm.WebDriverLaunchRestartDelay) * time.Second)  // not hold lock, Start and Stop are not blocked
+
+	l.lock.Lock()
+	if l.stopped || l.cmd != nil {  // stopped or started by Start when sleeping
+		l.lock.Unlock()
+
+		return
+	}
+	restarted, err := l.start()
+	l.lock.Unlock()
+	if err == nil {
+		err = l.waitReady(restarted)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"launch":	l.conf.Launch,
+			"error":	err.Error(),
+		}).Error("restart local web driver server failed, retry when next session starts")
+	}
+}
+
+// Start for start local server if not running, waits until it accepts connection
+func (l *WebDriverLauncher) Start() error {
+	l.lock.Lock()
+	if l.stopped {
+		l.lock.Unlock()
+
+		return errors.New("local web driver server is stopped")
+	}
+	exited := l.exited
+	if l.cmd == nil {
+		var err error
+		if exited, err = l.start(); err != nil {
+			l.lock.Unlock()
+
+			return err
+		}
+	}
+	l.lock.Unlock()
+
+	return l.waitReady(exited)  // not hold lock, Stop is not blocked
+}
+
+// Stop for kill local server and do not restart it
+func (l *WebDriverLauncher) Stop() {
+	l.lock.Lock()
+	l.stopped = true
+	cmd := l.cmd
+	exited := l.exited
+	l.lock.Unlock()
+
+	if cmd == nil {
+		return
+	}
+
+	if err := cmd.Process.Kill(); err != nil {
+		log.WithFields(log.Fields{
+			"error":	err.Error(),
+		}).Error("kill local web driver server failed")
+
+		return
+	}
+	<-exited
+
+	log.Info("local web driver server stopped")
+}
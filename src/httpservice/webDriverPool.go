@@ -0,0 +1,255 @@
+/*
+  Package http for pool of web driver sessions
+*/
+
+package http
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/astaxie/beego"
+	log "github.com/sirupsen/logrus"
+	"github.com/tebeka/selenium"
+
+	cm "siteResService/src/common"
+)
+
+// webDriverSession represents one browser session of pool, wd is nil until first lease or after quit
+type webDriverSession struct {
+	id			int
+	wd			*selenium.WebDriver
+	startTime	time.Time  // for restart session which has been running too long
+	broken		bool  // set by lease holder, session is restarted before next lease
+}
+
+// WebDriverPool represents bounded pool of web driver sessions, each session is leased by one task at a time
+type WebDriverPool struct {
+	idle				chan *webDriverSession  // sessions not leased
+	sessions			[]*webDriverSession
+	start				func() (*selenium.WebDriver, error)  // open new browser session
+	maxAge				time.Duration  // restart session which has been running longer than this
+	leaseTimeout		time.Duration  // max time waiting for idle session
+	closed				int32  // set when pool closed, must use by atomic !!!
+	LeaseCounter		uint64  // calculation num of lease, must use by atomic !!!
+	LeaseTimeoutCounter	uint64  // calculation num of lease timeout, must use by atomic !!!
+	LeaseWaitNanos		uint64  // total lease wait time, must use by atomic !!!
+	LeaseWaitMaxNanos	uint64  // max lease wait time, must use by atomic !!!
+	RestartCounter		uint64  // calculation num of session restart, must use by atomic !!!
+}
+
+// WebDriverLease represents one leased session, must be released after use
+type WebDriverLease struct {
+	pool		*WebDriverPool
+	session		*webDriverSession
+	released	bool
+}
+
+// ErrWebDriverLeaseTimeout returned when no session become idle in lease timeout
+var ErrWebDriverLeaseTimeout = errors.New("wait for idle web driver session timeout")
+
+// ErrWebDriverPoolClosed returned when lease from closed pool
+var ErrWebDriverPoolClosed = errors.New("web driver pool is closed")
+
+// newWebDriverPool returns pointer of WebDriverPool instance of size sessions, sessions are started lazily when leased
+func newWebDriverPool(start func() (*selenium.WebDriver, error), size int) *WebDriverPool {
+	p := new(WebDriverPool)
+	p.start = start
+	p.maxAge = time.Duration(beego.AppConfig.DefaultInt("webdriver::maxAge", cm.WebDriverMaxAge)) * time.Second
+	p.leaseTimeout = time.Duration(beego.AppConfig.DefaultInt("webdriver::leaseTimeout", cm.WebDriverLeaseTimeout)) * time.Second
+	p.idle = make(chan *webDriverSession, size)
+	for i := 0; i < size; i++ {
+		s := &webDriverSession{id: i}
+		p.sessions = append(p.sessions, s)
+		p.idle <- s
+	}
+
+	return p
+}
+
+// quit for quit browser of session
+func (s *webDriverSession) quit() {
+	if s.wd == nil {
+		return
+	}
+
+	err := (*s.wd).Quit()
+	s.wd = nil
+	if err != nil {
+		log.WithFields(log.Fields{
+			"session":	s.id,
+			"error":	err.Error(),
+		}).Error("quit browser failed by webDriverSession quit")
+	}
+}
+
+// healthy returns true if browser of session still responds
+func (s *webDriverSession) healthy() bool {
+	if _, err := (*s.wd).CurrentURL(); err != nil {
+		log.WithFields(log.Fields{
+			"session":	s.id,
+			"error":	err.Error(),
+		}).Warn("web driver session is not healthy")
+
+		return false
+	}
+
+	return true
+}
+
+// ensure for make session ready to use, restart it if broken, unhealthy or running too long
+func (p *WebDriverPool) ensure(s *webDriverSession) error {
+	if s.wd != nil {
+		// https://blog.csdn.net/weixin_30906425/article/details/98371286
+		restart := s.broken || time.Now().Sub(s.startTime) >= p.maxAge || !s.healthy()
+		if !restart {
+			return nil
+		}
+
+		log.WithFields(log.Fields{
+			"session":	s.id,
+			"broken":	s.broken,
+			"running":	time.Now().Sub(s.startTime).String(),
+		}).Info("restart web driver session")
+		s.quit()
+		atomic.AddUint64(&p.RestartCounter, 1)
+	}
+
+	wd, err := p.start()
+	if err != nil {
+		return err
+	}
+	s.wd = wd
+	s.startTime = time.Now()
+	s.broken = false
+
+	return nil
+}
+
+// recordWait for add lease wait time to metrics
+func (p *WebDriverPool) recordWait(wait time.Duration) {
+	nanos := uint64(wait.Nanoseconds())
+	atomic.AddUint64(&p.LeaseCounter, 1)
+	atomic.AddUint64(&p.LeaseWaitNanos, nanos)
+	for {
+		max := atomic.LoadUint64(&p.LeaseWaitMaxNanos)
+		if nanos <= max || atomic.CompareAndSwapUint64(&p.LeaseWaitMaxNanos, max, nanos) {
+			break
+		}
+	}
+}
+
+// Lease returns pointer of WebDriverLease instance, waits at most lease timeout for idle session
+func (p *WebDriverPool) Lease() (*WebDriverLease, error) {
+	if atomic.LoadInt32(&p.closed) == 1 {
+		return nil, ErrWebDriverPoolClosed
+	}
+
+	start := time.Now()
+	var s *webDriverSession
+	select {
+	case s = <-p.idle:
+	case <-time.After(p.leaseTimeout):
+		atomic.AddUint64(&p.LeaseTimeoutCounter, 1)
+
+		return nil, ErrWebDriverLeaseTimeout
+	}
+	p.recordWait(time.Now().Sub(start))
+
+	if err := p.ensure(s); err != nil {
+		p.idle <- s
+
+		return nil, err
+	}
+
+	return &WebDriverLease{pool: p, session: s}, nil
+}
+
+// Close for quit browsers of all idle sessions, leased sessions are quit when released
+func (p *WebDriverPool) Close() {
+	atomic.StoreInt32(&p.closed, 1)
+
+	var quitted []*webDriverSession
+	for done := false; !done; {
+		select {
+		case s := <-p.idle:
+			s.quit()
+			quitted = append(quitted, s)
+		default:
+			done = true
+		}
+	}
+	for _, s := range quitted {
+		p.idle <- s
+	}
+
+	if leased := len(p.sessions) - len(quitted); leased > 0 {
+		log.WithFields(log.Fields{
+			"leased":	leased,
+		}).Info("web driver sessions still leased, quit when released")
+	}
+}
+
+// Size returns num of sessions in pool
+func (p *WebDriverPool) Size() int {
+	return len(p.sessions)
+}
+
+// Idle returns num of sessions not leased
+func (p *WebDriverPool) Idle() int {
+	return len(p.idle)
+}
+
+// WebDriver returns leased web driver
+func (l *WebDriverLease) WebDriver() *selenium.WebDriver {
+	return l.session.wd
+}
+
+// MarkBroken for restart session before next lease, such as browser stuck or page crashed
+func (l *WebDriverLease) MarkBroken() {
+	l.session.broken = true
+}
+
+// Release for give session back to pool, safe to call more than once
+func (l *WebDriverLease) Release() {
+	if l.released {
+		return
+	}
+	l.released = true
+
+	if atomic.LoadInt32(&l.pool.closed) == 1 {
+		l.session.quit()
+	}
+	l.pool.idle <- l.session
+}
+
+// GetURL returns leased web driver which opened url, error is *FetchError if failed,
+// session is marked broken if failure is not caused by site
+func (l *WebDriverLease) GetURL(url string) (*selenium.WebDriver, error) {
+	// debug
+	last := time.Now()
+
+	if err := (*l.session.wd).Get(url); err != nil {
+		fe := &FetchError{Class: classifyError(err), URL: url, Attempts: 1, Err: err}
+		log.WithFields(log.Fields{
+			"url":		url,
+			"session":	l.session.id,
+			"class":	fe.Class,
+			"error":	err.Error(),
+		}).Error("can not open url by web driver by GetURL")
+		if !fe.SiteDown() {
+			l.MarkBroken()
+		}
+
+		return nil, fe
+	}
+
+	// debug
+	log.WithFields(log.Fields{
+		"session":	l.session.id,
+		"time":		time.Now().Sub(last),
+	}).Debug("test duration, web driver get url by GetURL")
+
+	return l.session.wd, nil
+}
@@ -0,0 +1,145 @@
+/*
+  Package http for poll wait conditions of page opened by web driver
+*/
+
+package http
+
+import (
+	"time"
+
+	"github.com/astaxie/beego"
+	log "github.com/sirupsen/logrus"
+	"github.com/tebeka/selenium"
+
+	cm "siteResService/src/common"
+)
+
+// scripts for check page state
+const (
+	scriptDocumentComplete	= `return document.readyState === "complete";`
+	scriptResourceNum		= `return document.readyState === "complete" ? performance.getEntriesByType("resource").length : -1;`
+)
+
+// documentCompleteCondition returns condition which is true when document loaded
+func documentCompleteCondition() selenium.Condition {
+	return func(wd selenium.WebDriver) (bool, error) {
+		res, err := wd.ExecuteScript(scriptDocumentComplete, nil)
+		if err != nil {
+			return false, err
+		}
+		done, _ := res.(bool)
+
+		return done, nil
+	}
+}
+
+// selectorCondition returns condition which is true when css selector appears
+func selectorCondition(selector string) selenium.Condition {
+	return func(wd selenium.WebDriver) (bool, error) {
+		elements, err := wd.FindElements(selenium.ByCSSSelector, selector)
+		if err != nil {
+			return false, nil  // not found yet
+		}
+
+		return len(elements) > 0, nil
+	}
+}
+
+// networkIdleCondition returns condition which is true when no new resource requested for idle time
+func networkIdleCondition(idle time.Duration) selenium.Condition {
+	last := -1
+	var since time.Time
+	return func(wd selenium.WebDriver) (bool, error) {
+		res, err := wd.ExecuteScript(scriptResourceNum, nil)
+		if err != nil {
+			return false, err
+		}
+
+		num, _ := res.(float64)  // json number
+		if int(num) != last {
+			last = int(num)
+			since = time.Now()
+
+			return false, nil
+		}
+
+		return last >= 0 && time.Now().Sub(since) >= idle, nil
+	}
+}
+
+// scriptCondition returns condition which is true when js expression is true, errors of expression are ignored
+func scriptCondition(expr string) selenium.Condition {
+	return func(wd selenium.WebDriver) (bool, error) {
+		res, err := wd.ExecuteScript("return !!(" + expr + ");", nil)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"script":	expr,
+				"error":	err.Error(),
+			}).Debug("wait script failed by scriptCondition")
+
+			return false, nil
+		}
+		done, _ := res.(bool)
+
+		return done, nil
+	}
+}
+
+// waitConditions returns conditions of wait, document complete is always checked first
+func waitConditions(wait *cm.WaitCondition) []selenium.Condition {
+	conditions := []selenium.Condition{documentCompleteCondition()}
+	if len(wait.Selector) > 0 {
+		conditions = append(conditions, selectorCondition(wait.Selector))
+	}
+	if len(wait.Script) > 0 {
+		conditions = append(conditions, scriptCondition(wait.Script))
+	}
+	if wait.NetworkIdle {
+		idle := beego.AppConfig.DefaultInt("webdriver::networkIdle", cm.WebDriverNetworkIdle)
+		conditions = append(conditions, networkIdleCondition(time.Duration(idle) * time.Millisecond))
+	}
+
+	return conditions
+}
+
+// Wait for poll leased web driver until page satisfies all wait conditions, returns error if max wait passed
+func (l *WebDriverLease) Wait(wait *cm.WaitCondition) error {
+	if wait == nil {
+		return nil
+	}
+
+	maxWait := wait.MaxWait
+	if maxWait <= 0 {
+		maxWait = beego.AppConfig.DefaultInt("webdriver::maxWait", cm.WebDriverMaxWait)
+	}
+	interval := time.Duration(beego.AppConfig.DefaultInt("webdriver::waitInterval", cm.WebDriverWaitInterval)) * time.Millisecond
+
+	start := time.Now()
+	deadline := start.Add(time.Duration(maxWait) * time.Millisecond)
+	wd := *l.session.wd
+	for _, condition := range waitConditions(wait) {
+		timeout := deadline.Sub(time.Now())
+		if timeout <= 0 {
+			timeout = time.Millisecond  // poll once at least
+		}
+
+		if err := wd.WaitWithTimeoutAndInterval(condition, timeout, interval); err != nil {
+			log.WithFields(log.Fields{
+				"session":	l.session.id,
+				"wait":		wait,
+				"time":		time.Now().Sub(start),
+				"error":	err.Error(),
+			}).Warn("page do not satisfy wait conditions by Wait")
+
+			return err
+		}
+	}
+
+	// debug
+	log.WithFields(log.Fields{
+		"session":	l.session.id,
+		"time":		time.Now().Sub(start),
+	}).Debug("page satisfies wait conditions by Wait")
+
+	return nil
+}
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 	"os"
 	"runtime"
@@ -18,11 +19,14 @@ import (
 	cm "siteResService/src/common"
 	hs "siteResService/src/httpservice"
 	rt "siteResService/src/httpservice/routers"
+	mt "siteResService/src/metrics"
 	ms "siteResService/src/microservice"
 	mc "siteResService/src/mysqlclient"
+	qu "siteResService/src/queue"
 	sc "siteResService/src/scheduler"
 	sa "siteResService/src/standalone"
 	tk "siteResService/src/taskservice"
+	st "siteResService/src/taskservice/sites"
 	ut "siteResService/src/util"
 )
 
@@ -35,9 +39,14 @@ type Server struct {
 	scheduler 		*sc.Scheduler
 	http      		*hs.ServiceHTTP
 	delivery  		*ms.ServiceDelivery
+	queue			*qu.Queue  // crawl queue, nil if page urls are kept in memory
 	db   			*mc.MySQLClient
-	subChan			chan string
+	subChan			chan *cm.PageMessage
 	subCounter		uint64  // calculation receive num of subscriber, must use by atomic !!!
+	runType			string
+	quit			chan struct{}  // stop schedule and dispatch
+	scheduled		chan struct{}  // closed when schedule returned
+	dispatched		chan struct{}  // closed when dispatch returned
 }
 
 var initOnce sync.Once
@@ -67,55 +76,172 @@ func initCommonRes() {
 	}(port)
 }
 
-// supervise for supervise receive, delivery, db operation speed, per second
+// supervise for supervise receive, delivery, db operation speed, per second,
+// counters are shared with /metrics so only differences to the last gap are logged, counters are not reset
 func supervise() {
 	tdur := beego.AppConfig.DefaultInt("supervise.gap", cm.SuperviseGap)
+	last := make(map[*uint64]uint64)
+	gap := func(counter *uint64) uint64 {  // increase of counter since last gap
+		n := atomic.LoadUint64(counter)
+		d := n - last[counter]
+		last[counter] = n
+
+		return d
+	}
 	for {
-		subNum := atomic.LoadUint64(&server.subCounter)
-		pubNum := atomic.LoadUint64(&server.micro.DeliverCounter)
-		requestNum := atomic.LoadUint64(&server.http.RequestCounter)
+		subNum := gap(&server.subCounter)
+		pubNum := gap(&server.micro.DeliverCounter)
+		requestNum := gap(&server.http.RequestCounter)
+		retryNum := gap(&server.http.RetryCounter)
+		failNum := gap(&server.http.FailCounter)
+		wdPool := server.http.WebDriverPool()
+		leaseNum := gap(&wdPool.LeaseCounter)
+		leaseWait := gap(&wdPool.LeaseWaitNanos)
+		leaseWaitMax := atomic.LoadUint64(&wdPool.LeaseWaitMaxNanos)
+		leaseTimeoutNum := gap(&wdPool.LeaseTimeoutCounter)
+		restartNum := gap(&wdPool.RestartCounter)
+		politeness := server.task.Politeness()
+		cache := server.http.ResponseCache()
+		storeHitNum := gap(&server.task.StoreHitCounter)
+		storeMissNum := gap(&server.task.StoreMissCounter)
+		hitNum := gap(&cache.HitCounter)
+		revalidateNum := gap(&cache.RevalidateCounter)
+		missNum := gap(&cache.MissCounter)
+		deferNum := gap(&politeness.DeferCounter)
+		denyNum := gap(&politeness.DenyCounter)
+		webhook := server.task.Webhook()
+		sentNum := gap(&webhook.SentCounter)
+		callbackRetryNum := gap(&webhook.RetryCounter)
+		deadNum := gap(&webhook.DeadCounter)
+		expireNum := gap(&server.scheduler.ExpireCounter)
+		intake := qu.GetIntake()
+		waitNum := gap(&intake.WaitCounter)
+		rejectNum := gap(&intake.RejectCounter)
+		spillNum := gap(&intake.SpillCounter)
 		//insertDBNum := atomic.LoadUint64(&server.db.InsertCounter)
 		//updateDBNum := atomic.LoadUint64(&server.db.UpdateCounter)
 
-		// reset counter to 0
-		atomic.StoreUint64(&server.subCounter, 0)
-		atomic.StoreUint64(&server.micro.DeliverCounter, 0)
-		atomic.StoreUint64(&server.http.RequestCounter, 0)
-		//atomic.StoreUint64(&server.db.InsertCounter, 0)
-		//atomic.StoreUint64(&server.db.UpdateCounter, 0)
-
 		log.WithFields(log.Fields{
 			"sub":  	subNum / uint64(tdur),
 			"pub":     	pubNum / uint64(tdur),
 			"request":  requestNum / uint64(tdur),
+			"retry":  	retryNum / uint64(tdur),
+			"fail":  	failNum / uint64(tdur),
 			//"insertDB": insertDBNum / uint64(tdur),
 			//"updateDB": updateDBNum / uint64(tdur),
 			"routine":  runtime.NumGoroutine(),
 		}).Info("running condition (per second)")
 
+		var leaseWaitAvg time.Duration
+		if leaseNum > 0 {
+			leaseWaitAvg = time.Duration(leaseWait / leaseNum)
+		}
+		log.WithFields(log.Fields{
+			"sessions":		wdPool.Size(),
+			"idle":			wdPool.Idle(),
+			"lease":		leaseNum,
+			"leaseTimeout":	leaseTimeoutNum,
+			"waitAvg":		leaseWaitAvg.String(),
+			"waitMax":		time.Duration(leaseWaitMax).String(),  // since started
+			"restart":		restartNum,
+		}).Info("web driver pool condition (per supervise gap)")
+
+		log.WithFields(log.Fields{
+			"defer":		deferNum,
+			"robotsDeny":	denyNum,
+		}).Info("politeness condition (per supervise gap)")
+
+		log.WithFields(log.Fields{
+			"hit":			hitNum,
+			"revalidate":	revalidateNum,
+			"miss":			missNum,
+		}).Info("response cache condition (per supervise gap)")
+
+		log.WithFields(log.Fields{
+			"hit":	storeHitNum,
+			"miss":	storeMissNum,
+		}).Info("parse results store condition (per supervise gap)")
+
+		log.WithFields(log.Fields{
+			"sent":		sentNum,
+			"retry":	callbackRetryNum,
+			"dead":		deadNum,
+		}).Info("webhook condition (per supervise gap)")
+
+		log.WithFields(log.Fields{
+			"depth":	server.scheduler.QueueDepth(),
+			"expire":	expireNum,
+			"total":	server.scheduler.Stats(),  // succeeded, failed, panicked and expired since started
+		}).Info("scheduler condition (per supervise gap)")
+
+		var ready int
+		if server.queue != nil {
+			ready, _ = server.queue.Pending()
+		}
+		log.WithFields(log.Fields{
+			"channel":	len(server.subChan),
+			"ready":	ready,
+			"wait":		waitNum,
+			"reject":	rejectNum,
+			"spill":	spillNum,
+		}).Info("intake condition (per supervise gap)")
+
 		time.Sleep(time.Duration(tdur) * time.Second)
 	}
 }
 
+// startMetrics for collect mysql operations of server, serve /metrics on "metrics::address" if set,
+// and run supervise log loop only if "metrics::supervise" is true
+func startMetrics(server *Server) {
+	mt.RegisterMySQL(server.db)
+
+	if address := beego.AppConfig.DefaultString("metrics::address", cm.MetricsAddress); len(address) > 0 {
+		go mt.Serve(address)
+	}
+
+	if beego.AppConfig.DefaultBool("metrics::supervise", cm.MetricsSupervise) {
+		go supervise()  // supervise speed
+	}
+}
+
+// newServer returns pointer of Server with channels inited
+func newServer(runType string) *Server {
+	s := new(Server)
+
+	atomic.StoreUint64(&s.subCounter, 0) // init counter to 0
+	size := beego.AppConfig.DefaultInt("channelSize", cm.MaxChannelSize)
+	s.subChan = make(chan *cm.PageMessage, size)
+	s.runType = runType
+	s.quit = make(chan struct{})
+	s.scheduled = make(chan struct{})
+	s.dispatched = make(chan struct{})
+
+	return s
+}
+
+// getDB returns mysql client of "mysql::conns", nil if it is empty
+func getDB() *mc.MySQLClient {
+	conns := beego.AppConfig.DefaultString("mysql::conns", cm.DBConns)
+	if len(conns) <= 0 {
+		log.Info("mysql::conns is empty, mysql is not used")
+
+		return nil
+	}
+
+	// must have one register DataBase alias named `default` !!!
+	return mc.GetMySQLClientInstance(conns)
+}
+
 // startMicroServer for start main server
 func startMicroServer() {
 	initOnce.Do(func() {
-		server = new(Server)
-
-		atomic.StoreUint64(&server.subCounter, 0) // init counter to 0
-		size := beego.AppConfig.DefaultInt("channelSize", cm.MaxChannelSize)
-		server.subChan = make(chan string, size)
+		server = newServer(cm.RunTypeMicro)
 		server.scheduler = sc.GetScheduler()
 		server.http = hs.GetHTTPInstance()
-		//conn := cm.GetDBConns("KR")  // get db connection
-		//if len(conn) <= 0 {
-		//	log.Fatal("can not get db connection, exit")
-		//
-		//	return
-		//}
-		//server.db = mc.GetMySQLClientInstance(conn)
+		server.db = getDB()  // nil if mysql is not configured
 		//GetTaskServiceInstance will create micro service instance, should before GetDeliveryServiceInstance
 		server.task = tk.GetTaskInstance(server.db)
+		server.queue = qu.GetQueue()  // should before intake of nsq and source file
 
 		// init micro service
 		server.micro = ms.GetMicroService(rt.GetRouters(server.task, &server.subCounter),
@@ -124,46 +250,88 @@ func startMicroServer() {
 		// debug, for temporary
 		server.standalone = sa.GetStandAloneInstance(server.db, &server.subChan, &server.subCounter)
 
-		go supervise()  // supervise speed
+		startMetrics(server)  // metrics of /metrics
+
+		go waitSignal()  // shutdown gracefully
 
-		go dispatch(server)  // dispatch msg
+		go schedule(server)  // add parse tasks of page messages
+
+		go dispatch(server)  // dispatch parse results
+
+		if server.queue != nil {
+			go pump(server)  // page urls in crawl queue, redelivered ones first
+		}
 
 		go server.micro.RunMicroService()  // go routine run micro service as main process
 
 		server.micro.RunMicroWebService()  // run micro web service
+
+		// block until shutdown exits
+		select {}
 	})
 }
 
-// dispatch for dispatch task
-func dispatch(server *Server) {
+// addParseTask for add task of parse page url to scheduler
+func addParseTask(server *Server, msg *cm.PageMessage) {
+	data := &sc.DataBlock{
+		Extra:   msg,
+		Message: msg.URL,
+	}
+	server.scheduler.AddTask(server.task.ParseTask(data))
+}
+
+// pump for add page messages leased from crawl queue to scheduler, returns when lease stopped
+func pump(server *Server) {
+	for {
+		item, ok := server.queue.Lease()
+		if !ok {
+			return
+		}
+		addParseTask(server, item.Message)
+	}
+}
+
+// schedule for add parse tasks of page messages received to scheduler, returns when server quit,
+// it blocks while tasks of a priority are full, parse results are dispatched by another routine,
+// otherwise parse tasks waiting for ResChan never finish
+func schedule(server *Server) {
+	defer close(server.scheduled)
+
 	for {
 		select {
-		// do task of parse url
+		case <-server.quit:
+			return
 		case msg := <-server.subChan:
-			ctrl := &sc.ControlInfo{
-				Name:    "http",  // must has value
-				CtrlNum: 30,  // the size of concurrent routine pool
-			}
-			data := &sc.DataBlock{
-				Extra:   nil,
-				Message: msg,
-			}
-			server.scheduler.AddTask(sc.Task{
-				CtrlInfo:	ctrl,
-				Data:   	data,
-				DoTask: 	server.task.TaskParseURL,
-			})
+			addParseTask(server, msg)
+		}
+	}
+}
+
+// dispatch for dispatch task of parse results, returns when server quit
+func dispatch(server *Server) {
+	defer close(server.dispatched)
+
+	for {
+		select {
+		case <-server.quit:
+			return
 		// do task of save site resource
 		case msg := <-server.task.ResChan:
 			data := &sc.DataBlock{
 				Extra:   nil,
-				Message: msg,
+				Message: msg.Info,
 			}
 			server.scheduler.AddTask(sc.Task{
 				CtrlInfo:	nil,
 				Data:   	data,
 				DoTask: 	server.standalone.TaskSaveResultToFile,
 			})
+			// publish to topic.pub with id of event
+			server.scheduler.AddTask(sc.Task{
+				CtrlInfo:	nil,
+				Data:   	&sc.DataBlock{Message: msg},
+				DoTask: 	server.micro.TaskPublishResult,
+			})
 		}
 	}
 }
@@ -171,24 +339,19 @@ func dispatch(server *Server) {
 // startStandAloneServer for start main server
 func startStandAloneServer(destSCR string) {
 	initOnce.Do(func() {
-		server = new(Server)
-
-		atomic.StoreUint64(&server.subCounter, 0) // init counter to 0
-		size := beego.AppConfig.DefaultInt("channelSize", cm.MaxChannelSize)
-		server.subChan = make(chan string, size)
+		server = newServer(cm.RunTypeStandAlone)
 		server.scheduler = sc.GetScheduler()
 		server.http = hs.GetHTTPInstance()
-		//conn := cm.GetDBConns("dbWC")  // get db connection
-		//if len(conn) <= 0 {
-		//	log.Fatal("can not get db connection, exit")
-		//
-		//	return
-		//}
-		//// must have one register DataBase alias named `default` !!!
-		//server.db = mc.GetMySQLClientInstance(conn)
+		server.db = getDB()
+		if server.db == nil && destSCR == cm.DestStandAloneDB {
+			log.Fatal("can not get db connection to read page ids, set mysql::conns, exit")
+
+			return
+		}
 
 		// GetStandAloneInstance will use task, GetTaskInstance should before GetStandAloneInstance
 		server.task = tk.GetTaskInstance(server.db)
+		server.queue = qu.GetQueue()  // should before intake of nsq and source file
 
 		// init micro service
 		server.micro = ms.GetMicroService(rt.GetRouters(server.task, &server.subCounter),
@@ -196,7 +359,9 @@ func startStandAloneServer(destSCR string) {
 
 		server.standalone = sa.GetStandAloneInstance(server.db, &server.subChan, &server.subCounter)
 
-		//go supervise() // supervise status
+		startMetrics(server)  // metrics of /metrics
+
+		go waitSignal()  // shutdown gracefully
 
 		// two ways of running
 		if destSCR == cm.DestStandAloneDB {  // for using db to get page id
@@ -206,39 +371,34 @@ func startStandAloneServer(destSCR string) {
 			go server.standalone.GetPageURLFromFile(destSCR)
 		}
 
-		// not use go routine for block main process
-		go dispatchStandAlone(server)
+		go schedule(server)  // add parse tasks of page messages
+
+		go dispatchStandAlone(server)  // dispatch parse results
+
+		if server.queue != nil {
+			go pump(server)  // page urls in crawl queue, redelivered ones first
+		}
 
 		server.micro.RunMicroWebService()
 
-		server.standalone.CloseFileTGT()
+		// block until shutdown exits, files are closed by shutdown
+		select {}
 	})
 }
 
-// dispatchStandAlone for dispatch task
+// dispatchStandAlone for dispatch task of parse results, returns when server quit
 func dispatchStandAlone(server *Server) {
+	defer close(server.dispatched)
+
 	for {
 		select {
-		// do task of parse url
-		case msg := <-server.subChan:
-			ctrl := &sc.ControlInfo{
-				Name:    "http",  // must has value
-				CtrlNum: 30,  // the size of concurrent routine pool
-			}
-			data := &sc.DataBlock{
-				Extra:   nil,
-				Message: msg,
-			}
-			server.scheduler.AddTask(sc.Task{
-				CtrlInfo:	ctrl,
-				Data:   	data,
-				DoTask: 	server.task.TaskParseURL,
-			})
+		case <-server.quit:
+			return
 		// do task of save site resource
 		case msg := <-server.task.ResChan:
 			data := &sc.DataBlock{
 				Extra:   nil,
-				Message: msg,
+				Message: msg.Info,
 			}
 			server.scheduler.AddTask(sc.Task{
 				CtrlInfo:	nil,
@@ -249,10 +409,60 @@ func dispatchStandAlone(server *Server) {
 	}
 }
 
+// convertTemplates for convert positional csv template file to structured json template file
+func convertTemplates() {
+	if len(os.Args) < 4 {
+		fmt.Println("usage: service convert-templates <source csv file> <target json file>")
+		os.Exit(1)
+	}
+
+	if err := st.ConvertTemplateCSV(os.Args[2], os.Args[3]); err != nil {
+		fmt.Printf("convert templates failed, error: %v\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+// validateTemplates for dry run every template against its sample page or saved copy, and print report
+func validateTemplates() {
+	logHook := ut.InitLogrus()
+	if logHook != nil {
+		log.AddHook(logHook)
+	}
+
+	var fixtureDir string  // dir of saved html/json copies, optional
+	if len(os.Args) > 2 {
+		fixtureDir = os.Args[2]
+	}
+
+	reports := tk.ValidateTemplates(st.GetSiteServiceInstance(), fixtureDir)
+	failed := 0
+	for _, r := range reports {
+		status := "OK"
+		if len(r.Error) > 0 || !r.Legal {
+			status = "FAIL"
+			failed++
+		}
+
+		fmt.Printf("[%s] %s v%d (%s) %s\n", status, r.Domain, r.Version, r.Character, r.Source)
+		if len(r.Error) > 0 {
+			fmt.Printf("    error: %s\n", r.Error)
+
+			continue
+		}
+		for _, f := range r.Fields {
+			fmt.Printf("    %-6s matched: %v, fell through: %v\n", f.Field, f.Matched, f.FellThrough)
+		}
+		fmt.Printf("    checkResLegal: %v\n", r.Legal)
+	}
+
+	fmt.Printf("%d templates, %d failed\n", len(reports), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
 // main function
 func main() {
-	initCommonRes()
-
 	//runType := cm.RunTypeStandAlone
 	//if len(os.Args) > 3 {
 	//	log.Error("do not get args for source file, exit")
@@ -280,9 +490,18 @@ func main() {
 
 	switch runType {
 	case cm.RunTypeStandAlone:
+		initCommonRes()
 		startStandAloneServer(destSCR)
 
 	case cm.RunTypeMicro:
+		initCommonRes()
 		startMicroServer()
+
+	// command tools, do not need common resource
+	case cm.RunTypeConvertTemplates:
+		convertTemplates()
+
+	case cm.RunTypeValidateTemplates:
+		validateTemplates()
 	}
 }
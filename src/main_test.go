@@ -0,0 +1,229 @@
+/*
+  Package main for run micro service in one process by memory broker and static registry, no nsq or etcd needed,
+  an event goes through subscriber, dispatch, scheduler, parse and ResChan, and site resource is published back
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/micro/go-micro"
+	"github.com/pborman/uuid"
+	log "github.com/sirupsen/logrus"
+
+	cm "siteResService/src/common"
+	hs "siteResService/src/httpservice"
+	rt "siteResService/src/httpservice/routers"
+	ms "siteResService/src/microservice"
+	pb "siteResService/src/proto"
+	sa "siteResService/src/standalone"
+	sc "siteResService/src/scheduler"
+	tk "siteResService/src/taskservice"
+)
+
+// testConf for configure of memory broker and static registry
+const testConf = "testdata/micro.conf"
+
+// testWait for time to wait for each step
+const testWait = 10 * time.Second
+
+// testPageURL for page url of event, its page is saved as <host>.html in fixture dir
+const testPageURL = "http://micro.example.com/product/1"
+
+// testTemplate for html template of micro.example.com
+const testTemplate = `"micro.example.com","html","",".cover",".title",".price",".desc","","","http://micro.example.com/product/1","normal"` + "\n"
+
+// testPage for saved page of testPageURL
+const testPage = `<html><body>
+<div class="cover"><img src="http://micro.example.com/image/1.jpg"></div>
+<div class="title"><h1>Micro Test</h1></div>
+<div class="price">HK$1.00</div>
+<div class="desc"><p>page parsed through micro service</p></div>
+</body></html>`
+
+// testConfDynamic for configure of paths in temp dir, appended to testConf
+const testConfDynamic = `
+
+
+###### template configure ######
+[template]
+path = %s
+watchGap = 0
+
+
+###### fetcher configure ######
+[fetcher]
+# pages are read from saved files
+fixtureDir = %s
+browser = false
+
+
+###### webhook configure ######
+[webhook]
+secret = test
+`
+
+// resChan for site resources received from topic.pub, as serverTest does
+var resChan = make(chan *pb.SiteResource, 10)
+
+// processResource for subscriber function of site resources
+func processResource(ctx context.Context, res *pb.SiteResource) error {
+	resChan <- res
+
+	return nil
+}
+
+// writeTestFiles for write configure, test template and saved page in dir
+func writeTestFiles(dir string) (string, error) {
+	templatePath := path.Join(dir, "templateResource.csv")
+	fixtureDir := path.Join(dir, "pages")
+	confPath := path.Join(dir, "micro.conf")
+
+	conf, err := ioutil.ReadFile(testConf)
+	if err != nil {
+		return "", err
+	}
+	conf = append(conf, fmt.Sprintf(testConfDynamic, templatePath, fixtureDir)...)
+
+	for _, d := range []string{path.Join(dir, "data"), fixtureDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return "", err
+		}
+	}
+	files := map[string]string{
+		confPath:										string(conf),
+		templatePath:									testTemplate,
+		path.Join(fixtureDir, "micro.example.com.html"):	testPage,
+	}
+	for filePath, content := range files {
+		if err := ioutil.WriteFile(filePath, []byte(content), 0644); err != nil {
+			return "", err
+		}
+	}
+
+	return confPath, nil
+}
+
+// TestMain for load configure and run in temp dir, site files and data of services are written there
+func TestMain(m *testing.M) {
+	log.SetLevel(log.FatalLevel)
+
+	dir, err := ioutil.TempDir("", "siteres")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	confPath, err := writeTestFiles(dir)
+	if err == nil {
+		err = beego.LoadAppConfig("ini", confPath)
+	}
+	if err == nil {
+		err = os.Chdir(dir)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// waitRegistered returns error if micro service is not found in registry before timeout
+func waitRegistered(service micro.Service, name string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		services, err := service.Options().Registry.GetService(name)
+		if err == nil && len(services) > 0 && len(services[0].Nodes) > 0 {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return fmt.Errorf("service %s not registered in %v", name, timeout)
+}
+
+// newTestServer returns pointer of Server with services of micro mode, schedule and dispatch are not started
+func newTestServer(t *testing.T) *Server {
+	s := newServer(cm.RunTypeMicro)
+	s.scheduler = sc.GetScheduler()
+	s.http = hs.GetHTTPInstance()
+	s.task = tk.GetTaskInstance(s.db)
+	s.micro = ms.GetMicroService(rt.GetRouters(s.task, &s.subCounter), s.http, &s.subChan, &s.subCounter)
+	s.standalone = sa.GetStandAloneInstance(s.db, &s.subChan, &s.subCounter)
+	if s.micro.Service() == nil {
+		t.Fatal("micro service not init, check nsq::use.micro")
+	}
+
+	return s
+}
+
+// TestMicroService checks event published to topic.sub is parsed and published back to topic.pub with its id,
+// and rpc Crawler.Crawl is found by registry
+func TestMicroService(t *testing.T) {
+	s := newTestServer(t)
+	service := s.micro.Service()
+
+	pubTopic := beego.AppConfig.DefaultString("nsq::topic.pub", cm.TopicPUBName)
+	s.micro.RegisterSubscriberWithCh(processResource, pubTopic, "queue.page_id")
+
+	go schedule(s)
+	go dispatch(s)
+	defer func() {
+		close(s.quit)
+		<-s.scheduled
+		<-s.dispatched
+	}()
+	go s.micro.RunMicroService()
+
+	name := beego.AppConfig.DefaultString("micro::serviceName", cm.MicroServiceName)
+	if err := waitRegistered(service, name, testWait); err != nil {
+		t.Fatal(err)
+	}
+
+	// client side, publish event to topic.sub
+	subTopic := beego.AppConfig.DefaultString("nsq::topic.sub", cm.TopicSUBName)
+	event := &pb.Event{
+		Id:			uuid.NewUUID().String(),
+		Timestamp:	time.Now().Unix(),
+		Magic:		-1,
+		Message:	testPageURL,
+	}
+	if err := micro.NewPublisher(subTopic, service.Client()).Publish(context.Background(), event); err != nil {
+		t.Fatalf("publish event: %v", err)
+	}
+
+	// server side, receive site resource parsed from saved page
+	select {
+	case res := <-resChan:
+		if res.GetId() != event.Id || res.GetPageUrl() != testPageURL {
+			t.Fatalf("site resource received as %v", res)
+		}
+		if res.GetTitle() != "Micro Test" || len(res.GetCover()) <= 0 {
+			t.Fatalf("site resource is not parsed by template: %v", res)
+		}
+	case <-time.After(testWait):
+		t.Fatalf("site resource not received from %s", pubTopic)
+	}
+
+	// rpc Crawler.Crawl found by registry, bad url fails before fetch
+	ctx, cancel := context.WithTimeout(context.Background(), testWait)
+	defer cancel()
+	result, err := pb.NewCrawlerService(name, service.Client()).Crawl(ctx, &pb.CrawlRequest{Id: "rpc", Url: "not a url"})
+	if err != nil {
+		t.Fatalf("call Crawler.Crawl: %v", err)
+	}
+	if result.GetError().GetCode() != tk.CodeBadURL {
+		t.Fatalf("crawl result of bad url is %v", result)
+	}
+}
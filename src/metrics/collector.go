@@ -0,0 +1,97 @@
+/*
+  Package metrics for collectors of state read at scrape, scheduler dispatchers and mysql operations
+*/
+
+package metrics
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	mc "siteResService/src/mysqlclient"
+	sc "siteResService/src/scheduler"
+)
+
+// schedulerCollector represents collector of dispatchers of scheduler
+type schedulerCollector struct {
+	depth		*prometheus.Desc
+	active		*prometheus.Desc
+	pending		*prometheus.Desc
+	size		*prometheus.Desc
+	tasks		*prometheus.Desc
+}
+
+// newSchedulerCollector returns pointer of schedulerCollector instance
+func newSchedulerCollector() *schedulerCollector {
+	return &schedulerCollector{
+		depth:		prometheus.NewDesc(namespace + "_scheduler_queue_depth",
+			"Tasks waiting in dispatcher by priority.", []string{"dispatcher", "priority"}, nil),
+		active:		prometheus.NewDesc(namespace + "_scheduler_active",
+			"Tasks running in dispatcher.", []string{"dispatcher"}, nil),
+		pending:	prometheus.NewDesc(namespace + "_scheduler_pending",
+			"Tasks added to dispatcher but not done.", []string{"dispatcher"}, nil),
+		size:		prometheus.NewDesc(namespace + "_scheduler_pool_size",
+			"Max tasks running at the same time of each dispatcher.", []string{"dispatcher"}, nil),
+		tasks:		prometheus.NewDesc(namespace + "_scheduler_tasks_total",
+			"Tasks done by dispatcher and result (succeeded, failed, panicked or expired).", []string{"dispatcher", "result"}, nil),
+	}
+}
+
+// Describe for send descriptions of scheduler metrics
+func (c *schedulerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.depth
+	ch <- c.active
+	ch <- c.pending
+	ch <- c.size
+	ch <- c.tasks
+}
+
+// Collect for send scheduler metrics read from dispatchers
+func (c *schedulerCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, info := range sc.GetScheduler().Dispatchers() {
+		for priority, num := range info.Depth {
+			ch <- prometheus.MustNewConstMetric(c.depth, prometheus.GaugeValue, float64(num), info.Name, strconv.Itoa(priority))
+		}
+		ch <- prometheus.MustNewConstMetric(c.active, prometheus.GaugeValue, float64(info.Active), info.Name)
+		ch <- prometheus.MustNewConstMetric(c.pending, prometheus.GaugeValue, float64(info.Pending), info.Name)
+		ch <- prometheus.MustNewConstMetric(c.size, prometheus.GaugeValue, float64(info.Size), info.Name)
+		ch <- prometheus.MustNewConstMetric(c.tasks, prometheus.CounterValue, float64(info.Stats.Succeeded), info.Name, "succeeded")
+		ch <- prometheus.MustNewConstMetric(c.tasks, prometheus.CounterValue, float64(info.Stats.Failed), info.Name, "failed")
+		ch <- prometheus.MustNewConstMetric(c.tasks, prometheus.CounterValue, float64(info.Stats.Panicked), info.Name, "panicked")
+		ch <- prometheus.MustNewConstMetric(c.tasks, prometheus.CounterValue, float64(info.Stats.Expired), info.Name, "expired")
+	}
+}
+
+// mysqlCollector represents collector of operation counters of MySQLClient, counters must not be reset
+type mysqlCollector struct {
+	db		*mc.MySQLClient
+	ops		*prometheus.Desc
+}
+
+// Describe for send description of mysql metrics
+func (c *mysqlCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.ops
+}
+
+// Collect for send mysql operations read from counters
+func (c *mysqlCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.ops, prometheus.CounterValue, float64(atomic.LoadUint64(&c.db.InsertCounter)), "insert")
+	ch <- prometheus.MustNewConstMetric(c.ops, prometheus.CounterValue, float64(atomic.LoadUint64(&c.db.UpdateCounter)), "update")
+	ch <- prometheus.MustNewConstMetric(c.ops, prometheus.CounterValue, float64(atomic.LoadUint64(&c.db.QueryCounter)), "query")
+	ch <- prometheus.MustNewConstMetric(c.ops, prometheus.CounterValue, float64(atomic.LoadUint64(&c.db.DeleteCounter)), "delete")
+}
+
+// RegisterMySQL for collect operations of mysql client, do nothing if db is nil
+func RegisterMySQL(db *mc.MySQLClient) {
+	if db == nil {
+		return
+	}
+
+	prometheus.MustRegister(&mysqlCollector{
+		db:		db,
+		ops:	prometheus.NewDesc(namespace + "_mysql_operations_total",
+			"Mysql operations by op (insert, update, query or delete).", []string{"op"}, nil),
+	})
+}
@@ -0,0 +1,184 @@
+/*
+  Package metrics for prometheus metrics of fetch, parse, scheduler, nsq and mysql, scraped from /metrics
+*/
+
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+
+	cm "siteResService/src/common"
+)
+
+// namespace for prefix of all metric names
+const namespace = "siteres"
+
+// status of fetch and result of parse field
+const (
+	StatusOK		= "ok"
+	StatusError		= "error"  // error of unknown class
+	FieldOK			= "ok"
+	FieldMissing	= "missing"
+)
+
+// directions of nsq messages
+const (
+	DirectionIn		= "in"
+	DirectionOut	= "out"
+)
+
+var (
+	// fetchTotal for pages fetched by domain, method (http, json, web) and status (ok or class of fetch error)
+	fetchTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:	namespace,
+		Name:		"fetch_total",
+		Help:		"Pages fetched by domain, method and status.",
+	}, []string{"domain", "method", "status"})
+
+	// fetchDuration for seconds of fetch by method
+	fetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:	namespace,
+		Name:		"fetch_duration_seconds",
+		Help:		"Seconds of fetching a page by method.",
+		Buckets:	[]float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"method"})
+
+	// parseFieldTotal for fields parsed or missing of parse results
+	parseFieldTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:	namespace,
+		Name:		"parse_field_total",
+		Help:		"Fields of parse results by field and result (ok or missing).",
+	}, []string{"field", "result"})
+
+	// parseTotal for page urls parsed by result, ok or error code
+	parseTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:	namespace,
+		Name:		"parse_total",
+		Help:		"Page urls parsed by result, ok or error code.",
+	}, []string{"result"})
+
+	// fallthroughTotal for pages of http or json template which are fetched again by web driver
+	fallthroughTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:	namespace,
+		Name:		"template_fallthrough_total",
+		Help:		"Pages falling through http or json template to web driver by domain and method.",
+	}, []string{"domain", "method"})
+
+	// nsqTotal for nsq messages received and published by topic
+	nsqTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:	namespace,
+		Name:		"nsq_messages_total",
+		Help:		"Nsq messages by direction (in or out) and topic.",
+	}, []string{"direction", "topic"})
+)
+
+func init() {
+	prometheus.MustRegister(fetchTotal, fetchDuration, parseFieldTotal, parseTotal, fallthroughTotal, nsqTotal)
+	prometheus.MustRegister(newSchedulerCollector())
+}
+
+// method returns method label of template character, html pages are fetched by http
+func method(character string) string {
+	if character == cm.HTMLFormat {
+		return "http"
+	}
+
+	return character
+}
+
+// DomainOther for domain label of pages without template, so labels are bounded by templates
+const DomainOther = "other"
+
+// domain returns domain label of template, DomainOther if labels is nil
+func domain(labels *cm.LabelsParse) string {
+	if labels == nil || len(labels.Domain) <= 0 {
+		return DomainOther
+	}
+
+	return labels.Domain
+}
+
+// ObserveFetch for count fetch of page by domain of template labels and character, labels is nil if no template,
+// class is class of fetch error, empty if unknown
+func ObserveFetch(labels *cm.LabelsParse, character string, err error, class string, elapsed time.Duration) {
+	status := StatusOK
+	if err != nil {
+		status = class
+		if len(status) <= 0 {
+			status = StatusError
+		}
+	}
+
+	fetchTotal.WithLabelValues(domain(labels), method(character), status).Inc()
+	fetchDuration.WithLabelValues(method(character)).Observe(elapsed.Seconds())
+}
+
+// ObserveFields for count fields parsed or missing of parse result, all fields are missing if pi is nil
+func ObserveFields(pi *cm.ProInfo) {
+	if pi == nil {
+		pi = new(cm.ProInfo)
+	}
+
+	fields := map[string]bool{
+		"cover":	len(pi.Cover) > 0,
+		"title":	len(pi.Title) > 0,
+		"price":	len(pi.Price) > 0,
+		"currency":	len(pi.Currency) > 0,
+		"desc":		len(pi.Desc) > 0,
+		"spec":		len(pi.Spec) > 0,
+		"good":		len(pi.Good) > 0,
+	}
+	for field, ok := range fields {
+		result := FieldMissing
+		if ok {
+			result = FieldOK
+		}
+		parseFieldTotal.WithLabelValues(field, result).Inc()
+	}
+}
+
+// ObserveParse for count page url parsed, code is error code, empty if parsed
+func ObserveParse(code string) {
+	if len(code) <= 0 {
+		code = StatusOK
+	}
+
+	parseTotal.WithLabelValues(code).Inc()
+}
+
+// ObserveFallthrough for count page of template labels fetched again by web driver
+func ObserveFallthrough(labels *cm.LabelsParse) {
+	fallthroughTotal.WithLabelValues(domain(labels), method(labels.Character)).Inc()
+}
+
+// ObserveNSQ for count nsq message of topic by direction
+func ObserveNSQ(direction string, topic string) {
+	nsqTotal.WithLabelValues(direction, topic).Inc()
+}
+
+// Handler returns http handler of /metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Serve for serve /metrics on address, returns when listener failed
+func Serve(address string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+
+	log.WithFields(log.Fields{
+		"address":	address,
+	}).Info("serve prometheus metrics")
+
+	if err := http.ListenAndServe(address, mux); err != nil {
+		log.WithFields(log.Fields{
+			"address":	address,
+			"error":	err.Error(),
+		}).Error("serve prometheus metrics failed")
+	}
+}
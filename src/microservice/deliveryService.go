@@ -5,17 +5,21 @@
 package microservice
 
 import (
+	"fmt"
 	"time"
 	"context"
-	"strconv"
 	"sync/atomic"
 	"runtime/debug"
 
+	"github.com/astaxie/beego"
 	"github.com/micro/go-micro"
+	"github.com/micro/go-micro/broker"
 	"github.com/micro/go-micro/server"
+	"github.com/micro/go-plugins/broker/nsq"
 	log "github.com/sirupsen/logrus"
 
 	cm "siteResService/src/common"
+	mt "siteResService/src/metrics"
 	pb "siteResService/src/proto"
 	sc "siteResService/src/scheduler"
 	ut "siteResService/src/util"
@@ -62,34 +66,106 @@ func generateEvent(magic int64, msg string) *pb.Event {
 	}
 }
 
-// SendMsgWithTopic send message to specified topic by publisher.
-func (m *MicroService) SendMsgWithTopic(topic string, magic int64, msg string) {
+// generateSiteResource return pointer of pb.SiteResource converted from parse result
+func generateSiteResource(res *cm.ParseResult) *pb.SiteResource {
+	pi := res.Info
+	sr := &pb.SiteResource{
+		Id:					res.ID,
+		Timestamp:			time.Now().Unix(),
+		PageUrl:			pi.PageURL,
+		Cover:				pi.Cover,
+		Title:				pi.Title,
+		Price:				pi.Price,
+		Currency:			pi.Currency,
+		Desc:				pi.Desc,
+		Template:			pi.Template,
+		TemplateVersion:	int32(pi.TemplateVersion),
+	}
+	for _, spec := range pi.Spec {
+		sr.Spec = append(sr.Spec, &pb.ResourceRow{Cells: spec})
+	}
+	for _, good := range pi.Good {
+		sr.Good = append(sr.Good, &pb.ResourceRow{Cells: good})
+	}
+
+	return sr
+}
+
+// publish message to specified topic by publisher, retry until success
+func (m *MicroService) publish(topic string, msg interface{}) {
+	m.publishContext(context.Background(), topic, msg)
+}
+
+// publishContext returns error of ctx if message is not published to specified topic before ctx done, retry until then
+func (m *MicroService) publishContext(ctx context.Context, topic string, msg interface{}) error {
 	publisher := m.getPublisher(topic)
-	if publisher != nil {
-		for { // continue to retry publish message until success
-			ev := generateEvent(magic, msg)
-			if err := (*publisher).Publish(context.Background(), ev); err != nil {
-				time.Sleep(time.Duration(5) * time.Second) // if publish failed, wait for 5s, to retry
-
-				log.WithFields(log.Fields{
-					"topic":      topic,
-					"event":      ev,
-					"error info": err.Error(),
-				}).Error("publish event to topic failed, wait for 5s to retry...")
-			} else {
-				atomic.AddUint64(&m.DeliverCounter, 1) // count deliver num
-
-				// only for debug
-				log.WithFields(log.Fields{
-					"event": ev,
-				}).Debug("publish event")
-
-				break // if publish success, break for
-			}
+	if publisher == nil {
+		return nil
+	}
+
+	for { // continue to retry publish message until success
+		err := (*publisher).Publish(ctx, msg)
+		if err == nil {
+			atomic.AddUint64(&m.DeliverCounter, 1) // count deliver num
+			mt.ObserveNSQ(mt.DirectionOut, topic)
+
+			// only for debug
+			log.WithFields(log.Fields{
+				"event": msg,
+			}).Debug("publish event")
+
+			return nil  // if publish success, break for
+		}
+
+		log.WithFields(log.Fields{
+			"topic":      topic,
+			"event":      msg,
+			"error info": err.Error(),
+		}).Error("publish event to topic failed, wait for 5s to retry...")
+
+		select {
+		case <-ctx.Done():  // do not retry after deadline of shutdown
+			return ctx.Err()
+		case <-time.After(time.Duration(5) * time.Second): // if publish failed, wait for 5s, to retry
 		}
 	}
 }
 
+// SendMsgWithTopic send message to specified topic by publisher.
+func (m *MicroService) SendMsgWithTopic(topic string, magic int64, msg string) {
+	m.publish(topic, generateEvent(magic, msg))
+}
+
+// PublishResult send site resource of parse result to specified topic by publisher, id of event is kept
+func (m *MicroService) PublishResult(topic string, res *cm.ParseResult) {
+	m.publish(topic, generateSiteResource(res))
+}
+
+// TaskPublishResult publish parse result in scheduler DataBlock to "nsq::topic.pub", do nothing if micro service not init,
+// returns nil as publish retries until success
+func (m *MicroService) TaskPublishResult(data *sc.DataBlock) error {
+	if m.microService == nil {
+		return nil
+	}
+
+	topic := beego.AppConfig.DefaultString("nsq::topic.pub", cm.TopicPUBName)
+	m.PublishResult(topic, data.Message.(*cm.ParseResult))
+
+	return nil
+}
+
+// PublishResultContext returns error if site resource of parse result is not published to "nsq::topic.pub" before ctx done,
+// nil if micro service not init
+func (m *MicroService) PublishResultContext(ctx context.Context, res *cm.ParseResult) error {
+	if m.microService == nil {
+		return nil
+	}
+
+	topic := beego.AppConfig.DefaultString("nsq::topic.pub", cm.TopicPUBName)
+
+	return m.publishContext(ctx, topic, generateSiteResource(res))
+}
+
 // TaskSend send message using scheduler DataBlock.
 func (m *MicroService) TaskSend(data *sc.DataBlock) {
 	defer func() { // add recover to catch panic
@@ -102,7 +178,7 @@ func (m *MicroService) TaskSend(data *sc.DataBlock) {
 	}()
 
 	pubInfo := data.Extra.(cm.PubInfo) //transfer to cm.PubInfo type for get topic and magic
-	m.SendMsgWithTopic(pubInfo.Topic, pubInfo.Magic, strconv.Itoa(data.Message.(int)))
+	m.SendMsgWithTopic(pubInfo.Topic, pubInfo.Magic, fmt.Sprint(data.Message))
 }
 
 // RegisterSubscriber return false if register subscriber receive process function to specified topic failed.
@@ -136,6 +212,17 @@ func (m *MicroService) RegisterSubscriber(function interface{}, topic string) bo
 	return true
 }
 
+// maxInFlight returns intake::maxInFlight, or num of messages scheduler takes at once if not set,
+// pages parsing in control pool and waiting in channel
+func maxInFlight() int {
+	if num := beego.AppConfig.DefaultInt("intake::maxInFlight", cm.IntakeMaxInFlight); num > 0 {
+		return num
+	}
+
+	return sc.GetScheduler().PoolSize(cm.HTTPCtrlName, cm.HTTPCtrlNum) +
+		beego.AppConfig.DefaultInt("channelSize", cm.MaxChannelSize)
+}
+
 // RegisterSubscriberWithCh return false if register subscriber receive process function to specified topic and channel failed.
 func (m *MicroService) RegisterSubscriberWithCh(function interface{}, topic string, channel string) bool {
 	if function == nil {
@@ -149,8 +236,13 @@ func (m *MicroService) RegisterSubscriberWithCh(function interface{}, topic stri
 		return false
 	}
 
-	// register subscriber with queue, each message is delivered to a unique subscriber
-	err := micro.RegisterSubscriber(topic, (*m.microService).Server(), function, server.SubscriberQueue(channel)) // specified a channel name
+	// register subscriber with queue, each message is delivered to a unique subscriber,
+	// nsq delivers at most maxInFlight messages not finished, so messages do not time out waiting for intake
+	inFlight := maxInFlight()
+	opts := broker.SubscribeOptions{Context: context.Background()}
+	nsq.WithMaxInFlight(inFlight)(&opts)
+	err := micro.RegisterSubscriber(topic, (*m.microService).Server(), function,
+		server.SubscriberQueue(channel), server.SubscriberContext(opts.Context)) // specified a channel name
 	if err != nil {
 		log.WithFields(log.Fields{
 			"topic":      topic,
@@ -162,8 +254,9 @@ func (m *MicroService) RegisterSubscriberWithCh(function interface{}, topic stri
 	}
 
 	log.WithFields(log.Fields{
-		"topic":   topic,
-		"channel": channel,
+		"topic":   		topic,
+		"channel": 		channel,
+		"maxInFlight":	inFlight,
 	}).Info("register subscriber receive process function to specified topic and channel success...")
 
 	return true
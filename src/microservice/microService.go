@@ -6,22 +6,25 @@ package microservice
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/astaxie/beego"
 	"github.com/micro/go-micro"
-	"github.com/micro/go-micro/broker"
 	"github.com/micro/go-micro/registry"
-	"github.com/micro/go-micro/registry/etcd"
 	"github.com/micro/go-micro/web"
-	"github.com/micro/go-plugins/broker/nsq"
 	log "github.com/sirupsen/logrus"
 
 	cm "siteResService/src/common"
 	hs "siteResService/src/httpservice"
 	rt "siteResService/src/httpservice/routers"
+	mt "siteResService/src/metrics"
 	pb "siteResService/src/proto"
+	qu "siteResService/src/queue"
+	sc "siteResService/src/scheduler"
+	tk "siteResService/src/taskservice"
 )
 
 var instance *MicroService
@@ -34,13 +37,21 @@ type MicroService struct {
 	webService		*web.Service
 	httpService		*hs.ServiceHTTP
 	pubSMap        	sync.Map       // store publisher map, publisher associated with topic
-	subChan			*chan string
+	subChan			*chan *cm.PageMessage
 	subCounter		*uint64
+	microCancel		context.CancelFunc  // stop micro service
+	webCancel		context.CancelFunc  // stop micro web service
+	microRunning	int32  // micro service is running, must use by atomic !!!
+	microDone		chan struct{}  // closed when micro service stopped
+	stopping		int32  // messages and rpc calls are refused, must use by atomic !!!
 	DeliverCounter 	uint64         // calculation num of delivery by publisher, must use by atomic !!!
 }
 
+// ErrStopping returned to broker and rpc client after intake stopped, nsq requeues messages refused
+var ErrStopping = errors.New("service is stopping")
+
 // GetMicroService return pointer of MicroService instance
-func GetMicroService(router *rt.Router, http *hs.ServiceHTTP, subChan *chan string, subCounter *uint64) *MicroService {
+func GetMicroService(router *rt.Router, http *hs.ServiceHTTP, subChan *chan *cm.PageMessage, subCounter *uint64) *MicroService {
 	initMicroOnce.Do(func() {
 		instance = new(MicroService)
 
@@ -48,21 +59,30 @@ func GetMicroService(router *rt.Router, http *hs.ServiceHTTP, subChan *chan stri
 		instance.httpService = http
 		instance.subChan = subChan
 		instance.subCounter = subCounter
+		instance.microDone = make(chan struct{})
+
+		// micro and web service share one registry
+		reg := NewRegistry()
 
 		// useMicro for init micro service
 		useMicro := beego.AppConfig.DefaultBool("nsq::use.micro", cm.UseMicro)
 		if useMicro {
-			instance.microService = initMicro()
+			instance.microService = initMicro(reg)
 
 			// register process function to subscriber, should after init micro
 			topic := beego.AppConfig.DefaultString("nsq::topic.sub", cm.TopicSUBName)
 			channel := beego.AppConfig.DefaultString("nsq::queue", cm.ChannelName)
 			instance.RegisterSubscriberWithCh(process, topic, channel)
+
+			// crawl requests of protobuf contract, subscribed from their own topic and served by rpc
+			crawlTopic := beego.AppConfig.DefaultString("nsq::topic.crawl", cm.TopicCrawlName)
+			instance.RegisterSubscriberWithCh(processCrawl, crawlTopic, channel)
+			instance.RegisterCrawler(tk.GetTaskInstance())
 		}
 		// useWeb for init web service
 		useWeb := beego.AppConfig.DefaultBool("nsq::use.web", cm.UseWeb)
 		if useWeb {
-			instance.webService = initMicroWeb()
+			instance.webService = initMicroWeb(reg)
 		}
 	})
 
@@ -70,7 +90,11 @@ func GetMicroService(router *rt.Router, http *hs.ServiceHTTP, subChan *chan stri
 }
 
 // initMicroWeb return pointer of micro web service
-func initMicroWeb() *web.Service {
+func initMicroWeb(reg registry.Registry) *web.Service {
+	// stopped by StopIntake instead of signal
+	ctx, cancel := context.WithCancel(context.Background())
+	instance.webCancel = cancel
+
 	// specified web service host
 	ip := beego.AppConfig.DefaultString("micro::web.ip", cm.MicroWebAddress)
 	port := beego.AppConfig.DefaultString("micro::web.port", cm.MicroWebPort)
@@ -80,6 +104,9 @@ func initMicroWeb() *web.Service {
 	service := web.NewService(
 		web.Name(name),
 		web.Address(webHost),
+		web.Registry(reg),
+		web.Context(ctx),
+		web.HandleSignal(false),
 	)
 
 	// add all routes
@@ -111,31 +138,21 @@ func (m *MicroService) RunMicroWebService() {
 	log.Info("exit micro web service success...")
 }
 
-// initMicro return pointer of micro service
-func initMicro() *micro.Service {
-	ip := beego.AppConfig.DefaultString("nsq::ip", cm.BrokerAddress)
-	port := beego.AppConfig.DefaultString("nsq::port", cm.BrokerPort)
-	var BrokerHosts = []string{ // specified nsq service host
-		0: ip + ":" + port,
-	}
-
-	ip = beego.AppConfig.DefaultString("etcd::ip", cm.RegistryAddress)
-	port = beego.AppConfig.DefaultString("etcd::port", cm.RegistryPort)
-	var RegistryHosts = []string{ // specified etcd service host
-		0: ip + ":" + port,
-	}
+// initMicro return pointer of micro service, broker is chosen by configure
+func initMicro(reg registry.Registry) *micro.Service {
+	// stopped by Stop instead of signal, broker keeps connected for results published while draining
+	ctx, cancel := context.WithCancel(context.Background())
+	instance.microCancel = cancel
 
 	name := beego.AppConfig.DefaultString("micro::serviceName", cm.MicroServiceName)
 	service := micro.NewService(
 		// This name must match the package name given in your protobuf definition
 		micro.Name(name),
 		micro.Version("0.1"),
-		micro.Broker(nsq.NewBroker(func(o *broker.Options) { // specified using nsq broker
-			o.Addrs = BrokerHosts
-		})),
-		micro.Registry(etcd.NewRegistry(func(o *registry.Options) { // specified using etcd registry
-			o.Addrs = RegistryHosts
-		})),
+		micro.Broker(NewBroker()),
+		micro.Registry(reg),
+		micro.Context(ctx),
+		micro.HandleSignal(false),
 	)
 
 	// Init will parse the command line flags.
@@ -144,6 +161,15 @@ func initMicro() *micro.Service {
 	return &service
 }
 
+// Service returns micro service, nil if not init
+func (m *MicroService) Service() micro.Service {
+	if m.microService == nil {
+		return nil
+	}
+
+	return *m.microService
+}
+
 // RunMicroService for run micro service
 func (m *MicroService) RunMicroService() {
 	if m.microService == nil {
@@ -152,6 +178,9 @@ func (m *MicroService) RunMicroService() {
 		return
 	}
 
+	atomic.StoreInt32(&m.microRunning, 1)
+	defer close(m.microDone)
+
 	log.Info("start micro service success...")
 
 	// Run the server
@@ -161,17 +190,141 @@ func (m *MicroService) RunMicroService() {
 		}).Fatal("micro service failed to run")
 	}
 
-	m.httpService.QuitWebDriver()
+	log.Info("exit micro service success...")
+}
+
+// StopIntake for refuse messages and rpc calls, and stop micro web service, results can still be published
+func (m *MicroService) StopIntake() {
+	atomic.StoreInt32(&m.stopping, 1)
+	if m.webCancel != nil {
+		m.webCancel()
+	}
 
-	log.Info("exit task service success...")
+	log.Info("stop intake of micro service")
 }
 
-// process for subscriber function
+// Stopping returns true if intake stopped
+func (m *MicroService) Stopping() bool {
+	return atomic.LoadInt32(&m.stopping) == 1
+}
+
+// Stop returns false if micro service is not stopped in timeout, it deregisters service and disconnects broker
+func (m *MicroService) Stop(timeout time.Duration) bool {
+	m.StopIntake()
+	if m.microCancel == nil || atomic.LoadInt32(&m.microRunning) == 0 {
+		return true
+	}
+	m.microCancel()
+
+	select {
+	case <-m.microDone:
+		return true
+	case <-time.After(timeout):
+		log.Error("micro service is not stopped in time")
+
+		return false
+	}
+}
+
+// crawlHandler represents handler of rpc service Crawler
+type crawlHandler struct {
+	task	*tk.TaskService
+}
+
+// Crawl for rpc Crawler.Crawl, page is parsed at once unless stored
+func (h *crawlHandler) Crawl(ctx context.Context, req *pb.CrawlRequest, res *pb.CrawlResult) error {
+	if instance.Stopping() {
+		return ErrStopping
+	}
+
+	atomic.AddUint64(instance.subCounter, 1) // count receive num
+
+	*res = *h.task.Crawl(req)
+
+	return nil
+}
+
+// RegisterCrawler returns false if register rpc service Crawler failed
+func (m *MicroService) RegisterCrawler(task *tk.TaskService) bool {
+	if err := pb.RegisterCrawlerHandler((*m.microService).Server(), &crawlHandler{task: task}); err != nil {
+		log.WithFields(log.Fields{
+			"error info": err.Error(),
+		}).Error("register rpc service Crawler failed !")
+
+		return false
+	}
+
+	log.Info("register rpc service Crawler success...")
+
+	return true
+}
+
+// processCrawl for subscriber function of crawl requests
+func processCrawl(ctx context.Context, req *pb.CrawlRequest) error {
+	if instance.Stopping() {
+		return ErrStopping
+	}
+
+	if req != nil {
+		msg := tk.NewPageMessage(req)
+		err := sc.CheckPriority(msg.Priority)
+		if err == nil {
+			err = tk.CheckPageURL(msg.URL)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"id":		msg.ID,
+				"pageURL":	msg.URL,
+				"error":	err.Error(),
+			}).Error("drop crawl request by processCrawl")
+			tk.GetTaskInstance().Webhook().SendEvent(msg, nil, err)
+
+			return nil  // requeued request would fail again
+		}
+		if err := qu.Push(*instance.subChan, msg, "", 0); err != nil {
+			return err  // nsq requeues it
+		}
+
+		atomic.AddUint64(instance.subCounter, 1) // count receive num
+		mt.ObserveNSQ(mt.DirectionIn, beego.AppConfig.DefaultString("nsq::topic.crawl", cm.TopicCrawlName))
+	}
+
+	// only for debug
+	log.WithFields(log.Fields{
+		"request": req,
+	}).Debug("subscriber crawl request")
+
+	return nil
+}
+
+// process for subscriber function of legacy events, message is page url
 func process(ctx context.Context, event *pb.Event) error {
+	if instance.Stopping() {
+		return ErrStopping
+	}
+
 	if event != nil {
-		*instance.subChan <- event.GetMessage()
+		msg := &cm.PageMessage{
+			ID:			event.GetId(),
+			URL:		event.GetMessage(),
+			Callback:	event.GetCallback(),
+		}
+		if err := tk.CheckPageURL(msg.URL); err != nil {
+			log.WithFields(log.Fields{
+				"id":		msg.ID,
+				"pageURL":	msg.URL,
+				"error":	err.Error(),
+			}).Error("drop event by process")
+			tk.GetTaskInstance().Webhook().SendEvent(msg, nil, err)
+
+			return nil  // requeued event would fail again
+		}
+		if err := qu.Push(*instance.subChan, msg, "", 0); err != nil {
+			return err  // nsq requeues it
+		}
 
 		atomic.AddUint64(instance.subCounter, 1) // count receive num
+		mt.ObserveNSQ(mt.DirectionIn, beego.AppConfig.DefaultString("nsq::topic.sub", cm.TopicSUBName))
 	}
 
 	// only for debug
@@ -0,0 +1,127 @@
+/*
+  Package microservice for broker and registry chosen by configure
+*/
+
+package microservice
+
+import (
+	"strings"
+
+	"github.com/astaxie/beego"
+	"github.com/micro/go-micro/broker"
+	httpbroker "github.com/micro/go-micro/broker/http"
+	memorybroker "github.com/micro/go-micro/broker/memory"
+	"github.com/micro/go-micro/registry"
+	"github.com/micro/go-micro/registry/etcd"
+	"github.com/micro/go-micro/registry/mdns"
+	memoryregistry "github.com/micro/go-micro/registry/memory"
+	"github.com/micro/go-plugins/broker/nsq"
+	log "github.com/sirupsen/logrus"
+
+	cm "siteResService/src/common"
+)
+
+// types of broker
+const (
+	BrokerNSQ		= "nsq"
+	BrokerMemory	= "memory"  // messages stay within one process
+	BrokerHTTP		= "http"
+)
+
+// types of registry
+const (
+	RegistryEtcd	= "etcd"
+	RegistryMDNS	= "mdns"
+	RegistryStatic	= "static"  // services stay within one process
+)
+
+// NewBroker returns broker chosen by broker::type, nsq if unknown
+func NewBroker() broker.Broker {
+	kind := beego.AppConfig.DefaultString("broker::type", cm.BrokerType)
+	switch kind {
+	case BrokerMemory:
+		log.Info("use memory broker")
+
+		return memorybroker.NewBroker()
+	case BrokerHTTP:
+		address := beego.AppConfig.DefaultString("broker::address", cm.BrokerHTTPAddress)
+
+		log.WithFields(log.Fields{
+			"address":	address,
+		}).Info("use http broker")
+
+		return httpbroker.NewBroker(broker.Addrs(address))
+	case BrokerNSQ:
+	default:
+		log.WithFields(log.Fields{
+			"type":	kind,
+		}).Error("unknown broker type, use nsq broker")
+	}
+
+	ip := beego.AppConfig.DefaultString("nsq::ip", cm.BrokerAddress)
+	port := beego.AppConfig.DefaultString("nsq::port", cm.BrokerPort)
+	var BrokerHosts = []string{ // specified nsq service host
+		0: ip + ":" + port,
+	}
+
+	return nsq.NewBroker(func(o *broker.Options) {
+		o.Addrs = BrokerHosts
+	})
+}
+
+// NewRegistry returns registry chosen by registry::type, etcd if unknown
+func NewRegistry() registry.Registry {
+	kind := beego.AppConfig.DefaultString("registry::type", cm.RegistryType)
+	switch kind {
+	case RegistryMDNS:
+		log.Info("use mdns registry")
+
+		return mdns.NewRegistry()
+	case RegistryStatic:
+		services := StaticServices(beego.AppConfig.DefaultString("registry::services", cm.RegistryServices))
+
+		log.WithFields(log.Fields{
+			"services":	len(services),
+		}).Info("use static registry")
+
+		return memoryregistry.NewRegistry(memoryregistry.Services(services))
+	case RegistryEtcd:
+	default:
+		log.WithFields(log.Fields{
+			"type":	kind,
+		}).Error("unknown registry type, use etcd registry")
+	}
+
+	ip := beego.AppConfig.DefaultString("etcd::ip", cm.RegistryAddress)
+	port := beego.AppConfig.DefaultString("etcd::port", cm.RegistryPort)
+	var RegistryHosts = []string{ // specified etcd service host
+		0: ip + ":" + port,
+	}
+
+	return etcd.NewRegistry(func(o *registry.Options) {
+		o.Addrs = RegistryHosts
+	})
+}
+
+// StaticServices returns services of static registry by "name=host:port" split by ",",
+// nodes of the same name belong to one service, illegal items are skipped
+func StaticServices(conf string) map[string][]*registry.Service {
+	nodes := make(map[string][]*registry.Node)
+	for _, item := range strings.Split(conf, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 || len(kv[0]) <= 0 || len(kv[1]) <= 0 {
+			continue
+		}
+
+		name := strings.TrimSpace(kv[0])
+		address := strings.TrimSpace(kv[1])
+		nodes[name] = append(nodes[name], &registry.Node{Id: name + "-" + address, Address: address})
+	}
+
+	services := make(map[string][]*registry.Service)
+	for name, n := range nodes {
+		services[name] = []*registry.Service{{Name: name, Nodes: n}}
+	}
+
+	return services
+}
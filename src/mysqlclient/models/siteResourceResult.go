@@ -0,0 +1,24 @@
+package models
+
+import (
+	"github.com/astaxie/beego/orm"
+)
+
+type SiteResourceResult struct {
+	Id         int    `orm:"column(id);auto" description:"自增id"`
+	UrlMd5     string `orm:"column(url_md5);size(32);unique" description:"落地页链接md5"`
+	PageLink   string `orm:"column(page_link);size(1000)" description:"落地页链接"`
+	Info       string `orm:"column(info);type(longtext)" description:"解析结果(json)"`
+	ParseTime  int    `orm:"column(parse_time)" description:"解析时间"`
+}
+
+// TableName return this model of table name
+func (t *SiteResourceResult) TableName() string {
+	return "site_resource_result"
+}
+
+// inti for package model
+func init() {
+	// register model
+	orm.RegisterModel(new(SiteResourceResult))
+}
@@ -9,6 +9,12 @@ It is generated from these files:
 
 It has these top-level messages:
 	Event
+	ResourceRow
+	SiteResource
+	CrawlRequest
+	CrawlError
+	CrawlTiming
+	CrawlResult
 */
 package api
 
@@ -37,6 +43,8 @@ type Event struct {
 	Magic int64 `protobuf:"varint,3,opt,name=magic" json:"magic,omitempty"`
 	// message
 	Message string `protobuf:"bytes,4,opt,name=message" json:"message,omitempty"`
+	// callback url, parse result is posted to it if set
+	Callback string `protobuf:"bytes,5,opt,name=callback" json:"callback,omitempty"`
 }
 
 func (m *Event) Reset()                    { *m = Event{} }
@@ -72,20 +80,476 @@ func (m *Event) GetMessage() string {
 	return ""
 }
 
+func (m *Event) GetCallback() string {
+	if m != nil {
+		return m.Callback
+	}
+	return ""
+}
+
+// row of specifications or set meals
+type ResourceRow struct {
+	Cells []string `protobuf:"bytes,1,rep,name=cells" json:"cells,omitempty"`
+}
+
+func (m *ResourceRow) Reset()                    { *m = ResourceRow{} }
+func (m *ResourceRow) String() string            { return proto.CompactTextString(m) }
+func (*ResourceRow) ProtoMessage()               {}
+func (*ResourceRow) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *ResourceRow) GetCells() []string {
+	if m != nil {
+		return m.Cells
+	}
+	return nil
+}
+
+// site resource parsed from a landing page, published to topic.pub
+type SiteResource struct {
+	// id of event or crawl job which triggered parsing, empty if queried by api
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	// unix timestamp
+	Timestamp int64  `protobuf:"varint,2,opt,name=timestamp" json:"timestamp,omitempty"`
+	PageUrl   string `protobuf:"bytes,3,opt,name=page_url,json=pageUrl" json:"page_url,omitempty"`
+	// head images
+	Cover []string `protobuf:"bytes,4,rep,name=cover" json:"cover,omitempty"`
+	Title string   `protobuf:"bytes,5,opt,name=title" json:"title,omitempty"`
+	Price []string `protobuf:"bytes,6,rep,name=price" json:"price,omitempty"`
+	// currency unit
+	Currency string `protobuf:"bytes,7,opt,name=currency" json:"currency,omitempty"`
+	// descriptions with image
+	Desc string `protobuf:"bytes,8,opt,name=desc" json:"desc,omitempty"`
+	// specifications with image
+	Spec []*ResourceRow `protobuf:"bytes,9,rep,name=spec" json:"spec,omitempty"`
+	// set meals
+	Good []*ResourceRow `protobuf:"bytes,10,rep,name=good" json:"good,omitempty"`
+	// parser which parsed page
+	Template string `protobuf:"bytes,11,opt,name=template" json:"template,omitempty"`
+	// version of domain template which parsed page
+	TemplateVersion int32 `protobuf:"varint,12,opt,name=template_version,json=templateVersion" json:"template_version,omitempty"`
+}
+
+func (m *SiteResource) Reset()                    { *m = SiteResource{} }
+func (m *SiteResource) String() string            { return proto.CompactTextString(m) }
+func (*SiteResource) ProtoMessage()               {}
+func (*SiteResource) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *SiteResource) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *SiteResource) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+func (m *SiteResource) GetPageUrl() string {
+	if m != nil {
+		return m.PageUrl
+	}
+	return ""
+}
+
+func (m *SiteResource) GetCover() []string {
+	if m != nil {
+		return m.Cover
+	}
+	return nil
+}
+
+func (m *SiteResource) GetTitle() string {
+	if m != nil {
+		return m.Title
+	}
+	return ""
+}
+
+func (m *SiteResource) GetPrice() []string {
+	if m != nil {
+		return m.Price
+	}
+	return nil
+}
+
+func (m *SiteResource) GetCurrency() string {
+	if m != nil {
+		return m.Currency
+	}
+	return ""
+}
+
+func (m *SiteResource) GetDesc() string {
+	if m != nil {
+		return m.Desc
+	}
+	return ""
+}
+
+func (m *SiteResource) GetSpec() []*ResourceRow {
+	if m != nil {
+		return m.Spec
+	}
+	return nil
+}
+
+func (m *SiteResource) GetGood() []*ResourceRow {
+	if m != nil {
+		return m.Good
+	}
+	return nil
+}
+
+func (m *SiteResource) GetTemplate() string {
+	if m != nil {
+		return m.Template
+	}
+	return ""
+}
+
+func (m *SiteResource) GetTemplateVersion() int32 {
+	if m != nil {
+		return m.TemplateVersion
+	}
+	return 0
+}
+
+// crawl request of a landing page, subscribed from topic.crawl, posted to /v1/crawl or called by Crawler.Crawl
+type CrawlRequest struct {
+	// unique id, kept in result for correlation
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	// unix timestamp
+	Timestamp int64 `protobuf:"varint,2,opt,name=timestamp" json:"timestamp,omitempty"`
+	// landing page url
+	Url string `protobuf:"bytes,3,opt,name=url" json:"url,omitempty"`
+	// higher priority is scheduled first
+	Priority int32 `protobuf:"varint,4,opt,name=priority" json:"priority,omitempty"`
+	// parse page again even if result is stored
+	ForceRefresh bool `protobuf:"varint,5,opt,name=force_refresh,json=forceRefresh" json:"force_refresh,omitempty"`
+	// wanted fields: cover, title, currency, price, desc, good, spec, all fields if empty
+	Fields []string `protobuf:"bytes,6,rep,name=fields" json:"fields,omitempty"`
+	// cargo id of page, kept in result
+	CargoId string `protobuf:"bytes,7,opt,name=cargo_id,json=cargoId" json:"cargo_id,omitempty"`
+	// result is posted to this url if set
+	Callback string `protobuf:"bytes,8,opt,name=callback" json:"callback,omitempty"`
+}
+
+func (m *CrawlRequest) Reset()                    { *m = CrawlRequest{} }
+func (m *CrawlRequest) String() string            { return proto.CompactTextString(m) }
+func (*CrawlRequest) ProtoMessage()               {}
+func (*CrawlRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *CrawlRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *CrawlRequest) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+func (m *CrawlRequest) GetUrl() string {
+	if m != nil {
+		return m.Url
+	}
+	return ""
+}
+
+func (m *CrawlRequest) GetPriority() int32 {
+	if m != nil {
+		return m.Priority
+	}
+	return 0
+}
+
+func (m *CrawlRequest) GetForceRefresh() bool {
+	if m != nil {
+		return m.ForceRefresh
+	}
+	return false
+}
+
+func (m *CrawlRequest) GetFields() []string {
+	if m != nil {
+		return m.Fields
+	}
+	return nil
+}
+
+func (m *CrawlRequest) GetCargoId() string {
+	if m != nil {
+		return m.CargoId
+	}
+	return ""
+}
+
+func (m *CrawlRequest) GetCallback() string {
+	if m != nil {
+		return m.Callback
+	}
+	return ""
+}
+
+// error of failed crawl
+type CrawlError struct {
+	// bad_url, unknown_field, bad_priority, unknown_domain, robots_disallowed, rate_limited, parse_incomplete or fetch_failed
+	Code string `protobuf:"bytes,1,opt,name=code" json:"code,omitempty"`
+	// class of fetch failure: dns, timeout, tls, network, 4xx, 5xx, 429 or browser
+	Class   string `protobuf:"bytes,2,opt,name=class" json:"class,omitempty"`
+	Message string `protobuf:"bytes,3,opt,name=message" json:"message,omitempty"`
+}
+
+func (m *CrawlError) Reset()                    { *m = CrawlError{} }
+func (m *CrawlError) String() string            { return proto.CompactTextString(m) }
+func (*CrawlError) ProtoMessage()               {}
+func (*CrawlError) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *CrawlError) GetCode() string {
+	if m != nil {
+		return m.Code
+	}
+	return ""
+}
+
+func (m *CrawlError) GetClass() string {
+	if m != nil {
+		return m.Class
+	}
+	return ""
+}
+
+func (m *CrawlError) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+// timings of crawl
+type CrawlTiming struct {
+	// unix milliseconds crawl started
+	Started int64 `protobuf:"varint,1,opt,name=started" json:"started,omitempty"`
+	// milliseconds of fetch and parse, 0 if served by stored result
+	Elapsed int64 `protobuf:"varint,2,opt,name=elapsed" json:"elapsed,omitempty"`
+}
+
+func (m *CrawlTiming) Reset()                    { *m = CrawlTiming{} }
+func (m *CrawlTiming) String() string            { return proto.CompactTextString(m) }
+func (*CrawlTiming) ProtoMessage()               {}
+func (*CrawlTiming) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *CrawlTiming) GetStarted() int64 {
+	if m != nil {
+		return m.Started
+	}
+	return 0
+}
+
+func (m *CrawlTiming) GetElapsed() int64 {
+	if m != nil {
+		return m.Elapsed
+	}
+	return 0
+}
+
+// result of crawl request, only wanted fields are set
+type CrawlResult struct {
+	// id of crawl request
+	Id      string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Url     string `protobuf:"bytes,2,opt,name=url" json:"url,omitempty"`
+	CargoId string `protobuf:"bytes,3,opt,name=cargo_id,json=cargoId" json:"cargo_id,omitempty"`
+	// served by stored parse result
+	Stored bool `protobuf:"varint,4,opt,name=stored" json:"stored,omitempty"`
+	// head images
+	Cover []string `protobuf:"bytes,5,rep,name=cover" json:"cover,omitempty"`
+	Title string   `protobuf:"bytes,6,opt,name=title" json:"title,omitempty"`
+	Price []string `protobuf:"bytes,7,rep,name=price" json:"price,omitempty"`
+	// currency unit
+	Currency string `protobuf:"bytes,8,opt,name=currency" json:"currency,omitempty"`
+	// html blocks of descriptions with image
+	Desc []string `protobuf:"bytes,9,rep,name=desc" json:"desc,omitempty"`
+	// set meals
+	Good []*ResourceRow `protobuf:"bytes,10,rep,name=good" json:"good,omitempty"`
+	// specifications with image
+	Spec []*ResourceRow `protobuf:"bytes,11,rep,name=spec" json:"spec,omitempty"`
+	// parser which parsed page
+	Template string `protobuf:"bytes,12,opt,name=template" json:"template,omitempty"`
+	// version of domain template which parsed page
+	TemplateVersion int32        `protobuf:"varint,13,opt,name=template_version,json=templateVersion" json:"template_version,omitempty"`
+	Timing          *CrawlTiming `protobuf:"bytes,14,opt,name=timing" json:"timing,omitempty"`
+	// set if crawl failed
+	Error *CrawlError `protobuf:"bytes,15,opt,name=error" json:"error,omitempty"`
+}
+
+func (m *CrawlResult) Reset()                    { *m = CrawlResult{} }
+func (m *CrawlResult) String() string            { return proto.CompactTextString(m) }
+func (*CrawlResult) ProtoMessage()               {}
+func (*CrawlResult) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *CrawlResult) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *CrawlResult) GetUrl() string {
+	if m != nil {
+		return m.Url
+	}
+	return ""
+}
+
+func (m *CrawlResult) GetCargoId() string {
+	if m != nil {
+		return m.CargoId
+	}
+	return ""
+}
+
+func (m *CrawlResult) GetStored() bool {
+	if m != nil {
+		return m.Stored
+	}
+	return false
+}
+
+func (m *CrawlResult) GetCover() []string {
+	if m != nil {
+		return m.Cover
+	}
+	return nil
+}
+
+func (m *CrawlResult) GetTitle() string {
+	if m != nil {
+		return m.Title
+	}
+	return ""
+}
+
+func (m *CrawlResult) GetPrice() []string {
+	if m != nil {
+		return m.Price
+	}
+	return nil
+}
+
+func (m *CrawlResult) GetCurrency() string {
+	if m != nil {
+		return m.Currency
+	}
+	return ""
+}
+
+func (m *CrawlResult) GetDesc() []string {
+	if m != nil {
+		return m.Desc
+	}
+	return nil
+}
+
+func (m *CrawlResult) GetGood() []*ResourceRow {
+	if m != nil {
+		return m.Good
+	}
+	return nil
+}
+
+func (m *CrawlResult) GetSpec() []*ResourceRow {
+	if m != nil {
+		return m.Spec
+	}
+	return nil
+}
+
+func (m *CrawlResult) GetTemplate() string {
+	if m != nil {
+		return m.Template
+	}
+	return ""
+}
+
+func (m *CrawlResult) GetTemplateVersion() int32 {
+	if m != nil {
+		return m.TemplateVersion
+	}
+	return 0
+}
+
+func (m *CrawlResult) GetTiming() *CrawlTiming {
+	if m != nil {
+		return m.Timing
+	}
+	return nil
+}
+
+func (m *CrawlResult) GetError() *CrawlError {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Event)(nil), "Event")
+	proto.RegisterType((*ResourceRow)(nil), "ResourceRow")
+	proto.RegisterType((*SiteResource)(nil), "SiteResource")
+	proto.RegisterType((*CrawlRequest)(nil), "CrawlRequest")
+	proto.RegisterType((*CrawlError)(nil), "CrawlError")
+	proto.RegisterType((*CrawlTiming)(nil), "CrawlTiming")
+	proto.RegisterType((*CrawlResult)(nil), "CrawlResult")
 }
 
 func init() { proto.RegisterFile("src/proto/api.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 125 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0x2e, 0x2e, 0x4a, 0xd6,
-	0x2f, 0x28, 0xca, 0x2f, 0xc9, 0xd7, 0x4f, 0x2c, 0xc8, 0xd4, 0x03, 0xb3, 0x94, 0x52, 0xb9, 0x58,
-	0x5d, 0xcb, 0x52, 0xf3, 0x4a, 0x84, 0xf8, 0xb8, 0x98, 0x32, 0x53, 0x24, 0x18, 0x15, 0x18, 0x35,
-	0x38, 0x83, 0x98, 0x32, 0x53, 0x84, 0x64, 0xb8, 0x38, 0x4b, 0x32, 0x73, 0x53, 0x8b, 0x4b, 0x12,
-	0x73, 0x0b, 0x24, 0x98, 0x14, 0x18, 0x35, 0x98, 0x83, 0x10, 0x02, 0x42, 0x22, 0x5c, 0xac, 0xb9,
-	0x89, 0xe9, 0x99, 0xc9, 0x12, 0xcc, 0x60, 0x19, 0x08, 0x47, 0x48, 0x82, 0x8b, 0x3d, 0x37, 0xb5,
-	0xb8, 0x38, 0x31, 0x3d, 0x55, 0x82, 0x05, 0x6c, 0x10, 0x8c, 0x9b, 0xc4, 0x06, 0xb6, 0xcd, 0x18,
-	0x10, 0x00, 0x00, 0xff, 0xff, 0x7c, 0xdf, 0xa2, 0x6b, 0x84, 0x00, 0x00, 0x00,
+	// 596 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x94, 0x4d, 0x6e, 0xdb, 0x3c,
+	0x10, 0x86, 0x21, 0xcb, 0xb2, 0xa5, 0xb1, 0xf2, 0x03, 0x7e, 0x1f, 0x02, 0x36, 0xe8, 0x42, 0x75,
+	0xb2, 0x70, 0x37, 0x0e, 0x90, 0x9e, 0xa0, 0x28, 0xb2, 0xe8, 0xae, 0x60, 0x7f, 0xb6, 0x86, 0x22,
+	0x4d, 0x5c, 0xa2, 0xb4, 0xa9, 0x92, 0x74, 0x82, 0x2c, 0x7b, 0x9b, 0x1e, 0xa8, 0xeb, 0x9e, 0xa5,
+	0xe0, 0x88, 0x8a, 0x95, 0xd6, 0x46, 0x9b, 0xdd, 0xbc, 0x33, 0x63, 0x92, 0xf3, 0xce, 0x63, 0xc1,
+	0x7f, 0xd6, 0x54, 0x17, 0x8d, 0xd1, 0x4e, 0x5f, 0x94, 0x8d, 0x9c, 0x53, 0x34, 0xfd, 0x16, 0x41,
+	0x72, 0x75, 0x8b, 0x6b, 0xc7, 0x0e, 0x61, 0x20, 0x6b, 0x1e, 0x15, 0xd1, 0x2c, 0x13, 0x03, 0x59,
+	0xb3, 0xe7, 0x90, 0x39, 0xb9, 0x42, 0xeb, 0xca, 0x55, 0xc3, 0x07, 0x45, 0x34, 0x8b, 0xc5, 0x36,
+	0xc1, 0xfe, 0x87, 0x64, 0x55, 0x2e, 0x65, 0xc5, 0x63, 0xaa, 0xb4, 0x82, 0x71, 0x18, 0xaf, 0xd0,
+	0xda, 0x72, 0x89, 0x7c, 0x48, 0x07, 0x75, 0x92, 0x9d, 0x42, 0x5a, 0x95, 0x4a, 0x5d, 0x97, 0xd5,
+	0x17, 0x9e, 0x50, 0xe9, 0x41, 0x4f, 0xcf, 0x60, 0x22, 0xd0, 0xea, 0x8d, 0xa9, 0x50, 0xe8, 0x3b,
+	0x7f, 0x74, 0x85, 0x4a, 0x59, 0x1e, 0x15, 0xf1, 0x2c, 0x13, 0xad, 0x98, 0xfe, 0x18, 0x40, 0xfe,
+	0x5e, 0x3a, 0xec, 0x3a, 0x9f, 0xf8, 0xde, 0x67, 0x90, 0x36, 0xe5, 0x12, 0x17, 0x1b, 0xa3, 0xe8,
+	0xc9, 0x99, 0x18, 0x7b, 0xfd, 0xd1, 0x28, 0xba, 0x4f, 0xdf, 0xa2, 0xe1, 0xc3, 0x70, 0x9f, 0x17,
+	0x3e, 0xeb, 0xa4, 0x53, 0x18, 0x5e, 0xdb, 0x0a, 0x9f, 0x6d, 0x8c, 0xac, 0x90, 0x8f, 0xda, 0x5e,
+	0x12, 0x34, 0xdc, 0xc6, 0x18, 0x5c, 0x57, 0xf7, 0x7c, 0x1c, 0x86, 0x0b, 0x9a, 0x31, 0x18, 0xd6,
+	0x68, 0x2b, 0x9e, 0x52, 0x9e, 0x62, 0x56, 0xc0, 0xd0, 0x36, 0x58, 0xf1, 0xac, 0x88, 0x67, 0x93,
+	0xcb, 0x7c, 0xde, 0x9b, 0x5e, 0x50, 0xc5, 0x77, 0x2c, 0xb5, 0xae, 0x39, 0xec, 0xea, 0xf0, 0x15,
+	0x7f, 0xa7, 0xc3, 0x55, 0xa3, 0x4a, 0x87, 0x7c, 0xd2, 0xde, 0xd9, 0x69, 0xf6, 0x12, 0x8e, 0xbb,
+	0x78, 0x71, 0x8b, 0xc6, 0x4a, 0xbd, 0xe6, 0x79, 0x11, 0xcd, 0x12, 0x71, 0xd4, 0xe5, 0x3f, 0xb5,
+	0xe9, 0xe9, 0xcf, 0x08, 0xf2, 0x37, 0xa6, 0xbc, 0x53, 0x02, 0xbf, 0x6e, 0xd0, 0x3e, 0x15, 0x83,
+	0x63, 0x88, 0xb7, 0x8e, 0xfa, 0xd0, 0xbf, 0xab, 0x31, 0x52, 0x1b, 0xe9, 0xee, 0x89, 0x81, 0x44,
+	0x3c, 0x68, 0x76, 0x06, 0x07, 0x37, 0xda, 0x54, 0xb8, 0x30, 0x78, 0x63, 0xd0, 0x7e, 0x26, 0x6f,
+	0x53, 0x91, 0x53, 0x52, 0xb4, 0x39, 0x76, 0x02, 0xa3, 0x1b, 0x89, 0xaa, 0xb6, 0xc1, 0xe3, 0xa0,
+	0xfc, 0x06, 0xab, 0xd2, 0x2c, 0xf5, 0x42, 0xd6, 0xc1, 0xe4, 0x31, 0xe9, 0xb7, 0xf5, 0x23, 0xb8,
+	0xd2, 0xdf, 0xe0, 0x7a, 0x07, 0x40, 0xf3, 0x5d, 0x19, 0xa3, 0x8d, 0xdf, 0x46, 0xa5, 0x6b, 0x0c,
+	0xf3, 0x51, 0x4c, 0xfb, 0x57, 0xa5, 0xb5, 0x34, 0x5d, 0x26, 0x5a, 0xd1, 0x47, 0x39, 0x7e, 0x84,
+	0xf2, 0xf4, 0x35, 0x4c, 0xe8, 0xc4, 0x0f, 0x72, 0x25, 0xd7, 0x4b, 0xdf, 0x68, 0x5d, 0x69, 0x1c,
+	0xb6, 0xae, 0xc5, 0xa2, 0x93, 0xbe, 0x82, 0xaa, 0x6c, 0x2c, 0xd6, 0xc1, 0xb8, 0x4e, 0x4e, 0xbf,
+	0xc7, 0xe1, 0x0c, 0x81, 0x76, 0xa3, 0xfe, 0x34, 0x3d, 0xd8, 0x3a, 0xd8, 0xda, 0xda, 0x9f, 0x3e,
+	0x7e, 0x3c, 0xfd, 0x09, 0x8c, 0xac, 0xd3, 0x06, 0x6b, 0xf2, 0x3b, 0x15, 0x41, 0x6d, 0xb9, 0x4e,
+	0x76, 0x72, 0x3d, 0xda, 0xc9, 0xf5, 0x78, 0x1f, 0xd7, 0xe9, 0x1e, 0xae, 0x33, 0xfa, 0xc1, 0x03,
+	0xd7, 0x7f, 0xa1, 0xb6, 0x23, 0x7f, 0xb2, 0x97, 0xfc, 0x3e, 0xd7, 0xf9, 0x3f, 0x70, 0x7d, 0xb0,
+	0x93, 0x6b, 0x76, 0x0e, 0x23, 0x47, 0xfb, 0xe1, 0x87, 0x45, 0x44, 0x57, 0xf5, 0x76, 0x26, 0x42,
+	0x8d, 0xbd, 0x80, 0x04, 0x3d, 0x17, 0xfc, 0x88, 0x9a, 0x26, 0xf3, 0x2d, 0x2a, 0xa2, 0xad, 0x5c,
+	0x5e, 0xc0, 0x98, 0x92, 0x68, 0xd8, 0x39, 0x24, 0x14, 0xb2, 0x83, 0x79, 0xff, 0x2f, 0x73, 0x9a,
+	0xcf, 0x7b, 0xbb, 0xbc, 0x1e, 0xd1, 0x87, 0xf5, 0xd5, 0xaf, 0x01, 0x00, 0xf7, 0x87, 0xbd, 0x2c,
+	0x6f, 0x05, 0x00, 0x00,
 }
@@ -9,6 +9,12 @@ import (
 	math "math"
 )
 
+import (
+	context "context"
+	client "github.com/micro/go-micro/client"
+	server "github.com/micro/go-micro/server"
+)
+
 // Reference imports to suppress errors if they are not otherwise used.
 var _ = proto.Marshal
 var _ = fmt.Errorf
@@ -19,3 +25,67 @@ var _ = math.Inf
 // A compilation error at this line likely means your copy of the
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ client.Option
+var _ server.Option
+
+// Client API for Crawler service
+
+type CrawlerService interface {
+	Crawl(ctx context.Context, in *CrawlRequest, opts ...client.CallOption) (*CrawlResult, error)
+}
+
+type crawlerService struct {
+	c    client.Client
+	name string
+}
+
+func NewCrawlerService(name string, c client.Client) CrawlerService {
+	if c == nil {
+		c = client.NewClient()
+	}
+	if len(name) == 0 {
+		name = "crawler"
+	}
+	return &crawlerService{
+		c:    c,
+		name: name,
+	}
+}
+
+func (c *crawlerService) Crawl(ctx context.Context, in *CrawlRequest, opts ...client.CallOption) (*CrawlResult, error) {
+	req := c.c.NewRequest(c.name, "Crawler.Crawl", in)
+	out := new(CrawlResult)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Crawler service
+
+type CrawlerHandler interface {
+	Crawl(context.Context, *CrawlRequest, *CrawlResult) error
+}
+
+func RegisterCrawlerHandler(s server.Server, hdlr CrawlerHandler, opts ...server.HandlerOption) error {
+	type crawler interface {
+		Crawl(ctx context.Context, in *CrawlRequest, out *CrawlResult) error
+	}
+	type Crawler struct {
+		crawler
+	}
+	h := &crawlerHandler{hdlr}
+	return s.Handle(s.NewHandler(&Crawler{h}, opts...))
+}
+
+type crawlerHandler struct {
+	CrawlerHandler
+}
+
+func (h *crawlerHandler) Crawl(ctx context.Context, in *CrawlRequest, out *CrawlResult) error {
+	return h.CrawlerHandler.Crawl(ctx, in, out)
+}
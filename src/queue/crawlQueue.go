@@ -0,0 +1,592 @@
+/*
+  Package queue for durable crawl queue, page messages are kept in a file backed log until parsed
+*/
+
+package queue
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/astaxie/beego"
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+
+	cm "siteResService/src/common"
+)
+
+// operations of queue log record
+const (
+	OpEnqueue	= "enqueue"
+	OpLease		= "lease"
+	OpAck		= "ack"
+	OpFail		= "fail"
+	OpRetry		= "retry"  // failed by transient error, ready to lease again
+	OpRelease	= "release"  // leased and not finished before graceful shutdown, lease is not counted
+	OpCursor	= "cursor"  // read offset of source, kept by compaction
+)
+
+// record represents one json line of queue log
+type record struct {
+	Op			string				`json:"op"`
+	ID			uint64				`json:"id,omitempty"`
+	Message		*cm.PageMessage		`json:"msg,omitempty"`
+	Source		string				`json:"source,omitempty"`  // file or db which message read from
+	Offset		int64				`json:"offset,omitempty"`  // position of message in source
+	Leases		int					`json:"leases,omitempty"`  // leases before compaction
+	Reason		string				`json:"reason,omitempty"`  // reason of fail or retry
+	Time		int64				`json:"time"`
+}
+
+// Item represents page message enqueued and not acked or failed yet
+type Item struct {
+	ID			uint64
+	Message		*cm.PageMessage
+	Leases		int  // times leased, redelivered items are leased more than once
+	leased		bool  // leased and not finished or retried yet
+}
+
+// Queue represents durable crawl queue, every state change is appended to log before it is visible,
+// items not acked or failed are redelivered when log is opened again
+type Queue struct {
+	lock				sync.Mutex
+	cond				*sync.Cond  // signaled when item ready or lease stopped
+	room				*sync.Cond  // signaled when item leased or lease stopped
+	path				string
+	file				*os.File
+	writer				*bufio.Writer
+	fsync				bool  // sync file after every record
+	maxLeases			int  // item leased more than this is failed
+	compactEvery		int  // rewrite log after this many acks and fails, 0 means only when opened
+	nextID				uint64
+	items				map[uint64]*Item  // enqueued or leased
+	ready				map[int][]uint64  // ids of items to lease of each priority, in order of enqueue
+	readyNum			int
+	offsets				map[string]int64
+	finished			int  // acks and fails since compaction
+	stopped				bool  // Lease returns false
+	EnqueueCounter		uint64  // calculation num of items enqueued, must use by atomic !!!
+	AckCounter			uint64  // calculation num of items acked, must use by atomic !!!
+	FailCounter			uint64  // calculation num of items failed, must use by atomic !!!
+	RetryCounter		uint64  // calculation num of items failed by transient error and ready again, must use by atomic !!!
+	RedeliverCounter	uint64  // calculation num of items redelivered when opened, must use by atomic !!!
+}
+
+var instance *Queue
+var initQueueOnce sync.Once
+
+// ErrClosed returned when queue is closed
+var ErrClosed = errors.New("crawl queue is closed")
+
+// GetQueue returns pointer of Queue instance read from app.conf, nil if disabled or log can not be opened
+func GetQueue() *Queue {
+	initQueueOnce.Do(func() {
+		if !beego.AppConfig.DefaultBool("queue::enable", cm.QueueEnable) {
+			log.Info("crawl queue is disabled, page urls are kept in memory")
+
+			return
+		}
+
+		filePath := beego.AppConfig.DefaultString("queue::path", cm.QueuePath)
+		q, err := Open(filePath,
+			beego.AppConfig.DefaultInt("queue::maxLeases", cm.QueueMaxLeases),
+			beego.AppConfig.DefaultInt("queue::compactEvery", cm.QueueCompactEvery),
+			beego.AppConfig.DefaultBool("queue::fsync", cm.QueueFsync))
+		if err != nil {
+			log.WithFields(log.Fields{
+				"path":		filePath,
+				"error":	err.Error(),
+			}).Error("can not open crawl queue, page urls are kept in memory")
+
+			return
+		}
+		instance = q
+	})
+
+	return instance
+}
+
+// Open returns pointer of Queue instance of log file, items not finished in log are redelivered
+func Open(filePath string, maxLeases int, compactEvery int, fsync bool) (*Queue, error) {
+	if err := os.MkdirAll(path.Dir(filePath), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	q := &Queue{
+		path:			filePath,
+		fsync:			fsync,
+		maxLeases:		maxLeases,
+		compactEvery:	compactEvery,
+		nextID:			1,
+		items:			make(map[uint64]*Item),
+		offsets:		make(map[string]int64),
+		ready:			make(map[int][]uint64),
+	}
+	q.cond = sync.NewCond(&q.lock)
+	q.room = sync.NewCond(&q.lock)
+
+	if err := q.replay(); err != nil {
+		return nil, err
+	}
+	ids := make([]uint64, 0, len(q.items))
+	for id := range q.items {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		q.pushReady(q.items[id].Message.Priority, id, false)
+	}
+	atomic.StoreUint64(&q.RedeliverCounter, uint64(q.readyNum))
+
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"path":			filePath,
+		"redeliver":	q.readyNum,
+	}).Info("open crawl queue success...")
+
+	return q, nil
+}
+
+// replay for rebuild items and offsets from log, a broken last line written by crash is ignored
+func (q *Queue) replay() error {
+	file, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		dat, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(dat) > 0 {
+				log.WithFields(log.Fields{
+					"path":	q.path,
+					"line":	line,
+				}).Warn("ignore broken last record of crawl queue")
+			}
+
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		rec := new(record)
+		if err := jsoniter.Unmarshal(dat, rec); err != nil {
+			log.WithFields(log.Fields{
+				"path":		q.path,
+				"line":		line,
+				"error":	err.Error(),
+			}).Warn("ignore broken record of crawl queue")
+
+			continue
+		}
+		q.apply(rec)
+	}
+}
+
+// apply for change items and offsets by record
+func (q *Queue) apply(rec *record) {
+	if rec.ID >= q.nextID {
+		q.nextID = rec.ID + 1
+	}
+	if len(rec.Source) > 0 && rec.Offset > q.offsets[rec.Source] {
+		q.offsets[rec.Source] = rec.Offset
+	}
+
+	switch rec.Op {
+	case OpEnqueue:
+		if rec.Message != nil {
+			rec.Message.QueueID = rec.ID
+			q.items[rec.ID] = &Item{ID: rec.ID, Message: rec.Message, Leases: rec.Leases}
+		}
+	case OpLease:
+		if item, ok := q.items[rec.ID]; ok {
+			item.Leases++
+		}
+	case OpRelease:
+		if item, ok := q.items[rec.ID]; ok && item.Leases > 0 {
+			item.Leases--
+		}
+	case OpAck, OpFail:
+		delete(q.items, rec.ID)
+	}
+}
+
+// compact for rewrite log with items not finished and offsets only, must hold lock or not shared yet
+func (q *Queue) compact() error {
+	tmpPath := q.path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+	now := time.Now().Unix()
+	ids := make([]uint64, 0, len(q.items))
+	for id := range q.items {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		item := q.items[id]
+		writeRecord(w, &record{Op: OpEnqueue, ID: id, Message: item.Message, Leases: item.Leases, Time: now})
+	}
+	for source, offset := range q.offsets {
+		writeRecord(w, &record{Op: OpCursor, Source: source, Offset: offset, Time: now})
+	}
+	err = w.Flush()
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+
+		return err
+	}
+
+	if q.file != nil {
+		q.writer.Flush()
+		q.file.Close()
+	}
+	renameErr := os.Rename(tmpPath, q.path)  // old log is kept appending if failed
+	q.file, err = os.OpenFile(q.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		q.file = nil
+
+		return err
+	}
+	q.writer = bufio.NewWriter(q.file)
+	if renameErr != nil {
+		return renameErr
+	}
+	q.finished = 0
+
+	return nil
+}
+
+// writeRecord for write record as one json line
+func writeRecord(w io.Writer, rec *record) error {
+	dat, err := jsoniter.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(dat, '\n'))
+
+	return err
+}
+
+// append returns error if record is not written to log, must hold lock
+func (q *Queue) append(rec *record) error {
+	if q.file == nil {
+		return ErrClosed
+	}
+
+	rec.Time = time.Now().Unix()
+	err := writeRecord(q.writer, rec)
+	if err == nil {
+		err = q.writer.Flush()
+	}
+	if err == nil && q.fsync {
+		err = q.file.Sync()
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"op":		rec.Op,
+			"id":		rec.ID,
+			"error":	err.Error(),
+		}).Error("can not write crawl queue by append")
+	}
+
+	return err
+}
+
+// Enqueue returns error if message is not written to log, source and offset are position of message
+// in file or db which it read from, empty source if not read from source
+func (q *Queue) Enqueue(msg *cm.PageMessage, source string, offset int64) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	id := q.nextID
+	msg.QueueID = id
+	if err := q.append(&record{Op: OpEnqueue, ID: id, Message: msg, Source: source, Offset: offset}); err != nil {
+		msg.QueueID = 0
+
+		return err
+	}
+	q.nextID++
+	q.items[id] = &Item{ID: id, Message: msg}
+	q.pushReady(msg.Priority, id, false)
+	if len(source) > 0 && offset > q.offsets[source] {
+		q.offsets[source] = offset
+	}
+	atomic.AddUint64(&q.EnqueueCounter, 1)
+	q.cond.Signal()
+
+	return nil
+}
+
+// pushReady for add id to ready items of priority, front is true for put it back, must hold lock
+func (q *Queue) pushReady(priority int, id uint64, front bool) {
+	if front {
+		q.ready[priority] = append([]uint64{id}, q.ready[priority]...)
+	} else {
+		q.ready[priority] = append(q.ready[priority], id)
+	}
+	q.readyNum++
+}
+
+// popReady returns id of the oldest item ready of the highest priority, must hold lock and have item ready
+func (q *Queue) popReady() uint64 {
+	first := true
+	var priority int
+	for p := range q.ready {
+		if first || p > priority {
+			priority = p
+			first = false
+		}
+	}
+
+	id := q.ready[priority][0]
+	if q.ready[priority] = q.ready[priority][1:]; len(q.ready[priority]) <= 0 {
+		delete(q.ready, priority)
+	}
+	q.readyNum--
+	q.room.Broadcast()
+
+	return id
+}
+
+// Lease returns the oldest item ready of the highest priority, blocks until one is ready, false if lease stopped,
+// item leased more than max leases is failed instead, for it may crash the service or its site keeps failing
+func (q *Queue) Lease() (*Item, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for {
+		for q.readyNum <= 0 && !q.stopped {
+			q.cond.Wait()
+		}
+		if q.stopped {
+			return nil, false
+		}
+
+		id := q.popReady()
+		item, ok := q.items[id]
+		if !ok {
+			continue
+		}
+		if q.maxLeases > 0 && item.Leases >= q.maxLeases {
+			log.WithFields(log.Fields{
+				"id":		id,
+				"pageURL":	item.Message.URL,
+				"leases":	item.Leases,
+			}).Error("page url leased too many times, fail it by Lease")
+			q.finish(&record{Op: OpFail, ID: id, Reason: "too many leases"})
+
+			continue
+		}
+
+		if err := q.append(&record{Op: OpLease, ID: id}); err != nil {
+			q.pushReady(item.Message.Priority, id, true)
+
+			return nil, false
+		}
+		item.Leases++
+		item.leased = true
+
+		return item, true
+	}
+}
+
+// finish for write ack or fail record and drop item, log is compacted after compact every finished, must hold lock
+func (q *Queue) finish(rec *record) error {
+	if _, ok := q.items[rec.ID]; !ok {
+		return nil
+	}
+	if err := q.append(rec); err != nil {
+		return err
+	}
+	delete(q.items, rec.ID)
+	if rec.Op == OpAck {
+		atomic.AddUint64(&q.AckCounter, 1)
+	} else {
+		atomic.AddUint64(&q.FailCounter, 1)
+	}
+
+	q.finished++
+	if q.compactEvery > 0 && q.finished >= q.compactEvery {
+		if err := q.compact(); err != nil {
+			log.WithFields(log.Fields{
+				"path":		q.path,
+				"error":	err.Error(),
+			}).Error("can not compact crawl queue by finish")
+		}
+	}
+
+	return nil
+}
+
+// Ack for mark item parsed, it is not redelivered
+func (q *Queue) Ack(id uint64) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.finish(&record{Op: OpAck, ID: id})
+}
+
+// Fail for mark item failed for reason, it is not redelivered
+func (q *Queue) Fail(id uint64, reason string) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.finish(&record{Op: OpFail, ID: id, Reason: reason})
+}
+
+// Retry for put item failed by transient error back to ready, it is failed instead if leased max leases already
+func (q *Queue) Retry(id uint64, reason string) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	item, ok := q.items[id]
+	if !ok || !item.leased {
+		return nil
+	}
+	if q.maxLeases > 0 && item.Leases >= q.maxLeases {
+		return q.finish(&record{Op: OpFail, ID: id, Reason: reason})
+	}
+	if err := q.append(&record{Op: OpRetry, ID: id, Reason: reason}); err != nil {
+		return err
+	}
+	item.leased = false
+	q.pushReady(item.Message.Priority, id, false)
+	atomic.AddUint64(&q.RetryCounter, 1)
+	q.cond.Signal()
+
+	return nil
+}
+
+// transient returns true if retry of err may succeed, such as timeout or 5xx of fetch error
+func transient(err error) bool {
+	var te interface{ Transient() bool }
+
+	return errors.As(err, &te) && te.Transient()
+}
+
+// Finish for ack item if err is nil, retry it if err is transient, otherwise fail it, do nothing if id is 0 (message not queued)
+func (q *Queue) Finish(id uint64, err error) {
+	if q == nil || id == 0 {
+		return
+	}
+	if err != nil {
+		if transient(err) {
+			q.Retry(id, err.Error())
+		} else {
+			q.Fail(id, err.Error())
+		}
+
+		return
+	}
+	q.Ack(id)
+}
+
+// Offset returns offset of the last message enqueued from source
+func (q *Queue) Offset(source string) int64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.offsets[source]
+}
+
+// WaitRoom returns true if items ready are fewer than max, it waits for items leased at most timeout,
+// forever if timeout < 0, false at once if lease stopped, max <= 0 means no bound
+func (q *Queue) WaitRoom(max int, timeout time.Duration) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if max <= 0 || q.readyNum < max {
+		return true
+	}
+
+	expired := timeout == 0
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			q.lock.Lock()
+			expired = true
+			q.room.Broadcast()
+			q.lock.Unlock()
+		})
+		defer timer.Stop()
+	}
+	for q.readyNum >= max && !expired && !q.stopped {
+		q.room.Wait()
+	}
+
+	return q.readyNum < max
+}
+
+// Pending returns num of items ready and leased
+func (q *Queue) Pending() (int, int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.readyNum, len(q.items) - q.readyNum
+}
+
+// StopLease for make Lease return false, items ready are kept in log
+func (q *Queue) StopLease() {
+	q.lock.Lock()
+	q.stopped = true
+	q.cond.Broadcast()
+	q.room.Broadcast()
+	q.lock.Unlock()
+}
+
+// Close for flush and close log, items not finished are redelivered when opened again,
+// leases of items not finished are released, so items left by graceful shutdown are not failed by max leases
+func (q *Queue) Close() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.file == nil {
+		return nil
+	}
+	q.stopped = true
+	q.cond.Broadcast()
+	q.room.Broadcast()
+
+	for id, item := range q.items {
+		if !item.leased {
+			continue
+		}
+		if err := q.append(&record{Op: OpRelease, ID: id}); err != nil {
+			break
+		}
+		item.leased = false
+		item.Leases--
+	}
+
+	q.writer.Flush()
+	err := q.file.Sync()
+	if cerr := q.file.Close(); err == nil {
+		err = cerr
+	}
+	q.file = nil
+
+	return err
+}
@@ -0,0 +1,109 @@
+/*
+  Package queue for leases of items left by graceful shutdown and retry of transient errors
+*/
+
+package queue
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+
+	cm "siteResService/src/common"
+)
+
+// transientError for error of fetch which retry may succeed
+type transientError struct {
+	transient	bool
+}
+
+// Error returns message of transientError
+func (e *transientError) Error() string {
+	return "fetch failed"
+}
+
+// Transient returns true if retry may succeed
+func (e *transientError) Transient() bool {
+	return e.transient
+}
+
+// openTestQueue returns pointer of Queue instance of log in temp dir with max leases 3
+func openTestQueue(t *testing.T, dir string) *Queue {
+	q, err := Open(path.Join(dir, "crawl.log"), 3, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return q
+}
+
+// TestQueueReleaseOnClose checks item leased and not finished at graceful shutdown is not failed by max leases
+func TestQueueReleaseOnClose(t *testing.T) {
+	log.SetLevel(log.FatalLevel)
+	dir, err := ioutil.TempDir("", "crawlqueue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q := openTestQueue(t, dir)
+	if err := q.Enqueue(&cm.PageMessage{URL: "https://example.com/1"}, "", 0); err != nil {
+		t.Fatal(err)
+	}
+	q.Close()
+
+	for i := 0; i < 5; i++ {
+		q = openTestQueue(t, dir)
+		item, ok := q.Lease()
+		if !ok {
+			t.Fatalf("item is not redelivered after restart %d", i)
+		}
+		if item.Leases != 1 {
+			t.Fatalf("item leased %d times after restart %d, want 1", item.Leases, i)
+		}
+		q.StopLease()
+		q.Close()
+	}
+}
+
+// TestQueueRetryTransient checks item failed by transient error is leased again until max leases, others are failed
+func TestQueueRetryTransient(t *testing.T) {
+	log.SetLevel(log.FatalLevel)
+	dir, err := ioutil.TempDir("", "crawlqueue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q := openTestQueue(t, dir)
+	defer q.Close()
+	q.Enqueue(&cm.PageMessage{URL: "https://example.com/transient"}, "", 0)
+	q.Enqueue(&cm.PageMessage{URL: "https://example.com/client"}, "", 0)
+
+	item, _ := q.Lease()
+	q.Finish(item.ID, &transientError{transient: true})
+	item, _ = q.Lease()
+	q.Finish(item.ID, errors.New("page not found"))
+	if ready, leased := q.Pending(); ready != 1 || leased != 0 {
+		t.Fatalf("ready %d, leased %d, want transient item ready only", ready, leased)
+	}
+
+	for i := 2; i <= 3; i++ {
+		item, _ = q.Lease()
+		if item.Leases != i {
+			t.Fatalf("item leased %d times, want %d", item.Leases, i)
+		}
+		q.Finish(item.ID, &transientError{transient: true})
+	}
+	if ready, leased := q.Pending(); ready != 0 || leased != 0 {
+		t.Fatalf("ready %d, leased %d, item is not failed after max leases", ready, leased)
+	}
+	if fails := atomic.LoadUint64(&q.FailCounter); fails != 2 {
+		t.Fatalf("failed %d items, want 2", fails)
+	}
+}
@@ -0,0 +1,167 @@
+/*
+  Package queue for intake of page messages, producers are blocked, rejected or spilled to crawl queue when full
+*/
+
+package queue
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/astaxie/beego"
+	log "github.com/sirupsen/logrus"
+
+	cm "siteResService/src/common"
+)
+
+// overflow behaviors of intake when page urls waiting are full
+const (
+	OverflowBlock	= "block"  // wait for room at most intake::timeout seconds, then reject
+	OverflowReject	= "reject"  // reject at once, nsq message is requeued, http request gets 429
+	OverflowSpill	= "spill"  // keep in crawl queue on disk over the bound, needs crawl queue enabled
+)
+
+// ErrIntakeFull returned when page message is rejected for intake is full, producer should retry later
+var ErrIntakeFull = errors.New("intake is full, retry later")
+
+// Intake represents backpressure rules of page messages pushed by nsq, http and sources
+type Intake struct {
+	overflow		string
+	timeout			time.Duration  // max wait of block, negative means forever
+	maxReady		int  // max page urls ready in crawl queue, 0 means no bound
+	WaitCounter		uint64  // calculation num of pushes waited for room, must use by atomic !!!
+	RejectCounter	uint64  // calculation num of pushes rejected, must use by atomic !!!
+	SpillCounter	uint64  // calculation num of pushes kept in crawl queue over the bound, must use by atomic !!!
+}
+
+var intake *Intake
+var initIntakeOnce sync.Once
+
+// GetIntake returns pointer of Intake instance read from app.conf
+func GetIntake() *Intake {
+	initIntakeOnce.Do(func() {
+		intake = &Intake{
+			overflow:	beego.AppConfig.DefaultString("intake::overflow", cm.IntakeOverflow),
+			timeout:	time.Duration(beego.AppConfig.DefaultInt("intake::timeout", cm.IntakeTimeout)) * time.Second,
+			maxReady:	beego.AppConfig.DefaultInt("intake::maxReady", cm.IntakeMaxReady),
+		}
+		switch intake.overflow {
+		case OverflowBlock, OverflowReject:
+		case OverflowSpill:
+			if GetQueue() == nil {
+				log.Error("spill of intake needs crawl queue, block instead")
+				intake.overflow = OverflowBlock
+			}
+		default:
+			log.WithFields(log.Fields{
+				"overflow":	intake.overflow,
+			}).Error("unknown overflow of intake, block instead")
+			intake.overflow = OverflowBlock
+		}
+
+		log.WithFields(log.Fields{
+			"overflow":	intake.overflow,
+			"timeout":	intake.timeout.String(),
+			"maxReady":	intake.maxReady,
+		}).Info("init intake success...")
+	})
+
+	return intake
+}
+
+// Overflow returns overflow behavior of intake
+func (in *Intake) Overflow() string {
+	return in.overflow
+}
+
+// Push returns ErrIntakeFull if message is rejected by overflow behavior, other error if message is not enqueued,
+// message is enqueued to crawl queue, or sent to sub channel if queue is disabled
+func (in *Intake) Push(subChan chan *cm.PageMessage, msg *cm.PageMessage, source string, offset int64) error {
+	if q := GetQueue(); q != nil {
+		if !q.WaitRoom(in.maxReady, 0) {
+			switch in.overflow {
+			case OverflowSpill:
+				atomic.AddUint64(&in.SpillCounter, 1)
+			case OverflowBlock:
+				atomic.AddUint64(&in.WaitCounter, 1)
+				if !q.WaitRoom(in.maxReady, in.timeout) {
+					return in.reject(msg)
+				}
+			default:
+				return in.reject(msg)
+			}
+		}
+
+		return q.Enqueue(msg, source, offset)
+	}
+
+	select {
+	case subChan <- msg:
+		return nil
+	default:
+	}
+	if in.overflow == OverflowReject {
+		return in.reject(msg)
+	}
+
+	atomic.AddUint64(&in.WaitCounter, 1)
+	if in.timeout < 0 {
+		subChan <- msg
+
+		return nil
+	}
+	timer := time.NewTimer(in.timeout)
+	defer timer.Stop()
+	select {
+	case subChan <- msg:
+		return nil
+	case <-timer.C:
+		return in.reject(msg)
+	}
+}
+
+// PushWait returns error if message is not enqueued, it waits for room whatever the overflow behavior,
+// for sources read by service itself such as files and db, reading pauses while intake is full
+func (in *Intake) PushWait(subChan chan *cm.PageMessage, msg *cm.PageMessage, source string, offset int64) error {
+	if q := GetQueue(); q != nil {
+		if !q.WaitRoom(in.maxReady, 0) {
+			atomic.AddUint64(&in.WaitCounter, 1)
+			q.WaitRoom(in.maxReady, -1)  // returns at once if lease stopped, message is kept for restart
+		}
+
+		return q.Enqueue(msg, source, offset)
+	}
+
+	select {
+	case subChan <- msg:
+	default:
+		atomic.AddUint64(&in.WaitCounter, 1)
+		subChan <- msg
+	}
+
+	return nil
+}
+
+// reject returns ErrIntakeFull of message
+func (in *Intake) reject(msg *cm.PageMessage) error {
+	atomic.AddUint64(&in.RejectCounter, 1)
+
+	log.WithFields(log.Fields{
+		"pageURL":	msg.URL,
+		"overflow":	in.overflow,
+	}).Debug("intake is full, reject page url by Push")
+
+	return ErrIntakeFull
+}
+
+// Push returns error if message is rejected or not enqueued by rules of intake
+func Push(subChan chan *cm.PageMessage, msg *cm.PageMessage, source string, offset int64) error {
+	return GetIntake().Push(subChan, msg, source, offset)
+}
+
+// PushWait returns error if message is not enqueued, it waits for room of intake
+func PushWait(subChan chan *cm.PageMessage, msg *cm.PageMessage, source string, offset int64) error {
+	return GetIntake().PushWait(subChan, msg, source, offset)
+}
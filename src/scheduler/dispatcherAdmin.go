@@ -0,0 +1,290 @@
+/*
+  Package scheduler for state of dispatchers, control pools can be created, resized, paused and resumed at runtime
+*/
+
+package scheduler
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gammazero/workerpool"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrNoDispatcher returned when no dispatcher of the name
+var ErrNoDispatcher = errors.New("no dispatcher of this name")
+
+// ErrPoolExists returned when create control pool of a name in use
+var ErrPoolExists = errors.New("dispatcher of this name exists")
+
+// ErrNotControl returned when resize dispatcher which is not a control pool
+var ErrNotControl = errors.New("dispatcher is not a control pool")
+
+// ErrBadSize returned when size of pool is not positive
+var ErrBadSize = errors.New("size of pool must be positive")
+
+// throughputWindow for seconds of tasks counted in throughput
+const throughputWindow = 60
+
+// meter represents num of tasks done in each second of last throughputWindow seconds
+type meter struct {
+	lock	sync.Mutex
+	counts	[throughputWindow]uint64
+	seconds	[throughputWindow]int64  // unix second of counts, count is stale if not in window
+}
+
+// mark for count one task done at now
+func (m *meter) mark(now time.Time) {
+	sec := now.Unix()
+	i := sec % throughputWindow
+
+	m.lock.Lock()
+	if m.seconds[i] != sec {
+		m.seconds[i] = sec
+		m.counts[i] = 0
+	}
+	m.counts[i]++
+	m.lock.Unlock()
+}
+
+// rate returns tasks done per second in last throughputWindow seconds before now
+func (m *meter) rate(now time.Time) float64 {
+	sec := now.Unix()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var sum uint64
+	for i := range m.counts {
+		if sec - m.seconds[i] < throughputWindow {
+			sum += m.counts[i]
+		}
+	}
+
+	return float64(sum) / throughputWindow
+}
+
+// acquire returns true when a worker is free and dispatcher not paused, false if scheduler quit
+func (d *dispatcher) acquire(s *Scheduler) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for d.paused || d.active >= d.size {
+		select {
+		case <-s.quit:
+			return false
+		default:
+		}
+		d.free.Wait()
+	}
+	d.active++
+
+	return true
+}
+
+// release for free a worker taken by acquire
+func (d *dispatcher) release() {
+	d.lock.Lock()
+	d.active--
+	d.free.Signal()
+	d.lock.Unlock()
+}
+
+// DispatcherInfo represents state of dispatchers of one name
+type DispatcherInfo struct {
+	Name		string			`json:"name"`
+	Control		bool			`json:"control"`  // control pool, can be resized
+	Dispatchers	int				`json:"dispatchers"`  // num of dispatchers of the name, DefaultName has "scheduler::channelNum"
+	Size		int				`json:"size"`  // max tasks running at the same time of each dispatcher
+	Active		int				`json:"active"`  // tasks running
+	Paused		bool			`json:"paused"`
+	Waiting		int				`json:"waiting"`  // tasks waiting to run
+	Depth		map[int]int		`json:"depth"`  // tasks waiting of each priority
+	Pending		int64			`json:"pending"`  // tasks added but not done
+	Throughput	float64			`json:"throughput"`  // tasks done per second in last minute
+	Stats		TaskStats		`json:"stats"`  // tasks done since started
+}
+
+// Dispatchers returns state of dispatchers of each name, ordered by name
+func (s *Scheduler) Dispatchers() []DispatcherInfo {
+	now := time.Now()
+	infos := make(map[string]*DispatcherInfo)
+	s.rangeDispatchers(func(d *dispatcher) {
+		info, ok := infos[d.name]
+		if !ok {
+			info = &DispatcherInfo{Name: d.name, Control: d.ctrl, Depth: make(map[int]int)}
+			infos[d.name] = info
+		}
+
+		d.lock.Lock()
+		info.Dispatchers++
+		info.Size = d.size
+		info.Paused = d.paused
+		info.Waiting += d.queue.Len() + d.pool.WaitingQueueSize()
+		for priority, num := range d.depth {
+			info.Depth[priority] += num
+		}
+		d.lock.Unlock()
+
+		info.Active += int(atomic.LoadInt64(&d.running))
+		info.Pending += atomic.LoadInt64(&d.pending)
+		info.Throughput += d.meter.rate(now)
+		info.Stats.Succeeded += atomic.LoadUint64(&d.succeeded)
+		info.Stats.Failed += atomic.LoadUint64(&d.failed)
+		info.Stats.Panicked += atomic.LoadUint64(&d.panicked)
+		info.Stats.Expired += atomic.LoadUint64(&d.expired)
+	})
+
+	list := make([]DispatcherInfo, 0, len(infos))
+	for _, info := range infos {
+		list = append(list, *info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
+
+// initPools for create control pools by "name=size" split by ",", illegal items are skipped
+func initPools(s *Scheduler, conf string) {
+	for _, item := range strings.Split(conf, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 || len(kv[0]) <= 0 {
+			continue
+		}
+
+		name := strings.TrimSpace(kv[0])
+		size, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err == nil {
+			err = s.CreatePool(name, size)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"pool":		item,
+				"error":	err.Error(),
+			}).Error("create control pool failed by initPools")
+		}
+	}
+}
+
+// PoolSize returns size of control pool of name, num if not created yet
+func (s *Scheduler) PoolSize(name string, num int) int {
+	v, ok := s.dispatcherCtrlMap.Load(name)
+	if !ok {
+		return num
+	}
+	d := v.(*dispatcher)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.size
+}
+
+// namedDispatchers returns dispatchers of the name, ErrNoDispatcher if none
+func (s *Scheduler) namedDispatchers(name string) ([]*dispatcher, error) {
+	var list []*dispatcher
+	s.rangeDispatchers(func(d *dispatcher) {
+		if d.name == name {
+			list = append(list, d)
+		}
+	})
+	if len(list) <= 0 {
+		return nil, ErrNoDispatcher
+	}
+
+	return list, nil
+}
+
+// CreatePool returns error if control pool of the name exists, tasks whose CtrlInfo.Name is the name run in it
+func (s *Scheduler) CreatePool(name string, size int) error {
+	if size <= 0 {
+		return ErrBadSize
+	}
+	if name == DefaultName {
+		return ErrPoolExists
+	}
+	if _, ok := s.dispatcherCtrlMap.Load(name); ok {
+		return ErrPoolExists
+	}
+
+	if _, created := s.initDispatcherCtrlMap(name, size); !created {  // created by a task at the same time
+		return ErrPoolExists
+	}
+
+	return nil
+}
+
+// ResizePool returns error if no control pool of the name, tasks running over new size finish,
+// then at most size tasks run at the same time
+func (s *Scheduler) ResizePool(name string, size int) error {
+	if size <= 0 {
+		return ErrBadSize
+	}
+	v, ok := s.dispatcherCtrlMap.Load(name)
+	if !ok {
+		if _, err := s.namedDispatchers(name); err == nil {
+			return ErrNotControl
+		}
+
+		return ErrNoDispatcher
+	}
+	d := v.(*dispatcher)
+
+	d.lock.Lock()
+	old := d.size
+	if size != old {
+		d.size = size
+		pool := d.pool
+		d.pool = workerpool.New(size)
+		go pool.StopWait()  // tasks submitted to old pool keep running
+		d.free.Broadcast()
+	}
+	d.lock.Unlock()
+
+	log.WithFields(log.Fields{
+		"name":		name,
+		"from":		old,
+		"to":		size,
+	}).Info("resize control pool")
+
+	return nil
+}
+
+// Pause returns error if no dispatcher of the name, tasks added are kept in queue until resumed,
+// tasks running keep running, DefaultName pauses all dispatchers of tasks which do not need control
+func (s *Scheduler) Pause(name string) error {
+	return s.setPaused(name, true)
+}
+
+// Resume returns error if no dispatcher of the name, tasks kept in queue start to run
+func (s *Scheduler) Resume(name string) error {
+	return s.setPaused(name, false)
+}
+
+// setPaused returns error if no dispatcher of the name
+func (s *Scheduler) setPaused(name string, paused bool) error {
+	list, err := s.namedDispatchers(name)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range list {
+		d.lock.Lock()
+		d.paused = paused
+		d.free.Broadcast()
+		d.lock.Unlock()
+	}
+
+	log.WithFields(log.Fields{
+		"name":		name,
+		"paused":	paused,
+	}).Info("set dispatcher paused")
+
+	return nil
+}
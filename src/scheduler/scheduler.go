@@ -6,6 +6,7 @@ package scheduler
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 	"math/rand"
 
@@ -32,14 +33,35 @@ type ControlInfo struct {
 type Task struct {
 	CtrlInfo	*ControlInfo  // for control task
 	Data   		*DataBlock  // data to do in the task
-	DoTask 		func(*DataBlock)  // do task function
+	DoTask 		func(*DataBlock) error  // do task function, returned error counts task failed
+	OnDone		func(*DataBlock, error)  // called when task done, expired or dropped, error is *PanicError if DoTask panicked
+	Priority	int  // higher is served first, PriorityNormal by default
+	Deadline	time.Time  // task is not run if not started before, zero means no deadline
+	OnExpired	func(*DataBlock)  // called instead of DoTask if deadline passed, task is dropped if nil
 }
 
 // dispatcher represents  one dispatcher of scheduler
 type dispatcher struct {
-	ctrlQueueNum	chan bool  // control the num of input into routine pool
-	channel 		chan Task
-	pool    		*workerpool.WorkerPool
+	name			string  // control name, DefaultName if not control
+	ctrl			bool  // control dispatcher, can be resized
+	size			int  // max tasks running at the same time, task is taken from queue when a worker is free
+	active			int  // num of workers taken, including the one waiting for task from queue
+	running			int64  // num of tasks running, must use by atomic !!!
+	paused			bool  // tasks are kept in queue while paused
+	lock			sync.Mutex  // for queue, depth, size, active, paused and pool
+	space			*sync.Cond  // signaled when task taken from queue
+	free			*sync.Cond  // signaled when worker freed, size changed or resumed
+	notify			chan struct{}  // signaled when task added to queue
+	queue			taskHeap  // tasks waiting, ordered by priority with aging
+	depth			map[int]int  // num of tasks waiting of each priority
+	seq				uint64
+	pool    		*workerpool.WorkerPool  // replaced by a new one of new size when resized
+	meter			meter  // tasks done in last seconds
+	pending			int64  // num of tasks added but not done, must use by atomic !!!
+	succeeded		uint64  // num of tasks DoTask returned nil, must use by atomic !!!
+	failed			uint64  // num of tasks DoTask returned error, must use by atomic !!!
+	panicked		uint64  // num of tasks DoTask panicked, must use by atomic !!!
+	expired			uint64  // num of tasks deadline passed before run, must use by atomic !!!
 }
 
 // Scheduler represents scheduler struct.
@@ -47,8 +69,27 @@ type Scheduler struct {
 	name       			string
 	dispatcherMap 		sync.Map  // for dispatch all except ctrl task
 	dispatcherCtrlMap	sync.Map  // for need control dispatch task number
+	ctrlLock			sync.Mutex  // for init dispatcher control once
+	closeLock			sync.RWMutex  // closed is changed by write lock, tasks are counted by read lock
+	closed				bool  // tasks added after closed are dropped
+	quit				chan struct{}  // stop all dispatchers
+	deferred			int64  // num of tasks waiting to be added by AddTaskAfter, must use by atomic !!!
+	started				time.Time  // base of waited time of tasks
+	aging				time.Duration  // waited time which raises task one priority level
+	queueSize			int  // max tasks waiting of one priority in one dispatcher, 0 means no limit
+	DropCounter			uint64  // calculation num of tasks dropped after closed, must use by atomic !!!
+	ExpireCounter		uint64  // calculation num of tasks not run for deadline passed, must use by atomic !!!
 }
 
+// DefaultName for name of dispatchers of tasks which do not need control
+const DefaultName = "default"
+
+// DeferredName for name of tasks waiting to be added in unfinished of Drain
+const DeferredName = "deferred"
+
+// drainGap for interval of checking tasks done while draining
+const drainGap = 100 * time.Millisecond
+
 var scheduler *Scheduler
 var once sync.Once
 var dispatcherNumber int
@@ -65,13 +106,24 @@ func GetScheduler() *Scheduler {
 	return scheduler
 }
 
+// newDispatcher returns pointer of dispatcher which runs num tasks at most at the same time
+func newDispatcher(name string, num int) *dispatcher {
+	d := new(dispatcher)
+	d.name = name
+	d.size = num  // control the num of input into routine pool
+	d.space = sync.NewCond(&d.lock)
+	d.free = sync.NewCond(&d.lock)
+	d.notify = make(chan struct{}, 1)
+	d.depth = make(map[int]int)
+	d.pool = workerpool.New(num)
+
+	return d
+}
+
 // initDispatcherMap for Initialization dispatchers
 func initDispatcherMap(s *Scheduler) {
 	for i := 0; i < dispatcherNumber; i++ {
-		d := new(dispatcher)
-		d.channel = make(chan Task, 1)
-		d.pool = workerpool.New(taskQueueSize)
-		s.dispatcherMap.Store(i, d)
+		s.dispatcherMap.Store(i, newDispatcher(DefaultName, taskQueueSize))
 	}
 }
 
@@ -83,44 +135,52 @@ func newScheduler() *Scheduler {
 	scheduler = new(Scheduler)
 
 	scheduler.name = "scheduler1"
+	scheduler.quit = make(chan struct{})
+	scheduler.started = time.Now()
+	scheduler.aging = time.Duration(beego.AppConfig.DefaultInt("scheduler::aging", cm.SchedulerAging)) * time.Second
+	if scheduler.aging <= 0 {  // strict priority
+		scheduler.aging = time.Duration(1 << 40)
+	}
+	scheduler.queueSize = beego.AppConfig.DefaultInt("scheduler::queueSize", cm.SchedulerQueueSize)
 	//scheduler.dispatcherMap = make(map[int]*dispatcher)
 
 	initDispatcherMap(scheduler)
 	startGoList(scheduler)
+	initPools(scheduler, beego.AppConfig.DefaultString("scheduler::pools", cm.SchedulerPools))
 
 	log.WithFields(log.Fields{
 		"name":				"scheduler1",
 		"dispatcherNum":	dispatcherNumber,
 		"poolNum":			taskQueueSize,
+		"aging":			scheduler.aging.String(),
+		"queueSize":		scheduler.queueSize,
 	}).Info("scheduler init success...")
 
 	return scheduler
 }
 
-// initDispatcherCtrlMap for Initialization dispatcherCtrls
-func (s *Scheduler) initDispatcherCtrlMap(name string, num int) *dispatcher {
-	d := new(dispatcher)
-	d.ctrlQueueNum = make(chan bool, num)  // control the num of input into routine pool
-	d.channel = make(chan Task, 1)
-	d.pool = workerpool.New(num)
+// initDispatcherCtrlMap for Initialization dispatcherCtrls, returns the existing one and false if inited by others
+func (s *Scheduler) initDispatcherCtrlMap(name string, num int) (*dispatcher, bool) {
+	s.ctrlLock.Lock()
+	defer s.ctrlLock.Unlock()
+
+	if d, ok := s.dispatcherCtrlMap.Load(name); ok {
+		return d.(*dispatcher), false
+	}
+
+	d := newDispatcher(name, num)
+	d.ctrl = true
 	s.dispatcherCtrlMap.Store(name, d)
 
 	// make dispatcher running
-	go func(d *dispatcher) {
-		for {
-			select {
-			case task := <-d.channel:
-				d.ctrlDoTask(task)
-			}
-		}
-	}(d)
+	go d.run(s)
 
 	log.WithFields(log.Fields{
 		"name":		name,
 		"poolNum":	num,
 	}).Info("dispatcher control init success...")
 
-	return d
+	return d, true
 }
 
 // startGoList for start go channel list
@@ -135,84 +195,252 @@ func startGoList(s *Scheduler) {
 
 			continue
 		}
-		go func(d *dispatcher) {
-			for {
-				select {
-				case task := <-d.channel:
-					d.doTask(task)
-				}
-			}
-		}(d.(*dispatcher))
+		go d.(*dispatcher).run(s)
 	}
 
 	log.Info("all scheduler task channels has started...")
 }
 
-// doTask for run task DoTask function by routine pool
-func (d *dispatcher) doTask(task Task) {
-	t := task
-	d.pool.Submit(func() {
-		if t.DoTask != nil {
-			t.DoTask(t.Data)
+// run for take task served next when a worker of routine pool is free, and run its DoTask function by pool,
+// panic of DoTask is recovered, task whose deadline passed is expired instead, returns when scheduler quit
+func (d *dispatcher) run(s *Scheduler) {
+	for {
+		// wait for a free worker, tasks keep ordered in queue instead of pool
+		if !d.acquire(s) {
+			return
 		}
-	})
-}
 
-// ctrlDoTask for run task DoTask function by controlled routine pool num
-func (d *dispatcher) ctrlDoTask(task Task) {
-	d.ctrlQueueNum <- true
+		task, ok := d.pop(s)
+		if !ok {
+			d.release()
 
-	t := task
-	ctrlQueue := &(d.ctrlQueueNum)
-	d.pool.Submit(func() {
-		if t.DoTask != nil {
-			t.DoTask(t.Data)
+			return
 		}
 
-		<- *ctrlQueue
-	})
+		t := task
+		expired := !t.Deadline.IsZero() && time.Now().After(t.Deadline)
+		d.lock.Lock()
+		pool := d.pool
+		d.lock.Unlock()
+		pool.Submit(func() {
+			atomic.AddInt64(&d.running, 1)
+			defer atomic.AddInt64(&d.pending, -1)
+			defer d.release()
+			defer atomic.AddInt64(&d.running, -1)
+			defer d.meter.mark(time.Now())
+
+			if expired {
+				s.expire(d, t)
+
+				return
+			}
+			s.runTask(d, t)
+		})
+	}
+}
+
+// expire for drop task whose deadline passed before run, OnExpired is called to fail it if set, then OnDone by ErrExpired
+func (s *Scheduler) expire(d *dispatcher, task Task) {
+	atomic.AddUint64(&s.ExpireCounter, 1)
+	atomic.AddUint64(&d.expired, 1)
+	defer s.done(d, task, ErrExpired)
+
+	log.WithFields(log.Fields{
+		"name":		d.name,
+		"priority":	task.Priority,
+		"deadline":	task.Deadline,
+		"message":	task.Data,
+	}).Warn("deadline of task passed, do not run it by expire")
+
+	if task.OnExpired != nil {
+		defer func() {
+			if r := recover(); r != nil {
+				log.WithFields(log.Fields{
+					"name":		d.name,
+					"message":	task.Data,
+					"panic":	r,
+				}).Error("OnExpired of task panicked, recover it by expire")
+			}
+		}()
+		task.OnExpired(task.Data)
+	}
 }
 
-// GetPoolWaitingQueueSize for pool waitingQueue size, use for debug
+// waiting returns num of tasks waiting in queue and pool of dispatcher
+func (d *dispatcher) waiting() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.queue.Len() + d.pool.WaitingQueueSize()
+}
+
+// GetPoolWaitingQueueSize for num of tasks waiting in dispatchers, use for debug
 func (s *Scheduler) GetPoolWaitingQueueSize() int {
 	var counter int
 	for i := 0; i < dispatcherNumber; i++ {
 		d, ok := s.dispatcherMap.Load(i)
 		if ok {
-			counter += d.(*dispatcher).pool.WaitingQueueSize()
+			counter += d.(*dispatcher).waiting()
 		}
 	}
 
 	return counter
 }
 
-// GetCtrlPoolWaitingQueueSize for control pool waitingQueue size, use for debug
+// GetCtrlPoolWaitingQueueSize for num of tasks waiting in control dispatcher, use for debug
 func (s *Scheduler) GetCtrlPoolWaitingQueueSize(name string) int {
 	var counter int
 	d, ok := s.dispatcherCtrlMap.Load(name)
 	if ok {
-		counter += d.(*dispatcher).pool.WaitingQueueSize()
+		counter += d.(*dispatcher).waiting()
 	}
 
 	return counter
 }
 
+// QueueDepth returns num of tasks waiting of each priority of each dispatcher name
+func (s *Scheduler) QueueDepth() map[string]map[int]int {
+	depth := make(map[string]map[int]int)
+	s.rangeDispatchers(func(d *dispatcher) {
+		if depth[d.name] == nil {
+			depth[d.name] = make(map[int]int)
+		}
+
+		d.lock.Lock()
+		for priority, num := range d.depth {
+			depth[d.name][priority] += num
+		}
+		d.lock.Unlock()
+	})
+
+	return depth
+}
+
 // TODO: need to be think, how to effectively select the channel with the largest space
-// AddTask return true if adding task to a random channel success
+// AddTask for add task to a random dispatcher or its control dispatcher, blocks while tasks of its priority are full,
+// task is dropped and OnDone called by ErrClosed if scheduler is closed by Drain, priority is clamped by ClampPriority
 func (s *Scheduler) AddTask(task Task) {
+	task.Priority = ClampPriority(task.Priority)
+
+	var d *dispatcher
 	ctrl := task.CtrlInfo
 	if ctrl == nil {  // if task do not need  control running number, use this dispatcher
 		rand.Seed(time.Now().UnixNano())
 		index := rand.Intn(dispatcherNumber)
-		d, ok := s.dispatcherMap.Load(index%dispatcherNumber)
-		if ok {
-			d.(*dispatcher).channel <- task  //if this scheduler channel is full, then block, for not process more data
+		v, ok := s.dispatcherMap.Load(index%dispatcherNumber)
+		if !ok {
+			return
 		}
+		d = v.(*dispatcher)
 	} else {  // if task is need control running number, use this specified dispatcherCtrl
-		d, ok := s.dispatcherCtrlMap.Load(ctrl.Name)
+		v, ok := s.dispatcherCtrlMap.Load(ctrl.Name)
 		if !ok {
-			d = s.initDispatcherCtrlMap(ctrl.Name, ctrl.CtrlNum)
+			v, _ = s.initDispatcherCtrlMap(ctrl.Name, ctrl.CtrlNum)
+		}
+		d = v.(*dispatcher)
+	}
+
+	// count task before closed, so Drain never stops a dispatcher which has task to do
+	s.closeLock.RLock()
+	if s.closed {
+		s.closeLock.RUnlock()
+		atomic.AddUint64(&s.DropCounter, 1)
+
+		log.WithFields(log.Fields{
+			"name":		d.name,
+			"message":	task.Data,
+		}).Warn("scheduler is closed, drop task by AddTask")
+		s.done(d, task, ErrClosed)
+
+		return
+	}
+	atomic.AddInt64(&d.pending, 1)
+	s.closeLock.RUnlock()
+
+	//if tasks of this priority are full, then block, for not process more data
+	d.lock.Lock()
+	d.push(s, task)
+	d.lock.Unlock()
+}
+
+// AddTaskAfter for add task after wait, task is counted by Drain while waiting
+func (s *Scheduler) AddTaskAfter(wait time.Duration, task Task) {
+	atomic.AddInt64(&s.deferred, 1)
+	time.AfterFunc(wait, func() {
+		s.AddTask(task)
+		atomic.AddInt64(&s.deferred, -1)
+	})
+}
+
+// rangeDispatchers for call f with every dispatcher
+func (s *Scheduler) rangeDispatchers(f func(d *dispatcher)) {
+	each := func(key, value interface{}) bool {
+		f(value.(*dispatcher))
+
+		return true
+	}
+	s.dispatcherMap.Range(each)
+	s.dispatcherCtrlMap.Range(each)
+}
+
+// Unfinished returns num of tasks not done of each dispatcher name, names without task are not included
+func (s *Scheduler) Unfinished() map[string]int64 {
+	unfinished := make(map[string]int64)
+	s.rangeDispatchers(func(d *dispatcher) {
+		if pending := atomic.LoadInt64(&d.pending); pending > 0 {
+			unfinished[d.name] += pending
 		}
-		d.(*dispatcher).channel <- task  //if this scheduler channel is full, then block, for not process more data
+	})
+	if deferred := atomic.LoadInt64(&s.deferred); deferred > 0 {
+		unfinished[DeferredName] = deferred
+	}
+
+	return unfinished
+}
+
+// Drain returns num of tasks unfinished of each dispatcher name, it waits until all tasks done or timeout,
+// tasks added by running tasks are waited too, paused dispatchers are resumed to drain their tasks,
+// then scheduler is closed and tasks added later are dropped, dispatchers and pools are stopped if all tasks done
+func (s *Scheduler) Drain(timeout time.Duration) map[string]int64 {
+	deadline := time.Now().Add(timeout)
+	s.rangeDispatchers(func(d *dispatcher) {  // tasks kept by paused dispatchers drain too
+		d.lock.Lock()
+		d.paused = false
+		d.free.Broadcast()
+		d.lock.Unlock()
+	})
+	unfinished := s.Unfinished()
+	for len(unfinished) > 0 && time.Now().Before(deadline) {
+		time.Sleep(drainGap)
+		unfinished = s.Unfinished()
+	}
+
+	s.closeLock.Lock()
+	if s.closed {
+		s.closeLock.Unlock()
+
+		return unfinished
 	}
+	s.closed = true
+	s.closeLock.Unlock()
+
+	// tasks may be added before closed
+	unfinished = s.Unfinished()
+	if len(unfinished) <= 0 {
+		close(s.quit)
+		s.rangeDispatchers(func(d *dispatcher) {
+			d.lock.Lock()
+			d.free.Broadcast()  // dispatcher waiting for worker returns
+			pool := d.pool
+			d.lock.Unlock()
+			pool.Stop()
+		})
+	}
+
+	log.WithFields(log.Fields{
+		"name":			s.name,
+		"unfinished":	unfinished,
+	}).Info("scheduler drained")
+
+	return unfinished
 }
@@ -0,0 +1,148 @@
+/*
+  Package scheduler for tasks waiting in dispatcher, ordered by priority with aging
+*/
+
+package scheduler
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// priorities of tasks, higher is served first, priority out of PriorityLow and PriorityHigh is served as the bound
+const (
+	PriorityLow		= -10  // backfill of source file or db
+	PriorityNormal	= 0  // events and crawl requests
+	PriorityHigh	= 10  // interactive api
+)
+
+// ErrBadPriority returned when priority of request is out of PriorityLow and PriorityHigh
+var ErrBadPriority = errors.New("priority is out of range")
+
+// CheckPriority returns ErrBadPriority if priority is out of PriorityLow and PriorityHigh
+func CheckPriority(priority int) error {
+	if priority < PriorityLow || priority > PriorityHigh {
+		return fmt.Errorf("%w: %d not in [%d, %d]", ErrBadPriority, priority, PriorityLow, PriorityHigh)
+	}
+
+	return nil
+}
+
+// ClampPriority returns priority bounded by PriorityLow and PriorityHigh,
+// so tasks waiting and metrics are kept per a few priorities only
+func ClampPriority(priority int) int {
+	if priority > PriorityHigh {
+		return PriorityHigh
+	} else if priority < PriorityLow {
+		return PriorityLow
+	}
+
+	return priority
+}
+
+// queuedTask represents task waiting in dispatcher
+type queuedTask struct {
+	task		Task
+	rank		int64  // priority raised by waited time, higher is served first
+	seq			uint64  // order of adding, earlier is served first if same rank
+}
+
+// taskHeap represents tasks waiting, implements heap.Interface
+type taskHeap []*queuedTask
+
+func (h taskHeap) Len() int { return len(h) }
+
+func (h taskHeap) Less(i, j int) bool {
+	if h[i].rank != h[j].rank {
+		return h[i].rank > h[j].rank
+	}
+
+	return h[i].seq < h[j].seq
+}
+
+func (h taskHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *taskHeap) Push(x interface{}) { *h = append(*h, x.(*queuedTask)) }
+
+func (h *taskHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+
+	return x
+}
+
+// rankOf returns rank of task added at elapsed since scheduler started, a task waited aging longer
+// is served like one level higher, so low priority tasks are not starved
+func rankOf(priority int, elapsed time.Duration, aging time.Duration) int64 {
+	return int64(ClampPriority(priority)) * int64(aging) - int64(elapsed)
+}
+
+// push for add task to waiting queue of dispatcher, blocks while its priority is full, must hold lock
+func (d *dispatcher) push(s *Scheduler, task Task) {
+	for s.queueSize > 0 && d.depth[task.Priority] >= s.queueSize {
+		d.space.Wait()
+	}
+
+	d.seq++
+	heap.Push(&d.queue, &queuedTask{
+		task:	task,
+		rank:	rankOf(task.Priority, time.Since(s.started), s.aging),
+		seq:	d.seq,
+	})
+	d.depth[task.Priority]++
+
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+}
+
+// pop returns task served next, blocks until a task is added, false if scheduler quit
+func (d *dispatcher) pop(s *Scheduler) (Task, bool) {
+	for {
+		d.lock.Lock()
+		if d.queue.Len() > 0 {
+			qt := heap.Pop(&d.queue).(*queuedTask)
+			if d.depth[qt.task.Priority]--; d.depth[qt.task.Priority] <= 0 {
+				delete(d.depth, qt.task.Priority)
+			}
+			d.space.Broadcast()
+			d.lock.Unlock()
+
+			return qt.task, true
+		}
+		d.lock.Unlock()
+
+		select {
+		case <-d.notify:
+		case <-s.quit:
+			return Task{}, false
+		}
+	}
+}
+
+// Room returns num of tasks of priority can be added to control pool of name without blocking, -1 if no limit
+func (s *Scheduler) Room(name string, priority int) int {
+	if s.queueSize <= 0 {
+		return -1
+	}
+	v, ok := s.dispatcherCtrlMap.Load(name)
+	if !ok {
+		return s.queueSize
+	}
+	d := v.(*dispatcher)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if room := s.queueSize - d.depth[ClampPriority(priority)]; room > 0 {
+		return room
+	}
+
+	return 0
+}
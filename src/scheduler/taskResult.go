@@ -0,0 +1,166 @@
+/*
+  Package scheduler for result of tasks, panics are recovered and errors are counted per dispatcher
+*/
+
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrClosed passed to OnDone when task is dropped for scheduler closed by Drain
+var ErrClosed = errors.New("scheduler is closed, task is dropped")
+
+// ErrExpired passed to OnDone when deadline of task passed before run
+var ErrExpired = errors.New("deadline of task passed before run")
+
+// ErrWaitTimeout returned by Future.Wait if task is not done in timeout
+var ErrWaitTimeout = errors.New("task is not done in timeout")
+
+// PanicError represents panic recovered from DoTask
+type PanicError struct {
+	Value	interface{}  // value passed to panic
+	Stack	string  // stack of the panicked routine
+}
+
+// Error returns value of panic
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task panicked: %v", e.Value)
+}
+
+// IsPanic returns true if err is or wraps *PanicError
+func IsPanic(err error) bool {
+	var pe *PanicError
+
+	return errors.As(err, &pe)
+}
+
+// TaskStats represents num of tasks done of dispatchers of one name since started
+type TaskStats struct {
+	Succeeded	uint64	`json:"succeeded"`
+	Failed		uint64	`json:"failed"`  // DoTask returned error
+	Panicked	uint64	`json:"panicked"`
+	Expired		uint64	`json:"expired"`
+}
+
+// Future represents result of task added by AddTaskFuture
+type Future struct {
+	done	chan struct{}
+	err		error
+}
+
+// Done returns channel closed when task is done, expired or dropped
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Err returns error of task, nil if succeeded or not done yet
+func (f *Future) Err() error {
+	select {
+	case <-f.done:
+		return f.err
+	default:
+		return nil
+	}
+}
+
+// Wait returns error of task after it is done, ErrWaitTimeout if not done in timeout, timeout <= 0 waits forever
+func (f *Future) Wait(timeout time.Duration) error {
+	if timeout <= 0 {
+		<-f.done
+
+		return f.err
+	}
+
+	select {
+	case <-f.done:
+		return f.err
+	case <-time.After(timeout):
+		return ErrWaitTimeout
+	}
+}
+
+// AddTaskFuture returns future of task, it is done after OnDone of task called
+func (s *Scheduler) AddTaskFuture(task Task) *Future {
+	f := &Future{done: make(chan struct{})}
+	onDone := task.OnDone
+	task.OnDone = func(data *DataBlock, err error) {
+		if onDone != nil {
+			onDone(data, err)
+		}
+		f.err = err
+		close(f.done)
+	}
+	s.AddTask(task)
+
+	return f
+}
+
+// runTask for run DoTask of task, panic is recovered as *PanicError, result is counted and passed to OnDone
+func (s *Scheduler) runTask(d *dispatcher, task Task) {
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: string(debug.Stack())}
+			atomic.AddUint64(&d.panicked, 1)
+
+			log.WithFields(log.Fields{
+				"name":		d.name,
+				"message":	task.Data,
+				"panic":	r,
+				"stack":	err.(*PanicError).Stack,
+			}).Error("task panicked, recover it by runTask")
+		} else if err != nil {
+			atomic.AddUint64(&d.failed, 1)
+		} else {
+			atomic.AddUint64(&d.succeeded, 1)
+		}
+
+		s.done(d, task, err)
+	}()
+
+	if task.DoTask != nil {
+		err = task.DoTask(task.Data)
+	}
+}
+
+// done for call OnDone of task, panic of OnDone is recovered and logged
+func (s *Scheduler) done(d *dispatcher, task Task, err error) {
+	if task.OnDone == nil {
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.WithFields(log.Fields{
+				"name":		d.name,
+				"message":	task.Data,
+				"panic":	r,
+				"stack":	string(debug.Stack()),
+			}).Error("OnDone of task panicked, recover it by done")
+		}
+	}()
+
+	task.OnDone(task.Data, err)
+}
+
+// Stats returns num of tasks done of each dispatcher name since started
+func (s *Scheduler) Stats() map[string]TaskStats {
+	stats := make(map[string]TaskStats)
+	s.rangeDispatchers(func(d *dispatcher) {
+		st := stats[d.name]
+		st.Succeeded += atomic.LoadUint64(&d.succeeded)
+		st.Failed += atomic.LoadUint64(&d.failed)
+		st.Panicked += atomic.LoadUint64(&d.panicked)
+		st.Expired += atomic.LoadUint64(&d.expired)
+		stats[d.name] = st
+	})
+
+	return stats
+}
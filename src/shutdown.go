@@ -0,0 +1,161 @@
+/*
+  Package main, graceful shutdown on SIGINT or SIGTERM.
+*/
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/astaxie/beego"
+	log "github.com/sirupsen/logrus"
+
+	cm "siteResService/src/common"
+	sc "siteResService/src/scheduler"
+)
+
+// waitSignal for shutdown server on SIGINT or SIGTERM, a second signal exits at once
+func waitSignal() {
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+
+	sig := <-ch
+	log.WithFields(log.Fields{
+		"signal":	sig.String(),
+	}).Info("receive signal, shutdown gracefully")
+
+	go func() {
+		sig := <-ch
+		log.WithFields(log.Fields{
+			"signal":	sig.String(),
+		}).Warn("receive signal again, exit at once")
+		os.Exit(1)
+	}()
+
+	os.Exit(shutdown())
+}
+
+// remaining returns time left before deadline, 0 if passed
+func remaining(deadline time.Time) time.Duration {
+	if left := time.Until(deadline); left > 0 {
+		return left
+	}
+
+	return 0
+}
+
+// flushResults returns num of results left in channel after dispatch stopped and num of them not published before ctx done,
+// they are saved and published at once
+func flushResults(ctx context.Context) (int, int) {
+	var num, unpublished int
+	for {
+		select {
+		case msg := <-server.task.ResChan:
+			num++
+			server.standalone.TaskSaveResultToFile(&sc.DataBlock{Message: msg.Info})
+			if server.runType != cm.RunTypeMicro {
+				continue
+			}
+			if err := server.micro.PublishResultContext(ctx, msg); err != nil {
+				unpublished++
+
+				log.WithFields(log.Fields{
+					"id":		msg.ID,
+					"pageURL":	msg.Info.PageURL,
+					"error":	err.Error(),
+				}).Warn("parse result is not published before shutdown")
+			}
+		default:
+			return num, unpublished
+		}
+	}
+}
+
+// unscheduledURLs returns page urls received but not added to scheduler
+func unscheduledURLs() []string {
+	var urls []string
+	for {
+		select {
+		case msg := <-server.subChan:
+			urls = append(urls, msg.URL)
+		default:
+			return urls
+		}
+	}
+}
+
+// shutdown returns exit code, 1 if any task, result or callback unfinished, page urls kept in crawl queue are not counted,
+// intake stops first, then tasks drain, results flush and web driver quits, all within shutdown::timeout
+func shutdown() int {
+	timeout := time.Duration(beego.AppConfig.DefaultInt("shutdown::timeout", cm.ShutdownTimeout)) * time.Second
+	started := time.Now()
+	deadline := started.Add(timeout)
+
+	// stop intake of nsq, rpc, http and db or file sources
+	server.micro.StopIntake()
+	server.standalone.Stop()
+	if server.queue != nil {
+		server.queue.StopLease()
+	}
+
+	// schedule keeps adding pages left in channel and dispatch keeps adding results of running tasks while draining
+	unfinished := server.scheduler.Drain(timeout)
+
+	close(server.quit)
+	<-server.dispatched
+	select {
+	case <-server.scheduled:
+	case <-time.After(remaining(deadline)):  // parse task waiting for room of its priority is dropped by closed scheduler
+		log.Warn("schedule of page messages is not stopped in time")
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	flushed, unpublished := flushResults(ctx)
+	cancel()
+	unscheduled := unscheduledURLs()
+	for _, pageURL := range unscheduled {
+		log.WithFields(log.Fields{
+			"pageURL":	pageURL,
+		}).Warn("page url is not scheduled before shutdown")
+	}
+
+	// flush result sinks, broker is disconnected after results published
+	callbacks := server.task.Webhook().Wait(remaining(deadline))
+	server.standalone.CloseFileTGT()
+	server.micro.Stop(remaining(deadline))
+	server.http.QuitWebDriver()
+
+	// page urls not finished are kept in crawl queue and redelivered on restart
+	var ready, leased int
+	if server.queue != nil {
+		ready, leased = server.queue.Pending()
+		server.queue.Close()
+	}
+
+	dropped := atomic.LoadUint64(&server.scheduler.DropCounter)
+	var tasks int64
+	for _, num := range unfinished {
+		tasks += num
+	}
+
+	log.WithFields(log.Fields{
+		"elapsed":				time.Since(started).String(),
+		"unfinishedTasks":		unfinished,
+		"droppedTasks":			dropped,
+		"flushedResults":		flushed,
+		"unpublishedResults":	unpublished,
+		"unscheduledURLs":		len(unscheduled),
+		"unsentCallbacks":		callbacks,
+		"queuedURLs":			ready + leased,
+	}).Info("shutdown summary")
+
+	if tasks > 0 || len(unscheduled) > 0 || unpublished > 0 || callbacks > 0 || dropped > 0 {
+		return 1
+	}
+
+	return 0
+}
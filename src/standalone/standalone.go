@@ -7,11 +7,13 @@ package standalone
 import (
 	"bufio"
 	"encoding/csv"
+	"errors"
 	"os"
 	"os/exec"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
@@ -20,6 +22,7 @@ import (
 
 	cm "siteResService/src/common"
 	mc "siteResService/src/mysqlclient"
+	qu "siteResService/src/queue"
 	sc "siteResService/src/scheduler"
 	ut "siteResService/src/util"
 )
@@ -28,11 +31,13 @@ import (
 // StandAlone represents stand alone running
 type StandAlone struct {
 	db 				*mc.MySQLClient
-	subChan			*chan string
+	subChan			*chan *cm.PageMessage
 	subCounter		*uint64
 	siteResFile		*os.File  // store site resource data, not include spec and set
 	siteSpecFile	*os.File  // store site specifications data
 	siteGoodFile		*os.File  // store site set meal data
+	fileLock		sync.Mutex  // csv files are written and closed by one routine at a time
+	stopped			int32  // stop reading sources, must use by atomic !!!
 	lastOffset      int64  // store last offset when last query
 	lastStartTime	time.Time  // store last start time in query period
 	lastTimeStamp	int64  // store last time in timestamp
@@ -41,8 +46,11 @@ type StandAlone struct {
 var instance *StandAlone
 var initStandAloneOnce sync.Once
 
+// ErrFilesClosed returned when result is saved after site files closed by shutdown
+var ErrFilesClosed = errors.New("site files are closed")
+
 // GetStandAloneInstance returns StandAlone instance pointer
-func GetStandAloneInstance(db *mc.MySQLClient, subChan *chan string, subCounter *uint64) *StandAlone {
+func GetStandAloneInstance(db *mc.MySQLClient, subChan *chan *cm.PageMessage, subCounter *uint64) *StandAlone {
 	initStandAloneOnce.Do(func() {
 		instance = new(StandAlone)
 		instance.init(db, subChan, subCounter)
@@ -54,7 +62,7 @@ func GetStandAloneInstance(db *mc.MySQLClient, subChan *chan string, subCounter
 }
 
 // init stand alone model
-func (sa *StandAlone) init(db *mc.MySQLClient, subChan *chan string, subCounter *uint64) {
+func (sa *StandAlone) init(db *mc.MySQLClient, subChan *chan *cm.PageMessage, subCounter *uint64) {
 	sa.db = db
 	sa.subChan = subChan
 	sa.subCounter = subCounter
@@ -89,7 +97,14 @@ func (sa *StandAlone) addInfoToChan(items *[]orm.Params) int64 {
 		}
 
 		landingURL := strings.TrimSpace(item["LandingUrl"].(string))
-		*sa.subChan <- landingURL
+		if err := qu.PushWait(*sa.subChan, &cm.PageMessage{URL: landingURL, Priority: sc.PriorityLow}, "", 0); err != nil {
+			log.WithFields(log.Fields{
+				"landingURL":	landingURL,
+				"error":		err.Error(),
+			}).Error("can not enqueue landing url from db")
+
+			continue
+		}
 
 		// only for debug
 		log.WithFields(log.Fields{
@@ -107,7 +122,7 @@ func (sa *StandAlone) GetProsFromDB() {
 	maxID := sa.db.CustomizedDBQueryMax("wc_cargo_materials", orm.NewCondition(), "cargo_ext_id", 0)
 	startTime := time.Now().Add(time.Hour * -4).Unix()
 	offset := int64(0)  // init offset of query
-	for {
+	for !sa.Stopped() {
 		// set query condition
 		items := sa.listPros(maxID, startTime, offset)
 		num = sa.addInfoToChan(items)
@@ -125,6 +140,18 @@ func (sa *StandAlone) GetProsFromDB() {
 		// debug, for slow down http request frequency
 		time.Sleep(time.Duration(cm.DBQueryGap) * time.Second)
 	}
+
+	log.Info("stop getting landing urls from db")
+}
+
+// Stop for stop reading page urls from db or source file
+func (sa *StandAlone) Stop() {
+	atomic.StoreInt32(&sa.stopped, 1)
+}
+
+// Stopped returns true if stop reading page urls
+func (sa *StandAlone) Stopped() bool {
+	return atomic.LoadInt32(&sa.stopped) == 1
 }
 
 // initSiteFile for init site file to save process result
@@ -173,20 +200,26 @@ func (sa *StandAlone) initSiteResultFile() {
 	sa.siteGoodFile = initSiteFile(cm.SiteGoodFile, titles)
 }
 
-// closeFileTGT for close target file
+// closeFileTGT for close target file, waits for the writing result
 func (sa *StandAlone) CloseFileTGT() {
+	sa.fileLock.Lock()
+	defer sa.fileLock.Unlock()
+
 	if sa.siteResFile != nil {
 		sa.siteResFile.Close()
+		sa.siteResFile = nil
 
 		log.Info("siteResFile close success...")
 	}
 	if sa.siteSpecFile != nil {
 		sa.siteSpecFile.Close()
+		sa.siteSpecFile = nil
 
 		log.Info("siteSpecFile close success...")
 	}
 	if sa.siteGoodFile != nil {
 		sa.siteGoodFile.Close()
+		sa.siteGoodFile = nil
 
 		log.Info("siteSetFile close success...")
 	}
@@ -203,11 +236,44 @@ func (sa *StandAlone) GetPageURLFromFile(fileSCR string) {
 		return
 	}
 
+	// lines enqueued before restart are skipped
+	source := "file:" + fileSCR
+	var skip int64
+	if q := qu.GetQueue(); q != nil {
+		skip = q.Offset(source)
+	}
+	if skip > 0 {
+		log.WithFields(log.Fields{
+			"file":		fileSCR,
+			"lines":	skip,
+		}).Info("resume reading source file after lines enqueued")
+	}
+
 	r := bufio.NewScanner(file)
-	for r.Scan() {
+	for line := int64(1); r.Scan(); line++ {
+		if line <= skip {
+			continue
+		}
+		if sa.Stopped() {
+			file.Close()
+
+			log.Info("stop reading source file")
+
+			return
+		}
+
 		// Read each record from csv file
 		pageURL := r.Text()
-		*sa.subChan <- pageURL
+		if err := qu.PushWait(*sa.subChan, &cm.PageMessage{URL: pageURL, Priority: sc.PriorityLow}, source, line); err != nil {
+			file.Close()
+
+			log.WithFields(log.Fields{
+				"line":		line,
+				"error":	err.Error(),
+			}).Error("can not enqueue page url, stop reading source file")
+
+			return
+		}
 
 		// only for debug
 		log.WithFields(log.Fields{
@@ -265,7 +331,7 @@ func generateProInfoSlice(proInfo *cm.ProInfo) []string {
 }
 
 // writeCSVFile for write data to csv file
-func writeCSVFile(w *csv.Writer, data [][]string) {
+func writeCSVFile(w *csv.Writer, data [][]string) error {
 	for _, d := range data {
 		err := w.Write(d)
 		if err != nil {
@@ -273,25 +339,44 @@ func writeCSVFile(w *csv.Writer, data [][]string) {
 				"error":	err.Error(),
 			}).Error("write data to csv file failed")
 
-			return
+			return err
 		}
 
 		w.Flush()
 	}
+
+	return w.Error()
 }
 
-// TaskSaveResultToFile for save site resource to target file
-func (sa *StandAlone) TaskSaveResultToFile(data *sc.DataBlock) {
+// TaskSaveResultToFile for save site resource to target file, returns ErrFilesClosed after shutdown closed files
+func (sa *StandAlone) TaskSaveResultToFile(data *sc.DataBlock) error {
 	proInfo := data.Message.(*cm.ProInfo)
 
+	sa.fileLock.Lock()
+	defer sa.fileLock.Unlock()
+
+	if sa.siteResFile == nil {  // closed by shutdown
+		log.WithFields(log.Fields{
+			"pageURL":	proInfo.PageURL,
+		}).Error("site files are closed, result is not saved by TaskSaveResultToFile")
+
+		return ErrFilesClosed
+	}
+
 	w := csv.NewWriter(sa.siteResFile)
-	writeCSVFile(w, [][]string{generateProInfoSlice(proInfo)})
+	if err := writeCSVFile(w, [][]string{generateProInfoSlice(proInfo)}); err != nil {
+		return err
+	}
 
 	w = csv.NewWriter(sa.siteGoodFile)
-	writeCSVFile(w, proInfo.Good)
+	if err := writeCSVFile(w, proInfo.Good); err != nil {
+		return err
+	}
 
 	w = csv.NewWriter(sa.siteSpecFile)
-	writeCSVFile(w, proInfo.Spec)
+	if err := writeCSVFile(w, proInfo.Spec); err != nil {
+		return err
+	}
 
 	// chmod
 	//fp := proInfo.Cover[0].URL
@@ -299,6 +384,8 @@ func (sa *StandAlone) TaskSaveResultToFile(data *sc.DataBlock) {
 	//chDirMod(dir)
 
 	log.Info("finish csv file writing")
+
+	return nil
 }
 
 // ShowStandaloneADV for standalone file mode to debug
@@ -307,7 +394,7 @@ func (sa *StandAlone) ShowStandaloneADV() {
 		select {
 		case msg := <- *sa.subChan:
 			log.WithFields(log.Fields{
-				"pageURL":	msg,
+				"pageURL":	msg.URL,
 			}).Info("handle result")
 		}
 	}
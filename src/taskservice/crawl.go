@@ -0,0 +1,175 @@
+/*
+  Package task for crawl requests of protobuf contract
+*/
+
+package taskservice
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	cm "siteResService/src/common"
+	hs "siteResService/src/httpservice"
+	pb "siteResService/src/proto"
+	sc "siteResService/src/scheduler"
+)
+
+// error codes of failed parse, shared by http api, rpc and callbacks
+const (
+	CodeBadURL				= "bad_url"
+	CodeUnknownField		= "unknown_field"
+	CodeUnknownDomain		= "unknown_domain"
+	CodeRobotsDisallowed	= "robots_disallowed"
+	CodeParseIncomplete		= "parse_incomplete"
+	CodeFetchFailed			= "fetch_failed"
+	CodeDeadlineExceeded	= "deadline_exceeded"
+	CodeBadPriority			= "bad_priority"
+	CodeRateLimited			= "rate_limited"
+	CodeInternal			= "internal_error"
+)
+
+// ErrorCode returns error code of error returned by parsing page
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrBadURL):
+		return CodeBadURL
+	case errors.Is(err, ErrUnknownField):
+		return CodeUnknownField
+	case errors.Is(err, ErrNoTemplate):
+		return CodeUnknownDomain
+	case errors.Is(err, ErrRobotsDisallowed):
+		return CodeRobotsDisallowed
+	case errors.Is(err, ErrTemplateBroken):
+		return CodeParseIncomplete
+	case errors.Is(err, ErrDeadlineExceeded):
+		return CodeDeadlineExceeded
+	case errors.Is(err, sc.ErrBadPriority):
+		return CodeBadPriority
+	case errors.Is(err, ErrRateLimited):
+		return CodeRateLimited
+	case sc.IsPanic(err):
+		return CodeInternal
+	}
+
+	return CodeFetchFailed  // site failed or web driver failed
+}
+
+// NormalizeFields returns fields in lower case without spaces
+func NormalizeFields(fields []string) []string {
+	var normalized []string
+	for _, field := range fields {
+		if field = strings.ToLower(strings.TrimSpace(field)); len(field) > 0 {
+			normalized = append(normalized, field)
+		}
+	}
+
+	return normalized
+}
+
+// NewPageMessage returns page message of crawl request, unknown fields are dropped
+func NewPageMessage(req *pb.CrawlRequest) *cm.PageMessage {
+	fields := NormalizeFields(req.GetFields())
+	if CheckResourceFields(fields) != nil {
+		fields = nil
+	}
+
+	return &cm.PageMessage{
+		ID:			req.GetId(),
+		URL:		req.GetUrl(),
+		Callback:	req.GetCallback(),
+		Priority:	int(req.GetPriority()),
+		UseStored:	!req.GetForceRefresh(),
+		Fields:		fields,
+		CargoID:	req.GetCargoId(),
+	}
+}
+
+// newCrawlError returns error of crawl result
+func newCrawlError(err error) *pb.CrawlError {
+	return &pb.CrawlError{Code: ErrorCode(err), Class: hs.ErrorClass(err), Message: err.Error()}
+}
+
+// newResourceRows returns rows of specifications or set meals
+func newResourceRows(rows [][]string) []*pb.ResourceRow {
+	var pbRows []*pb.ResourceRow
+	for _, row := range rows {
+		pbRows = append(pbRows, &pb.ResourceRow{Cells: row})
+	}
+
+	return pbRows
+}
+
+// fillCrawlResult for set wanted fields of site resource to crawl result, all fields if fields is empty
+func fillCrawlResult(res *pb.CrawlResult, pi *cm.ProInfo, fields []string) {
+	wanted := make(map[string]bool)
+	for _, field := range fields {
+		wanted[field] = true
+	}
+	want := func(field string) bool {
+		return len(wanted) <= 0 || wanted[field]
+	}
+
+	res.Template = pi.Template
+	res.TemplateVersion = int32(pi.TemplateVersion)
+	if want("cover") {
+		res.Cover = pi.Cover
+	}
+	if want("title") {
+		res.Title = pi.Title
+	}
+	if want("currency") {
+		res.Currency = pi.Currency
+	}
+	if want("price") {
+		res.Price = pi.Price
+	}
+	if want("desc") && len(pi.Desc) > 0 {
+		res.Desc = []string{pi.Desc}
+	}
+	if want("good") {
+		res.Good = newResourceRows(pi.Good)
+	}
+	if want("spec") {
+		res.Spec = newResourceRows(pi.Spec)
+	}
+}
+
+// Crawl returns result of crawl request, page is parsed at once unless stored,
+// failure is set in error of result, result is also posted to callback url if set
+func (t *TaskService) Crawl(req *pb.CrawlRequest) *pb.CrawlResult {
+	started := time.Now()
+	res := &pb.CrawlResult{
+		Id:			req.GetId(),
+		Url:		req.GetUrl(),
+		CargoId:	req.GetCargoId(),
+		Timing:		&pb.CrawlTiming{Started: started.UnixNano() / int64(time.Millisecond)},
+	}
+
+	fields := NormalizeFields(req.GetFields())
+	if err := CheckResourceFields(fields); err != nil {
+		res.Error = newCrawlError(err)
+
+		return res
+	}
+	if err := sc.CheckPriority(int(req.GetPriority())); err != nil {
+		res.Error = newCrawlError(err)
+
+		return res
+	}
+
+	pi, stored, err := t.QuerySiteResource(req.GetUrl(), req.GetForceRefresh())
+	if !stored {
+		res.Timing.Elapsed = int64(time.Since(started) / time.Millisecond)
+	}
+	t.webhook.SendEvent(NewPageMessage(req), pi, err)
+	if err != nil {
+		res.Error = newCrawlError(err)
+
+		return res
+	}
+	res.Stored = stored
+	fillCrawlResult(res, pi, fields)
+
+	return res
+}
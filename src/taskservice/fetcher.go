@@ -0,0 +1,273 @@
+/*
+  Package task for fetch pages of site templates
+*/
+
+package taskservice
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/astaxie/beego"
+	log "github.com/sirupsen/logrus"
+
+	cm "siteResService/src/common"
+	hs "siteResService/src/httpservice"
+	mt "siteResService/src/metrics"
+	ut "siteResService/src/util"
+)
+
+// Page represents fetched page of one url
+type Page struct {
+	URL			string  // current url, differs from requested url if redirected
+	Doc			*goquery.Document  // main page document, used by html and web template
+	OrderDoc	*goquery.Document  // order page document, nil if main and order at the same page
+	Body		[]byte  // response body, used by json template
+}
+
+// ErrNoFetcher returned when template character do not have fetcher, such as web driver disabled
+var ErrNoFetcher = errors.New("do not have fetcher of this character")
+
+// Fetcher fetches page of url, labels is nil if domain of url do not have template,
+// error should be *hs.FetchError if site failed, so caller can tell site down from template broken
+type Fetcher interface {
+	Fetch(pageURL string, labels *cm.LabelsParse) (*Page, error)
+}
+
+// HTTPFetcher fetches main page and order page by http request get
+type HTTPFetcher struct {
+	http	*hs.ServiceHTTP
+}
+
+// JSONPostFetcher fetches json body by http request post
+type JSONPostFetcher struct {
+	http	*hs.ServiceHTTP
+}
+
+// FixtureFetcher fetches saved pages from dir, never touch network
+type FixtureFetcher struct {
+	dir		string
+}
+
+// NewHTTPFetcher returns pointer of HTTPFetcher instance
+func NewHTTPFetcher(h *hs.ServiceHTTP) *HTTPFetcher {
+	return &HTTPFetcher{http: h}
+}
+
+// NewJSONPostFetcher returns pointer of JSONPostFetcher instance
+func NewJSONPostFetcher(h *hs.ServiceHTTP) *JSONPostFetcher {
+	return &JSONPostFetcher{http: h}
+}
+
+// NewFixtureFetcher returns pointer of FixtureFetcher instance
+func NewFixtureFetcher(dir string) *FixtureFetcher {
+	return &FixtureFetcher{dir: dir}
+}
+
+// getOrderHref returns order href
+func getOrderHref(doc *goquery.Document, pageURL string, orderLabel string) string {
+	selectors := strings.Split(orderLabel, cm.LabelSeparate)
+	selection := doc.Find(selectors[0])
+	for i := 1; i < len(selectors); i++ {  // cascade find label
+		selection = selection.Find(selectors[i])
+	}
+
+	// find order href
+	var href string
+	selection.Each(func(i int, selc *goquery.Selection) {
+		href, _ = selection.Attr("href")
+	})
+
+	// get order href
+	if len(href) > 0 {
+		index := strings.LastIndex(pageURL, "/")
+		if index > 0 {
+			return pageURL[: index] + href
+		}
+
+		return href
+	}
+
+	return ""
+}
+
+// Fetch returns main page and order page by http request get,
+// returns error if template set order labels but order href can not be found, page should be fetched by web driver
+func (f *HTTPFetcher) Fetch(pageURL string, labels *cm.LabelsParse) (*Page, error) {
+	var orderLabels []string
+	var cacheTTL int
+	if labels != nil {
+		orderLabels = labels.Order
+		cacheTTL = labels.CacheTTL
+	}
+	ttl := f.http.ResponseCache().TTL(cacheTTL)
+
+	doc, err := f.http.FetchDoc(pageURL, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	var orderURL string
+	for _, label := range orderLabels {
+		if len(label) <= 0 {
+			continue
+		}
+
+		// get order doc
+		orderURL = getOrderHref(doc, pageURL, label)
+		if len(orderURL) > 0 {
+			break
+		}
+	}
+
+	// set orderLabels but not find order href or href not a path
+	if len(orderLabels) > 0 && (len(orderURL) <= 0 || !strings.Contains(orderURL, "/")) {
+		log.Info("can not find order href, use web driver to get page again")
+
+		return nil, errors.New("can not find order href")
+	}
+
+	page := &Page{URL: pageURL, Doc: doc}
+	if len(orderURL) <= 0 {
+		log.Info("do not need order page by HTTPFetcher")
+
+		return page, nil
+	}
+
+	// request order page doc only if get order url success
+	page.OrderDoc, _ = f.http.FetchDoc(orderURL, ttl)
+	if page.OrderDoc == nil {
+		log.Error("request get order doc failed by HTTPFetcher")
+	}
+
+	return page, nil
+}
+
+// Fetch returns json body by http request post
+func (f *JSONPostFetcher) Fetch(pageURL string, labels *cm.LabelsParse) (*Page, error) {
+	var cacheTTL int
+	if labels != nil {
+		cacheTTL = labels.CacheTTL
+	}
+
+	body, err := f.http.FetchJSONPost(pageURL, f.http.ResponseCache().TTL(cacheTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Page{URL: pageURL, Body: body}, nil
+}
+
+// readFixture returns content of the first exist file named <name><suffix>, nil if none exist
+func (f *FixtureFetcher) readFixture(names []string, suffix string) ([]byte, error) {
+	for _, name := range names {
+		filePath := path.Join(f.dir, name + suffix)
+		if ok, _ := ut.PathExists(filePath); !ok {
+			continue
+		}
+
+		return ioutil.ReadFile(filePath)
+	}
+
+	return nil, nil
+}
+
+// Fetch returns saved pages named by url md5 or domain:
+// <name>.html for main page, <name>.order.html for order page, <name>.json for json body
+func (f *FixtureFetcher) Fetch(pageURL string, labels *cm.LabelsParse) (*Page, error) {
+	names := []string{ut.GetMD5(pageURL)}
+	if labels != nil && len(labels.Domain) > 0 {
+		names = append(names, labels.Domain)
+	}
+	if u, err := url.Parse(pageURL); err == nil && len(u.Host) > 0 {
+		names = append(names, u.Host)
+	}
+
+	page := &Page{URL: pageURL}
+	for suffix, doc := range map[string]**goquery.Document{".html": &page.Doc, ".order.html": &page.OrderDoc} {
+		dat, err := f.readFixture(names, suffix)
+		if err != nil {
+			return nil, err
+		}
+		if dat == nil {
+			continue
+		}
+
+		if *doc, err = goquery.NewDocumentFromReader(strings.NewReader(string(dat))); err != nil {
+			return nil, err
+		}
+	}
+
+	body, err := f.readFixture(names, ".json")
+	if err != nil {
+		return nil, err
+	}
+	page.Body = body
+
+	if page.Doc == nil && page.Body == nil {
+		return nil, errors.New("do not have saved page in " + f.dir)
+	}
+
+	return page, nil
+}
+
+// initFetchers for choose fetcher of each template character by configure
+func (t *TaskService) initFetchers() {
+	t.fetchers = make(map[string]Fetcher)
+
+	dir := beego.AppConfig.DefaultString("fetcher::fixtureDir", cm.FetcherFixtureDir)
+	if len(dir) > 0 {
+		fixture := NewFixtureFetcher(dir)
+		t.fetchers[cm.HTMLFormat] = fixture
+		t.fetchers[cm.JSONFormat] = fixture
+		t.fetchers[cm.WebFormat] = fixture
+
+		log.WithFields(log.Fields{
+			"dir":	dir,
+		}).Warn("fetch all pages from saved files")
+
+		return
+	}
+
+	t.fetchers[cm.HTMLFormat] = NewHTTPFetcher(t.httpService)
+	t.fetchers[cm.JSONFormat] = NewJSONPostFetcher(t.httpService)
+	if beego.AppConfig.DefaultBool("fetcher::browser", cm.FetcherBrowser) {
+		t.fetchers[cm.WebFormat] = NewBrowserFetcher(t.httpService, t.site)
+	} else {
+		log.Info("web driver is disabled, only templates of html and json are available")
+	}
+}
+
+// SetFetcher for replace fetcher of template character, such as inject fake fetcher
+func (t *TaskService) SetFetcher(character string, f Fetcher) {
+	t.fetcherLock.Lock()
+	defer t.fetcherLock.Unlock()
+
+	if f == nil {
+		delete(t.fetchers, character)
+
+		return
+	}
+	t.fetchers[character] = f
+}
+
+// fetch returns page fetched by fetcher of template character
+func (t *TaskService) fetch(character string, pageURL string, labels *cm.LabelsParse) (*Page, error) {
+	t.fetcherLock.RLock()
+	f, ok := t.fetchers[character]
+	t.fetcherLock.RUnlock()
+	if !ok {
+		return nil, ErrNoFetcher
+	}
+
+	start := time.Now()
+	page, err := f.Fetch(pageURL, labels)
+	mt.ObserveFetch(labels, character, err, hs.ErrorClass(err), time.Since(start))
+
+	return page, err
+}
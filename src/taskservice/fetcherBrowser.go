@@ -0,0 +1,258 @@
+/*
+  Package task for fetch pages of site templates by web driver
+*/
+
+package taskservice
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/astaxie/beego"
+	log "github.com/sirupsen/logrus"
+	"github.com/tebeka/selenium"
+
+	cm "siteResService/src/common"
+	hs "siteResService/src/httpservice"
+	st "siteResService/src/taskservice/sites"
+	ut "siteResService/src/util"
+)
+
+// BrowserFetcher fetches main page and order page by leased web driver session, selenium is started on first fetch
+type BrowserFetcher struct {
+	http	*hs.ServiceHTTP
+	site	*st.SiteService  // for get order labels of redirected url
+}
+
+// NewBrowserFetcher returns pointer of BrowserFetcher instance
+func NewBrowserFetcher(h *hs.ServiceHTTP, site *st.SiteService) *BrowserFetcher {
+	return &BrowserFetcher{http: h, site: site}
+}
+
+// redirectToOrderPage for click order and jump to order page, return yes if redirect success
+func redirectOrderPage (wd *selenium.WebDriver, pageURL string, orderLabel string) bool {
+	anchors, err := (*wd).FindElements(selenium.ByCSSSelector, orderLabel)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"url":		pageURL,
+			"cssValue":	orderLabel,
+			"error":	err.Error(),
+		}).Error("can not find css element by redirectOrderPage")
+
+		return false
+	}
+
+	// click href
+	clickFlag := false
+	for _, a := range anchors {
+		err := a.Click()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"url":		pageURL,
+				"error":	err.Error(),
+			}).Error("send keys failed by redirectOrderPage")
+
+			continue
+		}
+
+		clickFlag = true
+
+		break
+	}
+
+	// if click failed, return
+	if !clickFlag {
+		log.Error("click order failed by redirectOrderPage")
+
+		return false
+	}
+
+	return true
+}
+
+// getDocWebDriver returns pointer of goquery.Document instance and page source by web driver
+func getDocWebDriver(wd *selenium.WebDriver, pageURL string) (*goquery.Document, string) {
+	source, errP := (*wd).PageSource()
+	if errP != nil {
+		log.WithFields(log.Fields{
+			"pageURL":	pageURL,
+			"error":	errP.Error(),
+		}).Error("can not get page source by getDocWebDriver")
+
+		return nil, ""
+	}
+
+	// get page body html document
+	html := source
+	doc, errD := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if errD != nil {
+		log.WithFields(log.Fields{
+			"pageURL":	pageURL,
+			"error":	errD.Error(),
+		}).Error("new document failed by getDocWebDriver")
+
+		return nil, ""
+	}
+
+	return doc, source
+}
+
+// cachedPage returns page rendered by web driver before if cached within ttl
+func (f *BrowserFetcher) cachedPage(pageURL string, ttl time.Duration) (*Page, bool) {
+	e, ok := f.http.ResponseCache().Fresh(hs.CacheKey(hs.CacheMethodWeb, pageURL, nil), ttl)
+	if !ok {
+		return nil, false
+	}
+
+	page := &Page{URL: e.URL}
+	var err error
+	if page.Doc, err = goquery.NewDocumentFromReader(bytes.NewReader(e.Body)); err != nil {
+		return nil, false
+	}
+	if len(e.Extra) > 0 {
+		page.OrderDoc, _ = goquery.NewDocumentFromReader(bytes.NewReader(e.Extra))
+	}
+	atomic.AddUint64(&f.http.ResponseCache().HitCounter, 1)
+
+	return page, true
+}
+
+// cachePage for cache page sources rendered by web driver
+func (f *BrowserFetcher) cachePage(pageURL string, currentURL string, source string, orderSource string) {
+	f.http.ResponseCache().Put(&hs.CacheEntry{
+		Key:		hs.CacheKey(hs.CacheMethodWeb, pageURL, nil),
+		URL:		currentURL,
+		StatusCode:	200,
+		Body:		[]byte(source),
+		Extra:		[]byte(orderSource),
+		Stored:		time.Now(),
+	})
+}
+
+// waitOrderPage returns true if order page rendered, sleep a fixed time if template do not set order wait conditions
+func waitOrderPage(lease *hs.WebDriverLease, wait *cm.WaitCondition) bool {
+	if wait == nil {
+		sleep := beego.AppConfig.DefaultInt("webdriver::orderSleep", cm.WebDriverOrderSleep)
+		time.Sleep(time.Duration(sleep) * time.Second)
+
+		return true
+	}
+
+	if err := lease.Wait(wait); err != nil {
+		return false
+	}
+
+	return true
+}
+
+// Fetch returns main page and order page by web driver, page url is the current url after redirect,
+// order labels are loaded by domain of current url, labels of requested url are not used,
+// page sources cached within ttl are returned without web driver
+func (f *BrowserFetcher) Fetch(pageURL string, labels *cm.LabelsParse) (*Page, error) {
+	var cacheTTL int
+	if labels != nil {
+		cacheTTL = labels.CacheTTL
+	}
+	ttl := f.http.ResponseCache().TTL(cacheTTL)
+	if page, ok := f.cachedPage(pageURL, ttl); ok {
+		return page, nil
+	}
+	atomic.AddUint64(&f.http.ResponseCache().MissCounter, 1)
+
+	lease, err := f.http.LeaseWebDriver()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"pageURL":	pageURL,
+			"error":	err.Error(),
+		}).Error("can not lease web driver by BrowserFetcher")
+
+		return nil, &hs.FetchError{Class: hs.ErrClassBrowser, URL: pageURL, Err: err}
+	}
+	defer lease.Release()
+
+	wd, err := lease.GetURL(pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	currentURL, errU := (*wd).CurrentURL()
+	if errU != nil {
+		log.WithFields(log.Fields{
+			"pageURL":	pageURL,
+			"error":	errU.Error(),
+		}).Error("can not get current url by BrowserFetcher")
+		lease.MarkBroken()
+
+		return nil, &hs.FetchError{Class: hs.ErrClassBrowser, URL: pageURL, Attempts: 1, Err: errU}
+	}
+
+	// get template of current url, it differs from requested url if redirected
+	u, _ := url.Parse(currentURL)
+	domainMD5 := ut.GetMD5(u.Host)
+	current, ok := f.site.LoadLabels(domainMD5)
+	if !ok {
+		current = labels
+	}
+
+	// wait until main page rendered
+	if current != nil {
+		if err := lease.Wait(current.Wait); err != nil {
+			return nil, errors.New("main page not rendered: " + err.Error())
+		}
+	}
+
+	// get main page doc
+	page := &Page{URL: currentURL}
+	var source, orderSource string
+	page.Doc, source = getDocWebDriver(wd, pageURL)
+	if page.Doc == nil {
+		return nil, errors.New("can not get page source")
+	}
+
+	if current == nil {
+		log.WithFields(log.Fields{
+			"url":		currentURL,
+			"domain":	u.Host,
+		}).Error("do not contains this domain template by BrowserFetcher")
+
+		return page, nil
+	}
+
+	// redirect order page
+	if len(current.Order) <= 0 {
+		log.Info("do not need order page by BrowserFetcher")
+		f.cachePage(pageURL, currentURL, source, "")
+
+		return page, nil
+	}
+
+	redirect := false  // for judge redirect status
+	for _, labelOrder := range current.Order {
+		if len(labelOrder) <= 0 {
+			continue
+		}
+
+		if redirectOrderPage(wd, pageURL, labelOrder) {
+			redirect = waitOrderPage(lease, current.OrderWait)
+
+			break
+		}
+	}
+
+	// get order page doc only if redirect success
+	if redirect {
+		page.OrderDoc, orderSource = getDocWebDriver(wd, pageURL)
+	}
+	if page.OrderDoc == nil {
+		log.Error("web driver load order page failed by BrowserFetcher")
+	} else {
+		f.cachePage(pageURL, currentURL, source, orderSource)
+	}
+
+	return page, nil
+}
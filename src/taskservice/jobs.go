@@ -0,0 +1,234 @@
+/*
+  Package task for asynchronous crawl jobs of many urls
+*/
+
+package taskservice
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/astaxie/beego"
+	log "github.com/sirupsen/logrus"
+
+	cm "siteResService/src/common"
+	qu "siteResService/src/queue"
+	sc "siteResService/src/scheduler"
+)
+
+// status of url in crawl job
+const (
+	JobQueued	= "queued"
+	JobFetching	= "fetching"
+	JobParsed	= "parsed"
+	JobFailed	= "failed"
+)
+
+// JobItem represents one url of crawl job, passed to TaskParseURL by DataBlock.Extra
+type JobItem struct {
+	lock		sync.Mutex
+	job			*Job
+	URL			string
+	status		string
+	err			error  // reason of failed
+	result		*cm.ProInfo
+}
+
+// Job represents crawl job of urls submitted together
+type Job struct {
+	ID			string
+	Created		time.Time
+	Items		[]*JobItem
+	Callback	string  // results are posted to this url when job is done
+	Priority	int  // priority of tasks of urls
+	Deadline	time.Time  // urls not started before fail, zero means no deadline
+	pending		int32  // num of urls not parsed or failed, must use by atomic !!!
+	finished	atomic.Value  // time.Time when all urls done
+	onDone		func(*Job)  // called once when all urls done
+}
+
+// JobManager represents crawl jobs kept for status polling
+type JobManager struct {
+	lock		sync.RWMutex
+	jobs		map[string]*Job
+	ttl			time.Duration  // finished job is dropped after this
+	maxURLs		int
+}
+
+// ErrTooManyURLs returned when job has more urls than max urls
+var ErrTooManyURLs = errors.New("too many urls of one job")
+
+// ErrNoURL returned when job do not have url
+var ErrNoURL = errors.New("job do not have url")
+
+// newJobManager returns pointer of JobManager instance read from app.conf
+func newJobManager() *JobManager {
+	return &JobManager{
+		jobs:		make(map[string]*Job),
+		ttl:		time.Duration(beego.AppConfig.DefaultInt("jobs::ttl", cm.JobTTL)) * time.Second,
+		maxURLs:	beego.AppConfig.DefaultInt("jobs::maxURLs", cm.JobMaxURLs),
+	}
+}
+
+// newJobID returns random job id
+func newJobID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// State returns status, result and reason of failed of url
+func (i *JobItem) State() (string, *cm.ProInfo, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	return i.status, i.result, i.err
+}
+
+// set for change status of url, job is finished when its last url is done
+func (i *JobItem) set(status string, err error, pi *cm.ProInfo) {
+	if i == nil {  // not a job url
+		return
+	}
+
+	i.lock.Lock()
+	done := i.status == JobParsed || i.status == JobFailed
+	i.status = status
+	i.err = err
+	i.result = pi
+	i.lock.Unlock()
+
+	if !done && (status == JobParsed || status == JobFailed) {
+		if atomic.AddInt32(&i.job.pending, -1) == 0 {
+			i.job.finished.Store(time.Now())
+			if i.job.onDone != nil {
+				i.job.onDone(i.job)
+			}
+		}
+	}
+}
+
+// start for mark url is fetching
+func (i *JobItem) start() {
+	i.set(JobFetching, nil, nil)
+}
+
+// finish for mark url parsed or failed by error
+func (i *JobItem) finish(pi *cm.ProInfo, err error) {
+	if err != nil {
+		i.set(JobFailed, err, nil)
+
+		return
+	}
+	i.set(JobParsed, nil, pi)
+}
+
+// Done returns true if all urls parsed or failed
+func (j *Job) Done() bool {
+	return atomic.LoadInt32(&j.pending) == 0
+}
+
+// expired returns true if job finished longer than ttl
+func (j *Job) expired(ttl time.Duration) bool {
+	finished, ok := j.finished.Load().(time.Time)
+
+	return ok && time.Now().Sub(finished) > ttl
+}
+
+// sweep for drop expired jobs, must hold lock
+func (m *JobManager) sweep() {
+	for id, job := range m.jobs {
+		if job.expired(m.ttl) {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// JobOptions represents options of crawl job
+type JobOptions struct {
+	Callback	string  // results are posted to this url when job is done if set
+	Priority	int  // sc.PriorityHigh for interactive api
+	Timeout		time.Duration  // urls not started in timeout fail, 0 means no deadline
+}
+
+// SubmitJob returns crawl job of urls, urls are added to scheduler by priority and parsed by TaskParseURL,
+// illegal urls fail at once and do not fail the job, results are posted to callback url when job is done if set,
+// job is rejected by qu.ErrIntakeFull if overflow of intake is reject and tasks of its priority are full
+func (t *TaskService) SubmitJob(urls []string, opts JobOptions) (*Job, error) {
+	callback := opts.Callback
+	if len(urls) <= 0 {
+		return nil, ErrNoURL
+	}
+	if t.jobs.maxURLs > 0 && len(urls) > t.jobs.maxURLs {
+		return nil, fmt.Errorf("%w: %d > %d", ErrTooManyURLs, len(urls), t.jobs.maxURLs)
+	}
+	if len(callback) > 0 {
+		if err := t.webhook.Check(callback); err != nil {
+			return nil, fmt.Errorf("callback: %w", err)
+		}
+	}
+
+	if in := qu.GetIntake(); in.Overflow() == qu.OverflowReject && t.scheduler.Room(cm.HTTPCtrlName, opts.Priority) == 0 {
+		atomic.AddUint64(&in.RejectCounter, 1)
+
+		return nil, fmt.Errorf("%w: tasks of priority %d are full", qu.ErrIntakeFull, opts.Priority)
+	}
+
+	job := &Job{ID: newJobID(), Created: time.Now(), Callback: callback, Priority: opts.Priority, pending: int32(len(urls))}
+	if opts.Timeout > 0 {
+		job.Deadline = job.Created.Add(opts.Timeout)
+	}
+	if len(callback) > 0 {
+		job.onDone = t.webhook.SendJob
+	}
+	for _, pageURL := range urls {
+		job.Items = append(job.Items, &JobItem{job: job, URL: pageURL, status: JobQueued})
+	}
+
+	t.jobs.lock.Lock()
+	t.jobs.sweep()
+	t.jobs.jobs[job.ID] = job
+	t.jobs.lock.Unlock()
+
+	// scheduler blocks when full, do not hold caller
+	go func() {
+		for _, item := range job.Items {
+			if err := CheckPageURL(item.URL); err != nil {
+				item.finish(nil, err)
+
+				continue
+			}
+
+			t.scheduler.AddTask(t.ParseTask(&sc.DataBlock{Extra: item, Message: item.URL}))
+		}
+	}()
+
+	log.WithFields(log.Fields{
+		"id":		job.ID,
+		"urls":		len(urls),
+		"priority":	job.Priority,
+	}).Info("submit crawl job")
+
+	return job, nil
+}
+
+// Job returns crawl job of id, false if not exist or expired
+func (t *TaskService) Job(id string) (*Job, bool) {
+	t.jobs.lock.RLock()
+	defer t.jobs.lock.RUnlock()
+
+	job, ok := t.jobs.jobs[id]
+	if !ok || job.expired(t.jobs.ttl) {
+		return nil, false
+	}
+
+	return job, true
+}
@@ -0,0 +1,43 @@
+/*
+  Package task for configure of tests, set before any service reads it
+*/
+
+package taskservice
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/astaxie/beego"
+	log "github.com/sirupsen/logrus"
+)
+
+// TestMain for write test template and set configure, services read configure in their own routines
+func TestMain(m *testing.M) {
+	log.SetLevel(log.FatalLevel)
+
+	dir, err := ioutil.TempDir("", "siteres")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	templatePath := path.Join(dir, "templateResource.csv")
+	if err := ioutil.WriteFile(templatePath, []byte(testTemplate), 0644); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	beego.AppConfig.Set("template::path", templatePath)
+	beego.AppConfig.Set("template::watchGap", "0")
+	beego.AppConfig.Set("webhook::secret", "test")
+	beego.AppConfig.Set("webhook::queueSize", "1")
+	beego.AppConfig.Set("webhook::workers", "0")
+	beego.AppConfig.Set("webhook::deadLetter", path.Join(dir, "webhook.dead"))
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
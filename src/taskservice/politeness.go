@@ -0,0 +1,194 @@
+/*
+  Package task for limit crawl rate and concurrency of each host
+*/
+
+package taskservice
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/astaxie/beego"
+	log "github.com/sirupsen/logrus"
+
+	cm "siteResService/src/common"
+)
+
+// politenessSweepGap for min gap of removing idle host buckets
+const politenessSweepGap = time.Minute
+
+// hostBucket represents token bucket and running pages of one host
+type hostBucket struct {
+	tokens		float64
+	last		time.Time  // last time tokens refilled
+	full		time.Time  // time tokens are refilled to burst, bucket can be removed after it if no page running
+	running		int  // pages parsing now
+}
+
+// Politeness represents per host limits, policy of template overrides global default in "politeness" section
+type Politeness struct {
+	lock			sync.Mutex
+	hosts			map[string]*hostBucket
+	swept			time.Time  // last time idle buckets removed
+	def				cm.PolitenessPolicy  // global default
+	deferGap		time.Duration  // wait of page deferred by max concurrency
+	robots			*RobotsChecker  // nil if robots.txt is not checked
+	DeferCounter	uint64  // calculation num of deferred pages, must use by atomic !!!
+	DenyCounter		uint64  // calculation num of pages disallowed by robots.txt, must use by atomic !!!
+}
+
+// ErrRateLimited returned when host of page url is over politeness limits
+var ErrRateLimited = errors.New("host is over politeness limits")
+
+// RateLimitError returned when page of host can not be parsed now, wraps ErrRateLimited
+type RateLimitError struct {
+	Host		string
+	RetryAfter	time.Duration  // wait before host may have room
+}
+
+// Error returns error message with host and wait
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s: %s, retry after %s", ErrRateLimited.Error(), e.Host, e.RetryAfter)
+}
+
+// Unwrap returns ErrRateLimited
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// RetryAfterSeconds returns wait in seconds for Retry-After header, at least 1
+func (e *RateLimitError) RetryAfterSeconds() int {
+	if seconds := int(math.Ceil(e.RetryAfter.Seconds())); seconds > 1 {
+		return seconds
+	}
+
+	return 1
+}
+
+// newPoliteness returns pointer of Politeness instance read from app.conf
+func newPoliteness(t *TaskService) *Politeness {
+	p := new(Politeness)
+	p.hosts = make(map[string]*hostBucket)
+	p.def.Rate = beego.AppConfig.DefaultFloat("politeness::rate", cm.PolitenessRate)
+	p.def.Burst = beego.AppConfig.DefaultInt("politeness::burst", cm.PolitenessBurst)
+	p.def.MaxConcurrency = beego.AppConfig.DefaultInt("politeness::maxConcurrency", cm.PolitenessMaxConcurrency)
+	p.deferGap = time.Duration(beego.AppConfig.DefaultInt("politeness::deferGap", cm.PolitenessDeferGap)) * time.Millisecond
+
+	if beego.AppConfig.DefaultBool("politeness::robots", cm.PolitenessRobots) {
+		allow := beego.AppConfig.DefaultString("politeness::allowList", "")
+		p.robots = newRobotsChecker(t.httpService, strings.Split(allow, ","))
+	}
+
+	log.WithFields(log.Fields{
+		"rate":				p.def.Rate,
+		"burst":			p.def.Burst,
+		"maxConcurrency":	p.def.MaxConcurrency,
+		"robots":			p.robots != nil,
+	}).Info("init politeness success...")
+
+	return p
+}
+
+// policy returns policy of labels, fields not set by template use global default
+func (p *Politeness) policy(labels *cm.LabelsParse) cm.PolitenessPolicy {
+	policy := p.def
+	if labels == nil || labels.Politeness == nil {
+		return policy
+	}
+
+	if labels.Politeness.Rate > 0 {
+		policy.Rate = labels.Politeness.Rate
+	}
+	if labels.Politeness.Burst > 0 {
+		policy.Burst = labels.Politeness.Burst
+	}
+	if labels.Politeness.MaxConcurrency > 0 {
+		policy.MaxConcurrency = labels.Politeness.MaxConcurrency
+	}
+
+	return policy
+}
+
+// TryAcquire returns release func if page of host can be parsed now, otherwise returns time to wait,
+// rate or max concurrency not greater than 0 means no limit
+func (p *Politeness) TryAcquire(host string, labels *cm.LabelsParse) (func(), time.Duration) {
+	policy := p.policy(labels)
+	burst := float64(policy.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	p.sweep(now)
+	b, ok := p.hosts[host]
+	if !ok {
+		b = &hostBucket{tokens: burst, last: now}
+		p.hosts[host] = b
+	}
+
+	if policy.MaxConcurrency > 0 && b.running >= policy.MaxConcurrency {
+		return nil, p.deferGap
+	}
+
+	if policy.Rate > 0 {
+		b.tokens += now.Sub(b.last).Seconds() * policy.Rate
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+		b.last = now
+
+		if b.tokens < 1 {
+			wait := time.Duration((1 - b.tokens) / policy.Rate * float64(time.Second))
+
+			return nil, wait
+		}
+		b.tokens--
+		b.full = now.Add(time.Duration((burst - b.tokens) / policy.Rate * float64(time.Second)))
+	} else {
+		b.full = now
+	}
+
+	b.running++
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			p.lock.Lock()
+			b.running--
+			p.lock.Unlock()
+		})
+	}
+
+	return release, 0
+}
+
+// sweep for remove buckets of hosts idle since full, a new bucket of the same host is full too, must hold lock
+func (p *Politeness) sweep(now time.Time) {
+	if now.Sub(p.swept) < politenessSweepGap {
+		return
+	}
+	p.swept = now
+
+	for host, b := range p.hosts {
+		if b.running <= 0 && now.After(b.full) {
+			delete(p.hosts, host)
+		}
+	}
+}
+
+// Allowed returns false if robots.txt of host disallow page url
+func (p *Politeness) Allowed(pageURL string) bool {
+	if p.robots == nil || p.robots.Allowed(pageURL) {
+		return true
+	}
+	atomic.AddUint64(&p.DenyCounter, 1)
+
+	return false
+}
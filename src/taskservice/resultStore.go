@@ -0,0 +1,245 @@
+/*
+  Package task for store parse results keyed by url md5
+*/
+
+package taskservice
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/orm"
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+
+	cm "siteResService/src/common"
+	mc "siteResService/src/mysqlclient"
+	md "siteResService/src/mysqlclient/models"
+	ut "siteResService/src/util"
+)
+
+// backends of parse results store
+const (
+	StoreFile	= "file"
+	StoreMySQL	= "mysql"
+	StoreNone	= "none"
+)
+
+// StoredResult represents parse result of one page url
+type StoredResult struct {
+	URLMD5		string		`json:"url_md5"`
+	PageURL		string		`json:"page_url"`
+	Info		*cm.ProInfo	`json:"info"`
+	ParseTime	time.Time	`json:"parse_time"`
+}
+
+// ResultStore stores parse results, Load returns false if url md5 not stored
+type ResultStore interface {
+	Load(urlMD5 string) (*StoredResult, bool, error)
+	Save(r *StoredResult) error
+}
+
+// FileResultStore stores each result as <url md5>.json in dir
+type FileResultStore struct {
+	dir		string
+}
+
+// MySQLResultStore stores results in table site_resource_result
+type MySQLResultStore struct {
+	db		*mc.MySQLClient
+}
+
+// NewFileResultStore returns pointer of FileResultStore instance, dir is created if not exist
+func NewFileResultStore(dir string) (*FileResultStore, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	return &FileResultStore{dir: dir}, nil
+}
+
+// NewMySQLResultStore returns pointer of MySQLResultStore instance
+func NewMySQLResultStore(db *mc.MySQLClient) *MySQLResultStore {
+	return &MySQLResultStore{db: db}
+}
+
+// Load returns stored result of url md5
+func (s *FileResultStore) Load(urlMD5 string) (*StoredResult, bool, error) {
+	dat, err := ioutil.ReadFile(path.Join(s.dir, urlMD5 + ".json"))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	r := new(StoredResult)
+	if err := jsoniter.Unmarshal(dat, r); err != nil {
+		return nil, false, err
+	}
+
+	return r, r.Info != nil, nil
+}
+
+// Save for write result to file, file is replaced by rename so readers never see half written result
+func (s *FileResultStore) Save(r *StoredResult) error {
+	dat, err := jsoniter.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	filePath := path.Join(s.dir, r.URLMD5 + ".json")
+	tmpPath := filePath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, dat, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, filePath)
+}
+
+// Load returns stored result of url md5
+func (s *MySQLResultStore) Load(urlMD5 string) (*StoredResult, bool, error) {
+	items := new([]orm.Params)
+	cond := orm.NewCondition().And("url_md5", urlMD5)
+	num, ok := s.db.QueryAll(items, "site_resource_result", cond, "-parse_time", 0)
+	if !ok {
+		return nil, false, errors.New("query site_resource_result failed")
+	}
+	if num <= 0 {
+		return nil, false, nil
+	}
+
+	item := (*items)[0]
+	r := &StoredResult{URLMD5: urlMD5, PageURL: fmt.Sprint(item["PageLink"]), Info: new(cm.ProInfo)}
+	if err := jsoniter.UnmarshalFromString(fmt.Sprint(item["Info"]), r.Info); err != nil {
+		return nil, false, err
+	}
+	parseTime, _ := strconv.ParseInt(fmt.Sprint(item["ParseTime"]), 10, 64)
+	r.ParseTime = time.Unix(parseTime, 0)
+
+	return r, true, nil
+}
+
+// Save for insert result, or update it if url md5 exists
+func (s *MySQLResultStore) Save(r *StoredResult) error {
+	info, err := jsoniter.MarshalToString(r.Info)
+	if err != nil {
+		return err
+	}
+
+	cond := orm.NewCondition().And("url_md5", r.URLMD5)
+	if s.db.IsExist("site_resource_result", cond) {
+		fields := &orm.Params{
+			"page_link":	r.PageURL,
+			"info":			info,
+			"parse_time":	r.ParseTime.Unix(),
+		}
+		if !s.db.UpdateField("site_resource_result", cond, fields) {
+			return errors.New("update site_resource_result failed")
+		}
+
+		return nil
+	}
+
+	item := &md.SiteResourceResult{
+		UrlMd5:		r.URLMD5,
+		PageLink:	r.PageURL,
+		Info:		info,
+		ParseTime:	int(r.ParseTime.Unix()),
+	}
+	if !s.db.SingleInsert(item) {
+		return errors.New("insert site_resource_result failed")
+	}
+
+	return nil
+}
+
+// initResultStore for choose backend of parse results store by configure, mysql falls back to file if no db
+func (t *TaskService) initResultStore() {
+	t.storeMaxAge = time.Duration(beego.AppConfig.DefaultInt("store::maxAge", cm.StoreMaxAge)) * time.Second
+
+	backend := beego.AppConfig.DefaultString("store::backend", cm.StoreBackend)
+	switch backend {
+	case StoreNone:
+		log.Info("parse results are not stored")
+
+		return
+	case StoreMySQL:
+		if t.db != nil {
+			t.store = NewMySQLResultStore(t.db)
+
+			log.Info("store parse results in mysql")
+
+			return
+		}
+		log.Error("mysql::conns is empty, store parse results in file")
+	}
+
+	dir := beego.AppConfig.DefaultString("store::dir", cm.StoreDir)
+	store, err := NewFileResultStore(dir)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"dir":		dir,
+			"error":	err.Error(),
+		}).Error("can not make store dir, parse results are not stored")
+
+		return
+	}
+	t.store = store
+
+	log.WithFields(log.Fields{
+		"dir":	dir,
+	}).Info("store parse results in file")
+}
+
+// loadResult returns stored parse result of page url if parsed within max age
+func (t *TaskService) loadResult(pageURL string) (*cm.ProInfo, bool) {
+	if t.store == nil {
+		return nil, false
+	}
+
+	r, ok, err := t.store.Load(ut.GetMD5(pageURL))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"pageURL":	pageURL,
+			"error":	err.Error(),
+		}).Error("can not load parse result by loadResult")
+
+		return nil, false
+	}
+	if !ok || time.Now().Sub(r.ParseTime) > t.storeMaxAge {
+		atomic.AddUint64(&t.StoreMissCounter, 1)
+
+		return nil, false
+	}
+	atomic.AddUint64(&t.StoreHitCounter, 1)
+
+	return r.Info, true
+}
+
+// saveResult for store parse result of page url
+func (t *TaskService) saveResult(pageURL string, pi *cm.ProInfo) {
+	if t.store == nil {
+		return
+	}
+
+	r := &StoredResult{
+		URLMD5:		ut.GetMD5(pageURL),
+		PageURL:	pageURL,
+		Info:		pi,
+		ParseTime:	time.Now(),
+	}
+	if err := t.store.Save(r); err != nil {
+		log.WithFields(log.Fields{
+			"pageURL":	pageURL,
+			"error":	err.Error(),
+		}).Error("can not save parse result by saveResult")
+	}
+}
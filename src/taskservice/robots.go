@@ -0,0 +1,172 @@
+/*
+  Package task for check robots.txt of hosts
+*/
+
+package taskservice
+
+import (
+	"bufio"
+	"bytes"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego"
+	log "github.com/sirupsen/logrus"
+
+	cm "siteResService/src/common"
+	hs "siteResService/src/httpservice"
+)
+
+// robotsRule represents one allow or disallow line of robots.txt
+type robotsRule struct {
+	allow	bool
+	path	string  // path prefix, trailing "*" and "$" are dropped
+}
+
+// robotsRules represents rules of one host matched our user agent
+type robotsRules struct {
+	rules	[]robotsRule
+	expire	time.Time
+}
+
+// RobotsChecker represents cache of robots.txt, hosts in allow list are not checked
+type RobotsChecker struct {
+	http		*hs.ServiceHTTP
+	agent		string  // user agent token matched in robots.txt
+	ttl			time.Duration
+	allowList	map[string]bool
+	cache		sync.Map  // host mapping *robotsRules
+}
+
+// newRobotsChecker returns pointer of RobotsChecker instance
+func newRobotsChecker(h *hs.ServiceHTTP, allowList []string) *RobotsChecker {
+	r := &RobotsChecker{http: h, allowList: make(map[string]bool)}
+	r.agent = strings.ToLower(beego.AppConfig.DefaultString("politeness::userAgent", cm.PolitenessUserAgent))
+	r.ttl = time.Duration(beego.AppConfig.DefaultInt("politeness::robotsTTL", cm.PolitenessRobotsTTL)) * time.Second
+	for _, host := range allowList {
+		if host = strings.ToLower(strings.TrimSpace(host)); len(host) > 0 {
+			r.allowList[host] = true
+		}
+	}
+
+	return r
+}
+
+// parseRobots returns rules of group matched agent, rules of "*" group are used if no group matched
+func parseRobots(body []byte, agent string) []robotsRule {
+	var matched, wildcard []robotsRule
+	var agents []string
+	inRules := false  // user agent lines after rule lines start a new group
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		value := strings.TrimSpace(kv[1])
+
+		switch key {
+		case "user-agent":
+			if inRules {
+				agents = nil
+				inRules = false
+			}
+			agents = append(agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			if len(value) <= 0 {  // empty disallow allows all
+				continue
+			}
+			rule := robotsRule{allow: key == "allow", path: strings.TrimRight(value, "*$")}
+			for _, a := range agents {
+				if a == "*" {
+					wildcard = append(wildcard, rule)
+				} else if strings.Contains(agent, a) {
+					matched = append(matched, rule)
+				}
+			}
+		}
+	}
+
+	if len(matched) > 0 {
+		return matched
+	}
+
+	return wildcard
+}
+
+// allowed returns true if path is allowed by rules, the longest matched rule wins
+func (r *robotsRules) allowed(path string) bool {
+	allow := true
+	length := -1
+	for _, rule := range r.rules {
+		if !strings.HasPrefix(path, rule.path) || len(rule.path) < length {
+			continue
+		}
+		if len(rule.path) == length && !rule.allow {  // allow wins if same length
+			continue
+		}
+		allow = rule.allow
+		length = len(rule.path)
+	}
+
+	return allow
+}
+
+// load returns rules of host, robots.txt is fetched if not cached or expired
+func (r *RobotsChecker) load(u *url.URL) *robotsRules {
+	if v, ok := r.cache.Load(u.Host); ok && time.Now().Before(v.(*robotsRules).expire) {
+		return v.(*robotsRules)
+	}
+
+	rules := &robotsRules{expire: time.Now().Add(r.ttl)}
+	robotsURL := u.Scheme + "://" + u.Host + "/robots.txt"
+	resp := r.http.RequestGet(robotsURL, hs.DefaultHeader())
+	if resp != nil && resp.StatusCode == 200 {
+		rules.rules = parseRobots(resp.Body, r.agent)
+	} else {  // no robots.txt or fetch failed, allow all
+		log.WithFields(log.Fields{
+			"url":	robotsURL,
+		}).Info("can not get robots.txt, allow all by RobotsChecker")
+	}
+	r.cache.Store(u.Host, rules)
+
+	return rules
+}
+
+// Allowed returns true if page url is allowed by robots.txt of its host
+func (r *RobotsChecker) Allowed(pageURL string) bool {
+	u, err := url.Parse(pageURL)
+	if err != nil || len(u.Host) <= 0 {
+		return true
+	}
+	if r.allowList[strings.ToLower(u.Hostname())] {
+		return true
+	}
+
+	path := u.EscapedPath()
+	if len(path) <= 0 {
+		path = "/"
+	}
+	if len(u.RawQuery) > 0 {
+		path += "?" + u.RawQuery
+	}
+
+	if !r.load(u).allowed(path) {
+		log.WithFields(log.Fields{
+			"pageURL":	pageURL,
+		}).Info("page url is disallowed by robots.txt")
+
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,270 @@
+/*
+  Package sites for run parsers against saved pages offline and compare results with golden expected.json,
+  go test ./src/taskservice/sites/ [-run TestFixtures/<case>] [-update]
+*/
+
+package sites
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+
+	cm "siteResService/src/common"
+	ut "siteResService/src/util"
+)
+
+var update = flag.Bool("update", false, "rewrite expected.json by current results")
+
+// parsers supported by fixture case
+const (
+	fixtureCommonHTML	= "commonHTML"
+	fixtureCommonJSON	= "commonJSON"
+	fixtureSpecJSON		= "specJSON"
+	fixtureLoopJSON		= "loopJSON"
+	fixtureCustomHTML1	= "customHTML1"
+	fixtureCustomHTML2	= "customHTML2"
+	fixtureCustomJSON1	= "customJSON1"
+)
+
+// fixture dir and file names in case dir
+const (
+	fixtureDir			= "testdata/fixtures"
+	fixtureCaseFile		= "case.json"
+	fixturePageHTML		= "page.html"
+	fixtureOrderHTML	= "order.html"
+	fixturePageJSON		= "page.json"
+	fixtureExpected		= "expected.json"
+)
+
+// fixtureCase represents one offline parser case, saved in case.json of case dir
+type fixtureCase struct {
+	Parser		string			`json:"parser"`  // which parser to run, see fixture* constants
+	PageURL		string			`json:"page_url"`
+	Template	*SiteTemplate	`json:"template,omitempty"`  // used by commonHTML, commonJSON and specJSON
+	Selector	string			`json:"selector,omitempty"`  // used by loopJSON
+}
+
+// fixtureSite returns pointer of SiteService instance which never touch network or template file
+func fixtureSite() *SiteService {
+	s := new(SiteService)
+	s.currencyList = cm.GetCurrencyList()
+
+	return s
+}
+
+// loadFixtureHTML returns pointer of goquery.Document instance of saved html file, nil if not exist
+func loadFixtureHTML(filePath string) (*goquery.Document, error) {
+	if ok, _ := ut.PathExists(filePath); !ok {
+		return nil, nil
+	}
+
+	dat, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return goquery.NewDocumentFromReader(strings.NewReader(string(dat)))
+}
+
+// loadFixtureCase returns pointer of fixtureCase instance saved in case dir
+func loadFixtureCase(dir string) (*fixtureCase, error) {
+	dat, err := ioutil.ReadFile(path.Join(dir, fixtureCaseFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var fc fixtureCase
+	if err := jsoniter.Unmarshal(dat, &fc); err != nil {
+		return nil, err
+	}
+	if len(fc.PageURL) <= 0 {
+		return nil, errors.New("case do not have page url")
+	}
+
+	return &fc, nil
+}
+
+// runFixture returns parse result of saved pages in case dir,
+// *cm.ProInfo for template parsers, [][]string for loopJSON
+func runFixture(dir string) (interface{}, error) {
+	fc, err := loadFixtureCase(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := fixtureSite()
+	switch fc.Parser {
+	case fixtureCommonHTML, fixtureCustomHTML1, fixtureCustomHTML2:
+		doc, err := loadFixtureHTML(path.Join(dir, fixturePageHTML))
+		if err != nil {
+			return nil, err
+		}
+		if doc == nil {
+			return nil, errors.New("case do not have " + fixturePageHTML)
+		}
+
+		switch fc.Parser {
+		case fixtureCustomHTML1:
+			return s.parseCustomHTML1(fc.PageURL, doc), nil
+		case fixtureCustomHTML2:
+			return s.parseCustomHTML2(fc.PageURL, doc), nil
+		}
+
+		if fc.Template == nil {
+			return nil, errors.New("case do not have template")
+		}
+		orderDoc, err := loadFixtureHTML(path.Join(dir, fixtureOrderHTML))
+		if err != nil {
+			return nil, err
+		}
+
+		return s.ParseInfoCommonHTML(fc.PageURL, doc, orderDoc, fc.Template.Labels()), nil
+	case fixtureCommonJSON, fixtureSpecJSON, fixtureLoopJSON, fixtureCustomJSON1:
+		body, err := ioutil.ReadFile(path.Join(dir, fixturePageJSON))
+		if err != nil {
+			return nil, err
+		}
+
+		switch fc.Parser {
+		case fixtureCustomJSON1:
+			return s.parseCustomJSON1(fc.PageURL, body), nil
+		case fixtureLoopJSON:
+			var dataList [][]string
+			iterativeLoopJSON(jsoniter.Get(body), fc.Selector, ut.GetMD5(fc.PageURL), "", -1, -1, &dataList)
+
+			return dataList, nil
+		}
+
+		if fc.Template == nil {
+			return nil, errors.New("case do not have template")
+		}
+		labels := fc.Template.Labels()
+		if fc.Parser == fixtureSpecJSON {
+			return &cm.ProInfo{
+				PageURL:	fc.PageURL,
+				Spec:		s.parseSpecJSON(body, fc.PageURL, labels.Spec),
+			}, nil
+		}
+
+		return s.ParseInfoCommonJSON(fc.PageURL, body, labels), nil
+	}
+
+	return nil, errors.New("unknown parser: " + fc.Parser)
+}
+
+// toGeneric returns json generic value of v, for compare by field
+func toGeneric(v interface{}) (interface{}, []byte, error) {
+	dat, err := jsoniter.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var g interface{}
+	if err := jsoniter.Unmarshal(dat, &g); err != nil {
+		return nil, nil, err
+	}
+
+	return g, dat, nil
+}
+
+// diffFields returns readable diff lines between expected and actual result
+func diffFields(expected interface{}, actual interface{}) []string {
+	var diffs []string
+	expMap, ok1 := expected.(map[string]interface{})
+	actMap, ok2 := actual.(map[string]interface{})
+	if !ok1 || !ok2 {
+		if !reflect.DeepEqual(expected, actual) {
+			exp, _ := jsoniter.Marshal(expected)
+			act, _ := jsoniter.Marshal(actual)
+			diffs = append(diffs, fmt.Sprintf("result\n    expected: %s\n    actual:   %s", exp, act))
+		}
+
+		return diffs
+	}
+
+	keys := make(map[string]bool)
+	for k := range expMap {
+		keys[k] = true
+	}
+	for k := range actMap {
+		keys[k] = true
+	}
+	var fields []string
+	for k := range keys {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		if reflect.DeepEqual(expMap[field], actMap[field]) {
+			continue
+		}
+
+		exp, _ := jsoniter.Marshal(expMap[field])
+		act, _ := jsoniter.Marshal(actMap[field])
+		diffs = append(diffs, fmt.Sprintf("%s\n    expected: %s\n    actual:   %s", field, exp, act))
+	}
+
+	return diffs
+}
+
+// TestFixtures runs each case under testdata/fixtures, -update rewrites goldens after an intended parser change
+func TestFixtures(t *testing.T) {
+	log.SetLevel(log.FatalLevel)  // selectors fall through are expected, keep output clean
+
+	infos, err := ioutil.ReadDir(fixtureDir)
+	if err != nil {
+		t.Fatalf("can not read fixture dir: %s", err.Error())
+	}
+
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+
+		dir := path.Join(fixtureDir, info.Name())
+		t.Run(info.Name(), func(t *testing.T) {
+			res, err := runFixture(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, dat, err := toGeneric(res)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			goldenPath := path.Join(dir, fixtureExpected)
+			if *update {
+				if err := ioutil.WriteFile(goldenPath, append(dat, '\n'), 0644); err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			golden, err := ioutil.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("%s, run with -update to create it", err.Error())
+			}
+			var expected interface{}
+			if err := jsoniter.Unmarshal(golden, &expected); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, d := range diffFields(expected, actual) {
+				t.Errorf("%s", d)
+			}
+		})
+	}
+}
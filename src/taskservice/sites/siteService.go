@@ -5,10 +5,7 @@
 package sites
 
 import (
-	"encoding/csv"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"math"
 	"net/url"
 	"os"
@@ -16,9 +13,11 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/astaxie/beego"
 	jsoniter "github.com/json-iterator/go"
 	log "github.com/sirupsen/logrus"
 
@@ -32,15 +31,18 @@ type SiteService struct {
 	http			*hs.ServiceHTTP
 	scheduler		*sc.Scheduler
 	currencyList	[]string  // currency list
-	SitesLabelMaps	sync.Map  // sites label maps
+	sitesLabelMaps	atomic.Value  // sites label maps, holds *sync.Map, swapped as a whole when templates reload
+	registry		*TemplateRegistry  // versioned templates of each domain
 }
 
 var instance *SiteService
 var initTaskOnce sync.Once
 var rootPath string
-var numMatch *regexp.Regexp
-var goodKVMatch *regexp.Regexp
-var multiValueMatch *regexp.Regexp
+
+// regexp for get style and value
+var numMatch = regexp.MustCompile(`(([1-9][0-9]*)+(.[0-9]{1,2}))`)  // start with none 0 and contains at most two decimal
+var goodKVMatch = regexp.MustCompile(`\{(.*)\}`)
+var multiValueMatch = regexp.MustCompile(`^\((.*)\)$`)
 
 // GetSiteServiceInstance return siteService pointer instance
 func GetSiteServiceInstance() *SiteService {
@@ -70,11 +72,7 @@ func (s *SiteService) init () {
 	s.scheduler = sc.GetScheduler()
 	s.currencyList = cm.GetCurrencyList()
 	s.initSitesLabelMaps()
-
-	// regexp for get style and value
-	numMatch = regexp.MustCompile(`(([1-9][0-9]*)+(.[0-9]{1,2}))`)  // start with none 0 and contains at most two decimal
-	goodKVMatch = regexp.MustCompile(`\{(.*)\}`)
-	multiValueMatch = regexp.MustCompile(`^\((.*)\)$`)
+	go s.watchTemplates()
 }
 
 // note !!!
@@ -94,68 +92,32 @@ func (s *SiteService) init () {
 // for json, the usage of separate "|" is the same as html,
 // and use ";" to indicates that the previous layer is list, ";" only use for cover, title, price, and only use once, for example:
 // "data|products|covers;name" means to get value in data: {product:{covers:[name:value,name:value]}}
-// addSiteResource for add site resource into SitesLabelMaps templates,
-// the sequence of params []string : domain,character,order,cover,title,price,desc,spec,goods,pageURL,type
-func (s *SiteService) addSiteResource(record []string) {
-	domain := record[0]
-	if len(domain) <= 0 {
-		log.Panic("can not get domain str")
-	}
-
-	domainMD5 := ut.GetMD5(domain)
-	charLabel := record[1]
-	orderLabels := strings.Split(record[2], "+")
-	// to avoid split empty field of record and return a list which len = 1 !!!
-	// and avoid "" string
-	if len(record[2]) <= 0 || record[2] == "" {
-		orderLabels = []string{}
-	}
-	coverLabels := strings.Split(record[3], "+")
-	if len(record[3]) <= 0 || record[3] == "" {
-		coverLabels = []string{}
-	}
-	titleLabels := strings.Split(record[4], "+")
-	if len(record[4]) <= 0 || record[4] == "" {
-		titleLabels = []string{}
-	}
-	priceLabels := strings.Split(record[5], "+")
-	if len(record[5]) <= 0 || record[5] == "" {
-		priceLabels = []string{}
-	}
-	descLabels := strings.Split(record[6], "+")
-	if len(record[6]) <= 0 || record[6] == "" {
-		descLabels = []string{}
-	}
-	goodLabels := strings.Split(record[7], "+")
-	if len(record[7]) <= 0 || record[7] == "" {
-		goodLabels = []string{}
-	}
-	specLabels := strings.Split(record[8], "+")
-	if len(record[8]) <= 0 || record[8] == "" {
-		specLabels = []string{}
-	}
+// the structured template (see SiteTemplate) is rendered into these labels.
+// addSiteTemplate for add site template into labelMaps templates, templates of the same domain are merged
+func addSiteTemplate(labelMaps map[string]*cm.LabelsParse, t *SiteTemplate) {
+	domainMD5 := ut.GetMD5(t.Domain)
+	labels := t.Labels()
 
-	value, ok := s.SitesLabelMaps.Load(domainMD5)
+	lab, ok := labelMaps[domainMD5]
 	if ok {  // insert new labels to exist domain template
-		lab := value.(*cm.LabelsParse)
-		lab.Character = charLabel
-		lab.Order = orderLabels
-		for _, cover := range coverLabels {
+		lab.Character = labels.Character
+		lab.Order = labels.Order
+		for _, cover := range labels.Cover {
 			lab.Cover = append(lab.Cover, cover)
 		}
-		for _, title := range titleLabels {
+		for _, title := range labels.Title {
 			lab.Title = append(lab.Title, title)
 		}
-		for _, price := range priceLabels {
+		for _, price := range labels.Price {
 			lab.Price = append(lab.Price, price)
 		}
-		for _, desc := range descLabels {
+		for _, desc := range labels.Desc {
 			lab.Desc = append(lab.Desc, desc)
 		}
-		for _, good := range goodLabels {
+		for _, good := range labels.Good {
 			lab.Good = append(lab.Good, good)
 		}
-		for _, spec := range specLabels {
+		for _, spec := range labels.Spec {
 			lab.Spec = append(lab.Spec, spec)
 		}
 
@@ -163,67 +125,62 @@ func (s *SiteService) addSiteResource(record []string) {
 	}
 
 	// add new domain template
-	labels := &cm.LabelsParse{
-		Character:	charLabel,
-		Order:		orderLabels,
-		Cover:		coverLabels,
-		Title:		titleLabels,
-		Price:		priceLabels,
-		Desc:		descLabels,
-		Good:		goodLabels,
-		Spec:		specLabels,
-	}
-	s.SitesLabelMaps.Store(domainMD5, labels)
+	labelMaps[domainMD5] = labels
 }
 
-func (s *SiteService) initSitesLabelMaps() {
-	dat, err := ioutil.ReadFile("./conf/templateResource.csv")
+// readTemplateFile returns new parsed labels of each domain md5 from template file,
+// ".json" file uses structured templates, others use positional csv templates
+func readTemplateFile(path string) (map[string]*cm.LabelsParse, error) {
+	var templates []*SiteTemplate
+	var err error
+	if strings.HasSuffix(path, ".json") {
+		templates, err = readTemplateJSON(path)
+	} else {
+		templates, err = readTemplateCSV(path)
+	}
 	if err != nil {
-		log.WithFields(log.Fields{
-			"path":		"./conf/templateResource.csv",
-			"error":	err.Error(),
-		}).Error("read templateResource file")
-
-		return
+		return nil, err
 	}
 
-	r := csv.NewReader(strings.NewReader(string(dat)))
-	for {
-		record, err := r.Read()
-		if err == io.EOF {
-			log.Info("finish read all template...")
+	labelMaps := make(map[string]*cm.LabelsParse)
+	for _, t := range templates {
+		addSiteTemplate(labelMaps, t)
 
-			break
-		}
+		// debug
+		log.WithFields(log.Fields{
+			"url":		t.SampleURL,
+			"domain":	t.Domain,
+			"labels":	*labelMaps[ut.GetMD5(t.Domain)],
+		}).Debug("template")
+	}
 
-		if err != nil {
-			log.WithFields(log.Fields{
-				"path":		"./conf/templateResource.csv",
-				"error":	err.Error(),
-			}).Panic("read templateResource line failed")
+	return labelMaps, nil
+}
 
-			continue
-		}
+// initSitesLabelMaps for load templates at start up
+func (s *SiteService) initSitesLabelMaps() {
+	path := beego.AppConfig.DefaultString("template::path", cm.TemplatePath)
+	s.registry = newTemplateRegistry(path)
+	s.sitesLabelMaps.Store(new(sync.Map))
 
-		if len(record) < 11 {
-			log.WithFields(log.Fields{
-				"record":	record,
-			}).Error("can not use this template, due to insufficient character")
-		}
+	if err := s.ReloadTemplates(); err != nil {
+		log.WithFields(log.Fields{
+			"path":		path,
+			"error":	err.Error(),
+		}).Panic("read templateResource file failed")
+	}
 
-		s.addSiteResource(record)
+	log.Info("finish read all template...")
+}
 
-		// debug
-		domain := record[0]
-		domainMD5 := ut.GetMD5(domain)
-		value, _ := s.SitesLabelMaps.Load(domainMD5)
-		labels := value.(*cm.LabelsParse)
-		log.WithFields(log.Fields{
-			"url":		record[9],
-			"domain":	domain,
-			"labels":	*labels,
-		}).Debug("template")
+// LoadLabels returns labels of current template version by domain md5
+func (s *SiteService) LoadLabels(domainMD5 string) (*cm.LabelsParse, bool) {
+	value, ok := s.sitesLabelMaps.Load().(*sync.Map).Load(domainMD5)
+	if !ok {
+		return nil, false
 	}
+
+	return value.(*cm.LabelsParse), true
 }
 
 // GetDocWebDriver returns pointer of goquery.Document instance
@@ -267,8 +224,13 @@ func GetResourceURL(imageSrc string, pageURL string) string {
 		imageURL = "http:" + imageSrc
 	} else if imageURL[0:1] == "/" {
 		imageURL = domain + imageSrc
-	} else {
-		imageURL = pageURL + imageSrc
+	} else {	// relative to dir of page url
+		ref, err := url.Parse(strings.NewReplacer("\r", "", "\n", "").Replace(imageSrc))
+		if err != nil {
+			return ""
+		}
+
+		imageURL = u.ResolveReference(ref).String()
 	}
 
 	imageURL = strings.ReplaceAll(imageURL, "\r", "")
@@ -0,0 +1,39 @@
+/*
+  Package sites for test resource url resolution of parsers
+*/
+
+package sites
+
+import (
+	"testing"
+)
+
+// TestGetResourceURL checks absolute, scheme relative, root relative and page relative sources
+func TestGetResourceURL(t *testing.T) {
+	pageURL := "https://www.ikigo.com.tw/index.php?route=product/product&product_id=1"
+
+	cases := []struct {
+		name		string
+		src		string
+		expected	string
+	}{
+		{"absolute", "https://img.ikigo.com.tw/a.jpg?v=1", "https://img.ikigo.com.tw/a.jpg"},
+		{"scheme", "//img.ikigo.com.tw/a.jpg", "http://img.ikigo.com.tw/a.jpg"},
+		{"root", "/image/data/a.jpg", "https://www.ikigo.com.tw/image/data/a.jpg"},
+		{"relative", "image/cache/data/a.jpg", "https://www.ikigo.com.tw/image/cache/data/a.jpg"},
+		{"parent", "../image/a.jpg", "https://www.ikigo.com.tw/image/a.jpg"},
+		{"newline", "image/a\r\n.jpg", "https://www.ikigo.com.tw/image/a.jpg"},
+		{"short", "a.jpg", ""},
+		{"malformed", "image/%zz.jpg", ""},
+	}
+
+	for _, c := range cases {
+		if imageURL := GetResourceURL(c.src, pageURL); imageURL != c.expected {
+			t.Errorf("%s: GetResourceURL(%q) = %q, expected %q", c.name, c.src, imageURL, c.expected)
+		}
+	}
+
+	if imageURL := GetResourceURL("images/a.jpg", "https://shop.example.com/goods/detail.html"); imageURL != "https://shop.example.com/goods/images/a.jpg" {
+		t.Errorf("resolve against page dir: got %q", imageURL)
+	}
+}
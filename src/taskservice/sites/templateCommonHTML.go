@@ -19,6 +19,7 @@ func (s *SiteService) ParseInfoCommonHTML(pageURL string, doc *goquery.Document,
 	var pi cm.ProInfo
 	pi.PageURL = pageURL
 	pi.Template = "templateCommonHTML"
+	pi.TemplateVersion = labels.Version
 
 	// get page html document
 	if doc == nil {
@@ -21,6 +21,7 @@ func (s *SiteService) ParseInfoCommonJSON(pageURL string, body []byte, labels *c
 	var pi cm.ProInfo
 	pi.PageURL = pageURL
 	pi.Template = "templateCommonJson"
+	pi.TemplateVersion = labels.Version
 
 	if body == nil || len(body) <= 0 {
 		log.WithFields(log.Fields{
@@ -16,10 +16,6 @@ https://www.ikigo.com.tw/index.php?route=product/product&path=4_255_371&product_
 */
 // ParseInfoCustomHTML1 for custom html template returns pointer of ProInfo instance
 func (s *SiteService) ParseInfoCustomHTML1(pageURL string) *cm.ProInfo {
-	var pi cm.ProInfo
-	pi.PageURL = pageURL
-	pi.Template = "templateCustomHTML1"
-
 	// get page html document
 	doc := s.http.GetDocRequestGet(pageURL)
 	if doc == nil {
@@ -27,9 +23,18 @@ func (s *SiteService) ParseInfoCustomHTML1(pageURL string) *cm.ProInfo {
 			"pageURL":	pageURL,
 		}).Error("http request get page failed by templateCustomHTML1")
 
-		return &pi
+		return &cm.ProInfo{PageURL: pageURL, Template: "templateCustomHTML1"}
 	}
 
+	return s.parseCustomHTML1(pageURL, doc)
+}
+
+// parseCustomHTML1 for parse page document of custom html template 1 returns pointer of ProInfo instance
+func (s *SiteService) parseCustomHTML1(pageURL string, doc *goquery.Document) *cm.ProInfo {
+	var pi cm.ProInfo
+	pi.PageURL = pageURL
+	pi.Template = "templateCustomHTML1"
+
 	// head image
 	var images []string
 	//imageDir := cm.ImageDir + time.Now().Format("2006/01/02")
@@ -49,19 +49,24 @@ func (s *SiteService) parse2(pageURL string) *cm.ProInfo {
 
 // parse1 for parse
 func (s *SiteService) parse1(pageURL string) *cm.ProInfo {
-	var pi cm.ProInfo
-	pi.PageURL = pageURL
-	pi.Template = "templateCustomHTML2"
-
 	doc := s.http.GetDocRequestGet(pageURL)
 	if doc == nil {
 		log.WithFields(log.Fields{
 			"pageURL":	pageURL,
 		}).Error("http request get page failed by templateCustomHTML2")
 
-		return &pi
+		return &cm.ProInfo{PageURL: pageURL, Template: "templateCustomHTML2"}
 	}
 
+	return s.parseCustomHTML2(pageURL, doc)
+}
+
+// parseCustomHTML2 for parse page document of custom html template 2 returns pointer of ProInfo instance
+func (s *SiteService) parseCustomHTML2(pageURL string, doc *goquery.Document) *cm.ProInfo {
+	var pi cm.ProInfo
+	pi.PageURL = pageURL
+	pi.Template = "templateCustomHTML2"
+
 	var images []string
 	coverPath, ok := doc.Find(".product_info>img").Attr("src")
 	//imageDir := cm.ImageDir + time.Now().Format("2006/01/02")
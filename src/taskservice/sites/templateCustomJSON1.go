@@ -46,10 +46,19 @@ func (s *SiteService) ParseInfoCustomJSON1(pageURL string) *cm.ProInfo {
 		return &pi
 	}
 
+	return s.parseCustomJSON1(pageURL, resp.Body)
+}
+
+// parseCustomJSON1 for parse response body of custom json template 1 returns pointer of ProInfo instance
+func (s *SiteService) parseCustomJSON1(pageURL string, body []byte) *cm.ProInfo {
+	var pi cm.ProInfo
+	pi.PageURL = pageURL
+	pi.Template = "templateCustomJson1"
+
 	// head image
 	var images []string
 	// download image
-	cover := jsoniter.Get(resp.Body, "info", "cover").ToString()
+	cover := jsoniter.Get(body, "info", "cover").ToString()
 	imageSrc := cm.T1CND + cover
 	imageURL := GetResourceURL(imageSrc, pageURL)
 	images = append(images, imageURL)
@@ -67,16 +76,16 @@ func (s *SiteService) ParseInfoCustomJSON1(pageURL string) *cm.ProInfo {
 	//}
 
 	// title
-	pi.Title = jsoniter.Get(resp.Body, "info", "name").ToString()
+	pi.Title = jsoniter.Get(body, "info", "name").ToString()
 
 	// price
-	//pi.Price = jsoniter.Get(resp.Body, "info", "cover").ToString()
+	//pi.Price = jsoniter.Get(body, "info", "cover").ToString()
 
 	//
 	//pi.ID = ids[1] // doc.Find(".pw-s").Text()
 
 	// description
-	pi.Desc = jsoniter.Get(resp.Body, "info", "content").ToString()
+	pi.Desc = jsoniter.Get(body, "info", "content").ToString()
 	//pi.Desc = s.ReplaceImagePaths(pi.Desc, pageURL)
 
 	// specifications
@@ -0,0 +1,244 @@
+/*
+  Package sites for parse site template
+*/
+
+package sites
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego"
+	log "github.com/sirupsen/logrus"
+
+	cm "siteResService/src/common"
+	ut "siteResService/src/util"
+)
+
+// TemplateVersion represents one parsed version of a domain template
+type TemplateVersion struct {
+	Version		int
+	LoadTime	time.Time
+	Labels		*cm.LabelsParse
+}
+
+// TemplateRegistry represents versioned templates of all domains
+type TemplateRegistry struct {
+	path		string  // template file path
+	lock		sync.Mutex  // serialize reload and rollback
+	history		map[string][]*TemplateVersion  // domain md5 mapping versions, the last one is current
+	lastVersion	map[string]int  // domain md5 mapping last version number given, only increases, not reset by rollback
+	modTime		time.Time  // template file modify time when last reload
+	maxHistory	int  // max versions kept for each domain
+}
+
+// newTemplateRegistry returns pointer of TemplateRegistry instance
+func newTemplateRegistry(path string) *TemplateRegistry {
+	r := new(TemplateRegistry)
+	r.path = path
+	r.history = make(map[string][]*TemplateVersion)
+	r.lastVersion = make(map[string]int)
+	r.maxHistory = beego.AppConfig.DefaultInt("template::maxHistory", cm.TemplateMaxHistory)
+	if r.maxHistory <= 0 {  // at least current version must be kept
+		log.WithFields(log.Fields{
+			"maxHistory":	r.maxHistory,
+		}).Error("maxHistory of template must be positive, use default")
+		r.maxHistory = cm.TemplateMaxHistory
+	}
+
+	return r
+}
+
+// sameLabels returns true if two labels are the same except version
+func sameLabels(a *cm.LabelsParse, b *cm.LabelsParse) bool {
+	ac := *a
+	bc := *b
+	ac.Version = 0
+	bc.Version = 0
+
+	return reflect.DeepEqual(ac, bc)
+}
+
+// current returns current version of domain template, must hold lock
+func (r *TemplateRegistry) current(domainMD5 string) *TemplateVersion {
+	versions := r.history[domainMD5]
+	if len(versions) <= 0 {
+		return nil
+	}
+
+	return versions[len(versions) - 1]
+}
+
+// labelMaps returns new label maps build from current versions, must hold lock
+func (r *TemplateRegistry) labelMaps() *sync.Map {
+	maps := new(sync.Map)
+	for domainMD5 := range r.history {
+		if cur := r.current(domainMD5); cur != nil {
+			maps.Store(domainMD5, cur.Labels)
+		}
+	}
+
+	return maps
+}
+
+// ReloadTemplates for parse template file again and swap sites label maps,
+// domain template whose labels changed get a new version
+func (s *SiteService) ReloadTemplates() error {
+	r := s.registry
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := readTemplateFile(r.path)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	history := make(map[string][]*TemplateVersion)
+	for domainMD5, labels := range parsed {
+		versions := r.history[domainMD5]
+		cur := r.current(domainMD5)
+		if cur != nil && sameLabels(cur.Labels, labels) {  // not changed, keep current version
+			history[domainMD5] = versions
+
+			continue
+		}
+
+		r.lastVersion[domainMD5]++  // never reuse a number rolled back or dropped
+		version := r.lastVersion[domainMD5]
+		labels.Version = version
+		versions = append(versions, &TemplateVersion{
+			Version:	version,
+			LoadTime:	now,
+			Labels:		labels,
+		})
+		if len(versions) > r.maxHistory {
+			versions = versions[len(versions) - r.maxHistory :]
+		}
+		history[domainMD5] = versions
+
+		log.WithFields(log.Fields{
+			"domain":	labels.Domain,
+			"version":	version,
+		}).Info("template updated")
+	}
+
+	r.history = history
+	r.modTime = info.ModTime()
+	s.sitesLabelMaps.Store(r.labelMaps())
+
+	log.WithFields(log.Fields{
+		"path":		r.path,
+		"domains":	len(history),
+	}).Info("reload templates success")
+
+	return nil
+}
+
+// RollbackTemplate for roll back domain template to previous version, returns the version in use
+func (s *SiteService) RollbackTemplate(domain string) (int, error) {
+	r := s.registry
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	domainMD5 := ut.GetMD5(domain)
+	versions := r.history[domainMD5]
+	if len(versions) <= 0 {
+		return 0, errors.New("do not contains this domain template")
+	}
+	if len(versions) == 1 {
+		return versions[0].Version, errors.New("do not have previous version of this domain template")
+	}
+
+	r.history[domainMD5] = versions[: len(versions) - 1]
+	s.sitesLabelMaps.Store(r.labelMaps())
+
+	cur := r.current(domainMD5)
+	log.WithFields(log.Fields{
+		"domain":	domain,
+		"version":	cur.Version,
+	}).Info("template roll back")
+
+	return cur.Version, nil
+}
+
+// TemplateVersions returns all kept versions of each domain, the last one is current
+func (s *SiteService) TemplateVersions() map[string][]int {
+	r := s.registry
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	res := make(map[string][]int)
+	for _, versions := range r.history {
+		var nums []int
+		for _, v := range versions {
+			nums = append(nums, v.Version)
+		}
+		res[versions[len(versions) - 1].Labels.Domain] = nums
+	}
+
+	return res
+}
+
+// AllLabels returns labels of current version of all domain templates
+func (s *SiteService) AllLabels() []*cm.LabelsParse {
+	r := s.registry
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var labels []*cm.LabelsParse
+	for domainMD5 := range r.history {
+		if cur := r.current(domainMD5); cur != nil {
+			labels = append(labels, cur.Labels)
+		}
+	}
+
+	return labels
+}
+
+// watchTemplates for reload templates when template file modified
+func (s *SiteService) watchTemplates() {
+	gap := beego.AppConfig.DefaultInt("template::watchGap", cm.TemplateWatchGap)
+	if gap <= 0 {
+		log.Info("template watch is disabled")
+
+		return
+	}
+
+	r := s.registry
+	for {
+		time.Sleep(time.Duration(gap) * time.Second)
+
+		info, err := os.Stat(r.path)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"path":		r.path,
+				"error":	err.Error(),
+			}).Error("can not stat template file by watchTemplates")
+
+			continue
+		}
+
+		r.lock.Lock()
+		modified := !info.ModTime().Equal(r.modTime)
+		r.lock.Unlock()
+		if !modified {
+			continue
+		}
+
+		if err := s.ReloadTemplates(); err != nil {
+			log.WithFields(log.Fields{
+				"path":		r.path,
+				"error":	err.Error(),
+			}).Error("reload templates failed, keep using old templates")
+		}
+	}
+}
@@ -0,0 +1,71 @@
+/*
+  Package sites for test versions of reloaded and rolled back templates
+*/
+
+package sites
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// registryTestTemplate is json template file of one domain with title selector
+const registryTestTemplate = `{"templates": [{"domain": "registry.example.com", "character": "html", "title": [{"raw": "%s"}]}]}`
+
+// writeRegistryTemplate for write template file with title selector and make its modify time differ
+func writeRegistryTemplate(t *testing.T, file string, title string, n int) {
+	t.Helper()
+
+	if err := ioutil.WriteFile(file, []byte(fmt.Sprintf(registryTestTemplate, title)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mod := time.Now().Add(time.Duration(n) * time.Second)
+	if err := os.Chtimes(file, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestTemplateVersionAfterRollback checks version numbers are never reused after rollback
+func TestTemplateVersionAfterRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templateRegistry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "template.json")
+	s := new(SiteService)
+	s.registry = newTemplateRegistry(file)
+	s.sitesLabelMaps.Store(new(sync.Map))
+
+	for i, title := range []string{"h1", "h2", "h3"} {
+		writeRegistryTemplate(t, file, title, i)
+		if err := s.ReloadTemplates(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	version, err := s.RollbackTemplate("registry.example.com")
+	if err != nil || version != 2 {
+		t.Fatalf("rollback returns version %d, error %v, expected version 2", version, err)
+	}
+
+	writeRegistryTemplate(t, file, "h4", 3)
+	if err := s.ReloadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	versions := s.TemplateVersions()["registry.example.com"]
+	if !reflect.DeepEqual(versions, []int{1, 2, 4}) {
+		t.Fatalf("versions %v, expected [1 2 4]", versions)
+	}
+	if labels := s.AllLabels(); len(labels) != 1 || labels[0].Version != 4 {
+		t.Fatalf("current labels %+v, expected version 4", labels)
+	}
+}
@@ -0,0 +1,368 @@
+/*
+  Package sites for parse site template
+*/
+
+package sites
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+
+	cm "siteResService/src/common"
+)
+
+const (
+	// csvAlternateSeparate for separate alternate selectors of one field in csv template
+	csvAlternateSeparate = "+"
+	// csvMappingFlag for mark goods mapping layer in csv template
+	csvMappingFlag = "^"
+	// csvMinColumns for min columns of one csv template row: domain,character,order,cover,title,price,desc,good,spec
+	csvMinColumns = 9
+	// csvWaitColumn for column of wait conditions in json
+	csvWaitColumn = 11
+	// csvOrderWaitColumn for column of order wait conditions in json
+	csvOrderWaitColumn = 12
+	// csvPolitenessColumn for column of politeness policy in json
+	csvPolitenessColumn = 13
+	// csvCacheTTLColumn for column of seconds pages are cached
+	csvCacheTTLColumn = 14
+)
+
+var pairMatch = regexp.MustCompile(`^\{([^:]*):(.*)\}$`)
+
+// TemplatePair represents titles and values of specifications, "{title:value}" in csv template
+type TemplatePair struct {
+	Title	string	`json:"title"`
+	Value	string	`json:"value"`
+}
+
+// TemplateSelector represents one layer of selector, layers are chained by Item when List is true
+type TemplateSelector struct {
+	Path	[]string			`json:"path,omitempty"`  // cascade labels, "|" in csv template
+	Multi	[]string			`json:"multi,omitempty"`  // values at the same layer, "(a,b)" in csv template
+	Pair	*TemplatePair		`json:"pair,omitempty"`  // titles and values of specifications
+	Mapping	bool				`json:"mapping,omitempty"`  // goods mapping layer, "^" in csv template
+	List	bool				`json:"list,omitempty"`  // this layer is a list, ";" in csv template
+	Item	*TemplateSelector	`json:"item,omitempty"`  // selector of each list item, only used when List is true
+	Raw		string				`json:"raw,omitempty"`  // selector in csv syntax, used as it is if set
+}
+
+// SiteTemplate represents structured template of one domain
+type SiteTemplate struct {
+	Domain		string				`json:"domain"`
+	Character	string				`json:"character"`  // html, json or web
+	SampleURL	string				`json:"sample_url,omitempty"`
+	Notes		string				`json:"notes,omitempty"`
+	Order		[]*TemplateSelector	`json:"order,omitempty"`
+	Cover		[]*TemplateSelector	`json:"cover,omitempty"`
+	Title		[]*TemplateSelector	`json:"title,omitempty"`
+	Price		[]*TemplateSelector	`json:"price,omitempty"`
+	Desc		[]*TemplateSelector	`json:"desc,omitempty"`
+	Good		[]*TemplateSelector	`json:"good,omitempty"`
+	Spec		[]*TemplateSelector	`json:"spec,omitempty"`
+	Wait		*cm.WaitCondition	`json:"wait,omitempty"`  // wait conditions of main page opened by web driver
+	OrderWait	*cm.WaitCondition	`json:"order_wait,omitempty"`  // wait conditions of order page opened by web driver
+	Politeness	*cm.PolitenessPolicy	`json:"politeness,omitempty"`  // crawl limits of this domain
+	CacheTTL	int					`json:"cache_ttl,omitempty"`  // seconds pages are cached, negative means do not cache
+}
+
+// TemplateFile represents structured template file
+type TemplateFile struct {
+	Templates	[]*SiteTemplate	`json:"templates"`
+}
+
+// String returns selector in csv syntax
+func (ts *TemplateSelector) String() string {
+	if ts == nil {
+		return ""
+	}
+	if len(ts.Raw) > 0 {
+		return ts.Raw
+	}
+
+	labels := append([]string{}, ts.Path...)
+	if len(ts.Multi) > 0 {
+		labels = append(labels, "(" + strings.Join(ts.Multi, ",") + ")")
+	}
+	if ts.Pair != nil {
+		labels = append(labels, "{" + ts.Pair.Title + ":" + ts.Pair.Value + "}")
+	}
+
+	str := strings.Join(labels, cm.LabelSeparate)
+	if ts.Mapping {
+		str += csvMappingFlag
+	}
+	if ts.List {
+		str += cm.ListSeparate + ts.Item.String()
+	}
+
+	return str
+}
+
+// parseSelectorLayer returns selector of one layer without list separate
+func parseSelectorLayer(layer string) *TemplateSelector {
+	ts := new(TemplateSelector)
+	if strings.HasSuffix(layer, csvMappingFlag) {
+		ts.Mapping = true
+		layer = strings.TrimSuffix(layer, csvMappingFlag)
+	}
+	if len(layer) <= 0 {
+		return ts
+	}
+
+	// the whole layer is a pair or multi values, they may contain "|" inside
+	if sub := pairMatch.FindStringSubmatch(layer); len(sub) > 2 {
+		ts.Pair = &TemplatePair{Title: sub[1], Value: sub[2]}
+
+		return ts
+	}
+	if sub := multiValueMatch.FindStringSubmatch(layer); len(sub) > 1 {
+		ts.Multi = strings.Split(sub[1], ",")
+
+		return ts
+	}
+
+	labels := strings.Split(layer, cm.LabelSeparate)
+	last := labels[len(labels) - 1]
+	if sub := pairMatch.FindStringSubmatch(last); len(sub) > 2 {
+		ts.Pair = &TemplatePair{Title: sub[1], Value: sub[2]}
+		labels = labels[: len(labels) - 1]
+	} else if sub := multiValueMatch.FindStringSubmatch(last); len(sub) > 1 {
+		ts.Multi = strings.Split(sub[1], ",")
+		labels = labels[: len(labels) - 1]
+	}
+	ts.Path = labels
+
+	return ts
+}
+
+// ParseSelector returns structured selector parsed from csv syntax,
+// the selector keeps csv syntax in Raw if it can not be rendered back to the same string
+func ParseSelector(label string) *TemplateSelector {
+	layers := strings.Split(label, cm.ListSeparate)
+	root := parseSelectorLayer(layers[0])
+	ts := root
+	for i := 1; i < len(layers); i++ {
+		ts.List = true
+		ts.Item = parseSelectorLayer(layers[i])
+		ts = ts.Item
+	}
+
+	if root.String() != label {
+		log.WithFields(log.Fields{
+			"label":	label,
+		}).Warn("can not structure this selector, keep it raw")
+
+		return &TemplateSelector{Raw: label}
+	}
+
+	return root
+}
+
+// parseSelectors returns structured selectors of one csv field, alternate selectors are separated by "+"
+func parseSelectors(field string) []*TemplateSelector {
+	// to avoid split empty field of record and return a list which len = 1 !!!
+	if len(field) <= 0 {
+		return nil
+	}
+
+	var selectors []*TemplateSelector
+	for _, label := range strings.Split(field, csvAlternateSeparate) {
+		selectors = append(selectors, ParseSelector(label))
+	}
+
+	return selectors
+}
+
+// selectorStrings returns labels in csv syntax, never returns nil
+func selectorStrings(selectors []*TemplateSelector) []string {
+	labels := []string{}
+	for _, ts := range selectors {
+		labels = append(labels, ts.String())
+	}
+
+	return labels
+}
+
+// Labels returns labels required for parsing page of this template
+func (t *SiteTemplate) Labels() *cm.LabelsParse {
+	return &cm.LabelsParse{
+		Domain:		t.Domain,
+		SampleURL:	t.SampleURL,
+		Character:	t.Character,
+		Order:		selectorStrings(t.Order),
+		Cover:		selectorStrings(t.Cover),
+		Title:		selectorStrings(t.Title),
+		Price:		selectorStrings(t.Price),
+		Desc:		selectorStrings(t.Desc),
+		Good:		selectorStrings(t.Good),
+		Spec:		selectorStrings(t.Spec),
+		Wait:		t.Wait,
+		OrderWait:	t.OrderWait,
+		Politeness:	t.Politeness,
+		CacheTTL:	t.CacheTTL,
+	}
+}
+
+// parseRecordJSON for unmarshal json of csv column into v, returns false if column not exist or empty
+func parseRecordJSON(record []string, column int, v interface{}) (bool, error) {
+	if len(record) <= column || len(strings.TrimSpace(record[column])) <= 0 {
+		return false, nil
+	}
+
+	if err := jsoniter.UnmarshalFromString(record[column], v); err != nil {
+		return false, fmt.Errorf("can not parse json of column %d: %s", column + 1, err.Error())
+	}
+
+	return true, nil
+}
+
+// templateFromRecord returns template of one csv row,
+// the sequence of record : domain,character,order,cover,title,price,desc,good,spec,pageURL,notes,wait,orderWait,politeness,cacheTTL
+func templateFromRecord(record []string) (*SiteTemplate, error) {
+	if len(record) < csvMinColumns {
+		return nil, errors.New("can not use this template, due to insufficient character")
+	}
+	if len(record[0]) <= 0 {
+		return nil, errors.New("can not get domain str of template")
+	}
+
+	t := &SiteTemplate{
+		Domain:		record[0],
+		Character:	record[1],
+		Order:		parseSelectors(record[2]),
+		Cover:		parseSelectors(record[3]),
+		Title:		parseSelectors(record[4]),
+		Price:		parseSelectors(record[5]),
+		Desc:		parseSelectors(record[6]),
+		Good:		parseSelectors(record[7]),
+		Spec:		parseSelectors(record[8]),
+	}
+	if len(record) > 9 {
+		t.SampleURL = record[9]
+	}
+	if len(record) > 10 {
+		t.Notes = record[10]
+	}
+
+	wait := new(cm.WaitCondition)
+	if ok, err := parseRecordJSON(record, csvWaitColumn, wait); err != nil {
+		return nil, err
+	} else if ok {
+		t.Wait = wait
+	}
+	orderWait := new(cm.WaitCondition)
+	if ok, err := parseRecordJSON(record, csvOrderWaitColumn, orderWait); err != nil {
+		return nil, err
+	} else if ok {
+		t.OrderWait = orderWait
+	}
+	politeness := new(cm.PolitenessPolicy)
+	if ok, err := parseRecordJSON(record, csvPolitenessColumn, politeness); err != nil {
+		return nil, err
+	} else if ok {
+		t.Politeness = politeness
+	}
+	if _, err := parseRecordJSON(record, csvCacheTTLColumn, &t.CacheTTL); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// readTemplateCSV returns templates of positional csv template file, rows which can not be used are skipped
+func readTemplateCSV(path string) ([]*SiteTemplate, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var templates []*SiteTemplate
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1  // rows may have different columns, checked by templateFromRecord
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		t, err := templateFromRecord(record)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"path":		path,
+				"line":		line,
+				"record":	record,
+				"error":	err.Error(),
+			}).Error("skip template row by readTemplateCSV")
+
+			continue
+		}
+
+		templates = append(templates, t)
+	}
+
+	return templates, nil
+}
+
+// readTemplateJSON returns templates of structured json template file, templates without domain are skipped
+func readTemplateJSON(path string) ([]*SiteTemplate, error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file TemplateFile
+	if err := jsoniter.Unmarshal(dat, &file); err != nil {
+		return nil, err
+	}
+
+	var templates []*SiteTemplate
+	for i, t := range file.Templates {
+		if t == nil || len(t.Domain) <= 0 {
+			log.WithFields(log.Fields{
+				"path":		path,
+				"index":	i,
+			}).Error("skip template without domain by readTemplateJSON")
+
+			continue
+		}
+
+		templates = append(templates, t)
+	}
+
+	return templates, nil
+}
+
+// ConvertTemplateCSV for convert positional csv template file to structured json template file
+func ConvertTemplateCSV(srcPath string, dstPath string) error {
+	templates, err := readTemplateCSV(srcPath)
+	if err != nil {
+		return err
+	}
+
+	dat, err := jsoniter.MarshalIndent(TemplateFile{Templates: templates}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(dstPath, dat, 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("convert %d templates from %s to %s\n", len(templates), srcPath, dstPath)
+
+	return nil
+}
@@ -0,0 +1,90 @@
+/*
+  Package sites for parse site template
+*/
+
+package sites
+
+import (
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+
+	cm "siteResService/src/common"
+)
+
+// FieldReport represents selectors match result of one field of template
+type FieldReport struct {
+	Field		string
+	Matched		[]string  // selectors which get value, the first one is used by parser
+	FellThrough	[]string  // selectors which get nothing
+}
+
+// newFieldReport returns pointer of FieldReport instance, match function returns true if selector get value
+func newFieldReport(field string, selectors []string, match func(selector string) bool) *FieldReport {
+	fr := &FieldReport{Field: field}
+	for _, selector := range selectors {
+		if match(selector) {
+			fr.Matched = append(fr.Matched, selector)
+		} else {
+			fr.FellThrough = append(fr.FellThrough, selector)
+		}
+	}
+
+	return fr
+}
+
+// ValidateLabelsHTML returns match result of each field by html template, mirrors ParseInfoCommonHTML
+func (s *SiteService) ValidateLabelsHTML(pageURL string, doc *goquery.Document, orderDoc *goquery.Document, labels *cm.LabelsParse) []*FieldReport {
+	imageDir := cm.ImageDir + time.Now().Format("2006/01/02")
+	goodDoc := doc  // main and order at the same page or can find order page
+	if orderDoc != nil {
+		goodDoc = orderDoc
+	}
+
+	return []*FieldReport{
+		newFieldReport("cover", labels.Cover, func(selector string) bool {
+			return len(s.parseCoverImagesHTML(doc, pageURL, imageDir, []string{selector})) > 0
+		}),
+		newFieldReport("title", labels.Title, func(selector string) bool {
+			return len(s.parseTitleHTML(doc, []string{selector})) > 0
+		}),
+		newFieldReport("price", labels.Price, func(selector string) bool {
+			return len(s.parsePriceHTML(doc, []string{selector})) > 0
+		}),
+		newFieldReport("desc", labels.Desc, func(selector string) bool {
+			return len(s.parseDescHTML(doc, pageURL, imageDir, []string{selector})) > 0
+		}),
+		newFieldReport("good", labels.Good, func(selector string) bool {
+			return len(s.parseGoodHTML(goodDoc, pageURL, imageDir, []string{selector})) > 0
+		}),
+		newFieldReport("spec", labels.Spec, func(selector string) bool {
+			return len(s.parseSpecHTML(goodDoc, pageURL, imageDir, []string{selector})) > 0
+		}),
+	}
+}
+
+// ValidateLabelsJSON returns match result of each field by json template, mirrors ParseInfoCommonJSON
+func (s *SiteService) ValidateLabelsJSON(pageURL string, body []byte, labels *cm.LabelsParse) []*FieldReport {
+	imageDir := cm.ImageDir + time.Now().Format("2006/01/02")
+
+	return []*FieldReport{
+		newFieldReport("cover", labels.Cover, func(selector string) bool {
+			return len(s.parseCoverImagesJSON(body, pageURL, imageDir, []string{selector})) > 0
+		}),
+		newFieldReport("title", labels.Title, func(selector string) bool {
+			return len(s.parseTitleJSON(body, []string{selector})) > 0
+		}),
+		newFieldReport("price", labels.Price, func(selector string) bool {
+			return len(s.parsePriceJSON(body, []string{selector})) > 0
+		}),
+		newFieldReport("desc", labels.Desc, func(selector string) bool {
+			return len(s.parseDescJSON(body, pageURL, []string{selector})) > 0
+		}),
+		newFieldReport("good", labels.Good, func(selector string) bool {
+			return len(s.parseGoodJSON(body, pageURL, []string{selector})) > 0
+		}),
+		newFieldReport("spec", labels.Spec, func(selector string) bool {
+			return len(s.parseSpecJSON(body, pageURL, []string{selector})) > 0
+		}),
+	}
+}
@@ -5,6 +5,8 @@
 package taskservice
 
 import (
+	"errors"
+	"fmt"
 	"net/url"
 	"os/exec"
 	"strconv"
@@ -14,250 +16,75 @@ import (
 	"github.com/PuerkitoBio/goquery"
 	jsoniter "github.com/json-iterator/go"
 	log "github.com/sirupsen/logrus"
-	"github.com/tebeka/selenium"
 
 	cm "siteResService/src/common"
+	hs "siteResService/src/httpservice"
+	mt "siteResService/src/metrics"
 	md "siteResService/src/mysqlclient/models"
 	ut "siteResService/src/util"
 )
 
-// redirectToOrderPage for click order and jump to order page, return yes if redirect success
-func redirectOrderPage (wd *selenium.WebDriver, pageURL string, orderLabel string) bool {
-	anchors, err := (*wd).FindElements(selenium.ByCSSSelector, orderLabel)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"url":		pageURL,
-			"cssValue":	orderLabel,
-			"error":	err.Error(),
-		}).Error("can not find css element by redirectOrderPage")
-
-		return false
-	}
+// ErrNoTemplate returned when domain of page do not have template
+var ErrNoTemplate = errors.New("domain of page do not have template")
 
-	// click href
-	clickFlag := false
-	for _, a := range anchors {
-		err := a.Click()
-		if err != nil {
-			log.WithFields(log.Fields{
-				"url":		pageURL,
-				"error":	err.Error(),
-			}).Error("send keys failed by redirectOrderPage")
+// ErrTemplateBroken returned when page fetched but template can not parse it
+var ErrTemplateBroken = errors.New("page fetched but template can not parse it")
 
-			continue
-		}
+// ErrBadURL returned when page url is not an absolute http url
+var ErrBadURL = errors.New("page url must be an absolute http or https url")
 
-		clickFlag = true
+// ErrRobotsDisallowed returned when robots.txt of host disallow page url
+var ErrRobotsDisallowed = errors.New("page url is disallowed by robots.txt")
 
-		break
-	}
+// ErrUnknownField returned when selected field is not a field of site resource
+var ErrUnknownField = errors.New("unknown field of site resource")
 
-	// if click failed, return
-	if !clickFlag {
-		log.Error("click order failed by redirectOrderPage")
+// ResourceFields for fields of site resource can be selected
+var ResourceFields = []string{"cover", "title", "currency", "price", "desc", "good", "spec"}
 
+// checkResLegal returns true if the resource is legal
+func checkResLegal(pi *cm.ProInfo) bool {
+	if pi != nil && len(pi.Cover) > 0 && len(pi.Desc) > 0 {
+		return true
+	} else {
 		return false
 	}
-
-	return true
-}
-
-// getDocWebDriver returns pointer of goquery.Document instance by web driver
-func getDocWebDriver(wd *selenium.WebDriver, pageURL string) *goquery.Document {
-	source, errP := (*wd).PageSource()
-	if errP != nil {
-		log.WithFields(log.Fields{
-			"pageURL":	pageURL,
-			"error":	errP.Error(),
-		}).Error("can not get page source by getDocWebDriver")
-
-		return nil
-	}
-
-	// get page body html document
-	html := source
-	doc, errD := goquery.NewDocumentFromReader(strings.NewReader(html))
-	if errD != nil {
-		log.WithFields(log.Fields{
-			"pageURL":	pageURL,
-			"error":	errD.Error(),
-		}).Error("new document failed by getDocWebDriver")
-
-		return nil
-	}
-
-	return doc
-}
-
-// requestDocWebDriver returns currentURL and pointer of main page and order page body goquery.Document by web driver
-func (t *TaskService) requestDocWebDriver(pageURL string) (string, *goquery.Document, *goquery.Document) {
-	wd := t.httpService.GetURLWebDriver(pageURL)
-	if wd == nil {
-		log.WithFields(log.Fields{
-			"pageURL":	pageURL,
-		}).Error("get web driver failed by requestDocWebDriver")
-
-		return "", nil, nil
-	}
-
-	currentURL, errU := (*wd).CurrentURL()
-	if errU != nil {
-		log.WithFields(log.Fields{
-			"pageURL":	pageURL,
-			"error":	errU.Error(),
-		}).Error("can not get current url by requestDocWebDriver")
-
-		return "", nil, nil
-	}
-
-	// get main page doc
-	doc := getDocWebDriver(wd, pageURL)
-	if doc == nil {
-		return currentURL, nil, nil
-	}
-
-	// get order label
-	u, _ := url.Parse(currentURL)
-	domainMD5 := ut.GetMD5(u.Host)
-	value, ok := t.site.SitesLabelMaps.Load(domainMD5)
-	if !ok {
-		log.WithFields(log.Fields{
-			"url":		currentURL,
-			"domain":	u.Host,
-		}).Error("do not contains this domain template by requestDocWebDriver")
-
-		return currentURL, doc, nil
-	}
-
-	// redirect order page
-	labels := value.(*cm.LabelsParse)
-	if len(labels.Order) <= 0 {
-		log.Info("do not need order page by requestDocWebDriver")
-
-		return currentURL, doc, nil
-	}
-
-	redirect := false  // for judge redirect status
-	for _, labelOrder := range labels.Order {
-		if len(labelOrder) <= 0 {
-			continue
-		}
-
-		if redirectOrderPage(wd, pageURL, labelOrder) {
-			redirect = true
-			// waite to complete load the page
-			time.Sleep(time.Duration(3) * time.Second)
-
-			break
-		}
-	}
-
-	// get order page doc only if redirect success
-	if redirect {
-		orderDoc := getDocWebDriver(wd, pageURL)
-		if orderDoc != nil {
-			return currentURL, doc, orderDoc
-		}
-	}
-
-	log.Error("web driver load order page failed by requestDocWebDriver")
-
-	return currentURL, doc, nil
 }
 
-
-// getOrderHref returns order href
-func getOrderHref(doc *goquery.Document, pageURL string, orderLabel string) string {
-	selectors := strings.Split(orderLabel, cm.LabelSeparate)
-	selection := doc.Find(selectors[0])
-	for i := 1; i < len(selectors); i++ {  // cascade find label
-		selection = selection.Find(selectors[i])
-	}
-
-	// find order href
-	var href string
-	selection.Each(func(i int, selc *goquery.Selection) {
-		href, _ = selection.Attr("href")
-	})
-
-	// get order href
-	if len(href) > 0 {
-		index := strings.LastIndex(pageURL, "/")
-		if index > 0 {
-			return pageURL[: index] + href
-		}
-
-		return href
+// observeParse for count parse of page url by error code, ok if err is nil
+func observeParse(err error) {
+	var code string
+	if err != nil {
+		code = ErrorCode(err)
 	}
-
-	return ""
+	mt.ObserveParse(code)
 }
 
-// requestDocHTTP returns main doc and order doc pointer of goquery.Document instance by http request get
-func (t *TaskService) requestDocHTTP(pageURL string, orderLabels []string) (*goquery.Document, *goquery.Document) {
-	doc := t.httpService.GetDocRequestGet(pageURL)
-	if doc == nil {
-		return nil, nil
-	}
-
-	var orderURL string
-	for _, label := range orderLabels {
-		if len(label) <= 0 {
-			continue
-		}
-
-		// get order doc
-		orderURL = getOrderHref(doc, pageURL, label)
-		if len(orderURL) > 0 {
-			break
+// parsePage returns pointer of ProInfo instance parsed from fetched page by template
+func (t *TaskService) parsePage(page *Page, labels *cm.LabelsParse) *cm.ProInfo {
+	if labels.Character == cm.JSONFormat {
+		if page.Body == nil {
+			return nil
 		}
-	}
-
-	// set orderLabels but notdfind order href, return nil to use web driver to get page again
-	if len(orderLabels) > 0 {
-		if len(orderURL) <= 0 {  // can not get href
-			log.Info("can not find order href, use web driver to get page again")
 
-			return nil, nil
-		} else {
-			if !strings.Contains(orderURL, "/") {  // href not a path, not legal
-				log.Info("can not find order href, use web driver to get page again")
-
-				return nil, nil
-			}
-		}
+		return t.site.ParseInfoCommonJSON(page.URL, page.Body, labels)
 	}
 
-	if len(orderURL) <= 0 {
-		log.Info("do not need order page by requestDocHTTP")
-
-		return doc, nil
-	}
-
-	// request order page doc only if get order url success
-	orderDoc := t.httpService.GetDocRequestGet(orderURL)
-	if orderDoc == nil {
-		log.Error("request get order doc failed by requestDocHTTP")
-
-		return doc, nil
+	if page.Doc == nil {
+		return nil
 	}
 
-	return doc, orderDoc
+	return t.site.ParseInfoCommonHTML(page.URL, page.Doc, page.OrderDoc, labels)
 }
 
-
-// checkResLegal returns true if the resource is legal
-func checkResLegal(pi *cm.ProInfo) bool {
-	if pi != nil && len(pi.Cover) > 0 && len(pi.Desc) > 0 {
-		return true
-	} else {
-		return false
+// parseWebPage for parse web page of this pageURL to get site resource,
+// error is *hs.FetchError if site failed (hs.IsSiteDown tells site down), ErrTemplateBroken if page can not be parsed,
+// ErrBadURL if page url is malformed, web driver is not tried if site is down, browser would get the error page too
+func (t *TaskService) parseWebPage(pageURL string) (*cm.ProInfo, error) {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, ErrBadURL
 	}
-}
-
-// parseWebPage for parse web page of this pageURL to get site resource
-func (t *TaskService) parseWebPage(pageURL string) *cm.ProInfo {
-	u, _ := url.Parse(pageURL)
 	domainMD5 := ut.GetMD5(u.Host)
 
 	// debug
@@ -268,116 +95,137 @@ func (t *TaskService) parseWebPage(pageURL string) *cm.ProInfo {
 	}).Debug("enter TaskParseURL request get")
 
 	var pi *cm.ProInfo
-	value, ok := t.site.SitesLabelMaps.Load(domainMD5)
-	if ok {
-		labels := value.(*cm.LabelsParse)
-
+	var fetchErr error
+	labels, ok := t.site.LoadLabels(domainMD5)
+	if ok && labels.Character != cm.WebFormat {
 		// debug
 		log.WithFields(log.Fields{
 			"character":	labels.Character,
 			"order":		labels.Order,
+			"version":		labels.Version,
 		}).Debug("enter TaskParseURL request get")
 
-		if labels.Character == cm.HTMLFormat {  // use html template to parse
-			doc, orderDoc := t.requestDocHTTP(pageURL, labels.Order)
-
-			// ******************************* debug **************************
-			var docHTML string
-			var orderHTML string
-			if doc != nil {
-				docHTML,_ = doc.Html()
-			}
-			if orderDoc != nil {
-				orderHTML, _ = orderDoc.Html()
-			}
+		page, err := t.fetch(labels.Character, pageURL, labels)
+		if err != nil {
 			log.WithFields(log.Fields{
-				"order":		labels.Order,
-				"mainDoc":		docHTML,
-				"orderDoc":		orderHTML,
-			}).Debug("get page html by requestDocHTTP")
-			// ********************************************************************
-
-			if doc != nil {
-				pi = t.site.ParseInfoCommonHTML(pageURL, doc, orderDoc, labels)
-				if checkResLegal(pi) {
-					t.ResChan <- pi
-
-					return pi
-				}
+				"pageURL":		pageURL,
+				"character":	labels.Character,
+				"class":		hs.ErrorClass(err),
+				"error":		err.Error(),
+			}).Info("fetch page failed by parseWebPage")
+
+			// browser can not resolve host or load page of site down either
+			if hs.IsSiteDown(err) {
+				return nil, err
 			}
-		} else if labels.Character == cm.JSONFormat {  // use json template to parse
-			jsonByte := t.httpService.GetJsonRequestPost(pageURL)
-
-			// debug
-			log.WithFields(log.Fields{
-				"json":	string(jsonByte),
-			}).Debug("get page json by GetJsonRequestPost")
+			fetchErr = err
+		} else {
+			debugPage(page, "get page by fetcher of " + labels.Character)
 
-			if jsonByte != nil {
-				pi = t.site.ParseInfoCommonJSON(pageURL, jsonByte, labels)
-				if checkResLegal(pi) {
-					t.ResChan <- pi
+			pi = t.parsePage(page, labels)
+			mt.ObserveFields(pi)
+			if checkResLegal(pi) {
+				t.saveResult(pageURL, pi)
 
-					return pi
-				}
+				return pi, nil
 			}
 		}
 	}
 
 	// get doc by web driver if can not parse above
-	currentURL, doc, orderDoc := t.requestDocWebDriver(pageURL)
-	if doc == nil {
-		return nil
+	if ok && labels.Character != cm.WebFormat {
+		mt.ObserveFallthrough(labels)
 	}
-	u, _ = url.Parse(currentURL)
-	domainMD5 = ut.GetMD5(u.Host)
-	value, ok = t.site.SitesLabelMaps.Load(domainMD5)
-	labels := value.(*cm.LabelsParse)
+	page, err := t.fetch(cm.WebFormat, pageURL, labels)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"pageURL":	pageURL,
+			"class":	hs.ErrorClass(err),
+			"error":	err.Error(),
+		}).Error("fetch page failed by web driver by parseWebPage")
 
-	// ******************************* debug **************************
-	var docHTML string
-	var orderHTML string
-	if doc != nil {
-		docHTML,_ = doc.Html()
+		if fetchErr != nil {  // error of http fetch is the final one
+			return nil, fetchErr
+		}
+		if err == ErrNoFetcher && !ok {
+			return nil, ErrNoTemplate
+		}
+
+		return nil, err
 	}
-	if orderDoc != nil {
-		orderHTML, _ = orderDoc.Html()
+	u, _ = url.Parse(page.URL)
+	domainMD5 = ut.GetMD5(u.Host)
+	labels, ok = t.site.LoadLabels(domainMD5)
+
+	// debug, labels is nil if redirected domain has no template
+	var order []string
+	if ok {
+		order = labels.Order
 	}
 	log.WithFields(log.Fields{
 		"domain":		u.Host,
 		"domainMD5":	domainMD5,
 		"pageURL":		pageURL,
-		"order":		labels.Order,
-		"mainDoc":		docHTML,
-		"orderDoc":		orderHTML,
+		"order":		order,
 	}).Debug("enter web driver")
-	// ********************************************************************
+	debugPage(page, "get page by fetcher of web")
 
 	if ok {
-		pi = t.site.ParseInfoCommonHTML(currentURL, doc, orderDoc, labels)
+		pi = t.site.ParseInfoCommonHTML(page.URL, page.Doc, page.OrderDoc, labels)
+		mt.ObserveFields(pi)
 		if checkResLegal(pi) {
-			t.ResChan <- pi
+			t.saveResult(pageURL, pi)
 
-			return pi
+			return pi, nil
 		}
 	}
 
 	// debug
 	if pi == nil {
 		log.Debug("parse failed, can not create ProInfo instance")
-	}
-	if len(pi.Cover) <= 0 {
-		log.Debug("parse failed, can not get cover")
-	}
-	if len(pi.Desc) <= 0 {
-		log.Debug("parse failed, can not get desc")
+	} else {
+		if len(pi.Cover) <= 0 {
+			log.Debug("parse failed, can not get cover")
+		}
+		if len(pi.Desc) <= 0 {
+			log.Debug("parse failed, can not get desc")
+		}
 	}
 	log.WithFields(log.Fields{
 		"domain":	u.Host,
 		"pageURL":	pageURL,
 	}).Debug("parse failed ！！！")
 
-	return nil
+	if fetchErr != nil {  // such as 4xx, page of browser is not the product page either
+		return nil, fetchErr
+	}
+	if !ok {
+		return nil, ErrNoTemplate
+	}
+
+	return nil, ErrTemplateBroken
+}
+
+// debugPage for log fetched page content at debug level
+func debugPage(page *Page, msg string) {
+	if log.GetLevel() < log.DebugLevel {
+		return
+	}
+
+	var docHTML string
+	var orderHTML string
+	if page.Doc != nil {
+		docHTML, _ = page.Doc.Html()
+	}
+	if page.OrderDoc != nil {
+		orderHTML, _ = page.OrderDoc.Html()
+	}
+	log.WithFields(log.Fields{
+		"url":			page.URL,
+		"mainDoc":		docHTML,
+		"orderDoc":		orderHTML,
+		"json":			string(page.Body),
+	}).Debug(msg)
 }
 
 // chDirMod for change file's mod
@@ -511,48 +359,110 @@ func getSpecifiedRes(pi *cm.ProInfo, resTitle string) interface{} {
 	}
 }
 
-// queryResource for query specified site resource by url md5, return true if query success
-func (t *TaskService) QueryResource(pageURL string, resTitle string) interface{} {
-	if len(pageURL) <= 0 {
-		log.Error("do not get page url by queryResource")
+// CheckPageURL returns ErrBadURL if page url is not an absolute http url
+func CheckPageURL(pageURL string) error {
+	u, err := url.Parse(pageURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) <= 0 {
+		return ErrBadURL
+	}
 
-		return ""
+	return nil
+}
+
+// CheckResourceFields returns ErrUnknownField if any field is not a field of site resource
+func CheckResourceFields(fields []string) error {
+	for _, field := range fields {
+		known := false
+		for _, f := range ResourceFields {
+			if field == f {
+				known = true
+
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("%w: %s", ErrUnknownField, field)
+		}
 	}
 
-	// debug
-	ok := false
-	num := 0
-
-	//items := new([]orm.Params)
-	//// set query condition
-	//cond := orm.NewCondition()
-	//cond = cond.And("url_md5", ut.GetMD5(pageURL))
-	//num, ok := t.db.QueryColumn(items, "wc_cargo_materials", cond, "-create_time", resTitle, 0)
-	if !ok || num <= 0 {
+	return nil
+}
+
+// SelectResource returns selected fields of site resource, all fields if fields is empty
+func SelectResource(pi *cm.ProInfo, fields []string) (map[string]interface{}, error) {
+	if err := CheckResourceFields(fields); err != nil {
+		return nil, err
+	}
+	if len(fields) <= 0 {
+		fields = ResourceFields
+	}
+
+	res := make(map[string]interface{})
+	for _, field := range fields {
+		res[field] = getSpecifiedRes(pi, field)
+	}
+
+	return res, nil
+}
+
+// QuerySiteResource returns site resource of page url and true if it is served by stored result,
+// stored result is served first unless force refresh or older than max age, page is parsed again otherwise
+func (t *TaskService) QuerySiteResource(pageURL string, forceRefresh bool) (*cm.ProInfo, bool, error) {
+	if err := CheckPageURL(pageURL); err != nil {
+		return nil, false, err
+	}
+
+	if !forceRefresh {
+		if pi, ok := t.loadResult(pageURL); ok {
+			return pi, true, nil
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"pageURL":		pageURL,
+		"forceRefresh":	forceRefresh,
+	}).Info("can not find site resource of this page url, start to parse page by QuerySiteResource")
+
+	if !t.politeness.Allowed(pageURL) {
+		return nil, false, ErrRobotsDisallowed
+	}
+	host, labels := t.labelsOfURL(pageURL)
+	release := func() {}
+	if !t.cached(pageURL, labels) {
+		var wait time.Duration
+		if release, wait = t.politeness.TryAcquire(host, labels); release == nil {  // request is not held while host is over limits
+			return nil, false, &RateLimitError{Host: host, RetryAfter: wait}
+		}
+	}
+	pi, err := t.parseWebPage(pageURL)
+	observeParse(err)
+	release()
+	if err != nil {
 		log.WithFields(log.Fields{
 			"pageURL":	pageURL,
-		}).Info("can not find site resource of this page url, start to parse page by queryResource")
+			"siteDown":	hs.IsSiteDown(err),
+			"error":	err.Error(),
+		}).Error("parse web page failed by QuerySiteResource")
 
-		pi := t.parseWebPage(pageURL)
-		if pi == nil {
-			log.WithFields(log.Fields{
-				"pageURL":	pageURL,
-			}).Error("parse web page failed by queryResource")
+		return nil, false, err
+	}
+	t.emitResult("", pi)
 
-			return ""
-		}
+	return pi, false, nil
+}
+
+// QueryResource returns specified site resource of page url, empty string if failed
+func (t *TaskService) QueryResource(pageURL string, resTitle string, forceRefresh bool) interface{} {
+	if len(pageURL) <= 0 {
+		log.Error("do not get page url by queryResource")
 
-		return getSpecifiedRes(pi, resTitle)
+		return ""
 	}
 
-	//// return resource from db
-	//if resTitle == "cover" {
-	//	imageInfo := (*items)[0]["cover"].([]cm.ImageInfo)
-	//
-	//	return parseImagePath(imageInfo)
-	//}
-	//
-	//v := (*items)[0][resTitle].(string)
+	pi, _, err := t.QuerySiteResource(pageURL, forceRefresh)
+	if err != nil {
+		return ""
+	}
 
-	return ""
-}
\ No newline at end of file
+	return getSpecifiedRes(pi, resTitle)
+}
@@ -0,0 +1,146 @@
+/*
+  Package task for parse web page when site is down or answers error status
+*/
+
+package taskservice
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+
+	cm "siteResService/src/common"
+	hs "siteResService/src/httpservice"
+	st "siteResService/src/taskservice/sites"
+)
+
+// testPageURL for page url of domain which has html template in testTemplate
+const testPageURL = "https://down.example.com/product/1"
+
+// testTemplate for html template of down.example.com
+const testTemplate = `"down.example.com","html","",".cover",".title",".price",".desc","","","https://down.example.com/product/1","normal"` + "\n"
+
+var initTestSiteOnce sync.Once
+var testSite *st.SiteService
+
+// fakeFetcher returns err or an error page, counts calls
+type fakeFetcher struct {
+	err		error
+	calls	int32
+}
+
+// Fetch returns err if set, otherwise an error page which can not be parsed
+func (f *fakeFetcher) Fetch(pageURL string, labels *cm.LabelsParse) (*Page, error) {
+	atomic.AddInt32(&f.calls, 1)
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><body><h1>Service Unavailable</h1></body></html>"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Page{URL: pageURL, Doc: doc}, nil
+}
+
+// newTestTask returns pointer of TaskService instance with html and web fetchers, templates read from testTemplate
+func newTestTask(t *testing.T, html Fetcher, web Fetcher) *TaskService {
+	t.Helper()
+
+	initTestSiteOnce.Do(func() {
+		testSite = st.GetSiteServiceInstance()
+	})
+
+	task := &TaskService{site: testSite, fetchers: make(map[string]Fetcher)}
+	task.SetFetcher(cm.HTMLFormat, html)
+	task.SetFetcher(cm.WebFormat, web)
+
+	return task
+}
+
+// TestParseWebPageSiteDown checks site down is reported by fetch error and web driver is not tried
+func TestParseWebPageSiteDown(t *testing.T) {
+	cases := map[string]*hs.FetchError{
+		"503":		{Class: hs.ErrClassServer, URL: testPageURL, StatusCode: 503, Attempts: 3},
+		"timeout":	{Class: hs.ErrClassTimeout, URL: testPageURL, Attempts: 3, Err: errors.New("i/o timeout")},
+	}
+
+	for name, fetchErr := range cases {
+		t.Run(name, func(t *testing.T) {
+			web := new(fakeFetcher)
+			task := newTestTask(t, &fakeFetcher{err: fetchErr}, web)
+
+			pi, err := task.parseWebPage(testPageURL)
+			if pi != nil {
+				t.Fatalf("parse result of site down: %+v", pi)
+			}
+			if err != fetchErr {
+				t.Fatalf("error is %v, want fetch error %v", err, fetchErr)
+			}
+			if code := ErrorCode(err); code != CodeFetchFailed {
+				t.Fatalf("site down is reported as %s, want %s", code, CodeFetchFailed)
+			}
+			if calls := atomic.LoadInt32(&web.calls); calls != 0 {
+				t.Fatalf("web driver is tried %d times when site is down", calls)
+			}
+		})
+	}
+}
+
+// TestParseWebPageClientError checks page of 4xx is tried by web driver and reported by fetch error if still not parsed
+func TestParseWebPageClientError(t *testing.T) {
+	fetchErr := &hs.FetchError{Class: hs.ErrClassClient, URL: testPageURL, StatusCode: 403, Attempts: 1}
+	web := new(fakeFetcher)
+	task := newTestTask(t, &fakeFetcher{err: fetchErr}, web)
+
+	if _, err := task.parseWebPage(testPageURL); err != fetchErr {
+		t.Fatalf("error is %v, want fetch error %v", err, fetchErr)
+	}
+	if calls := atomic.LoadInt32(&web.calls); calls != 1 {
+		t.Fatalf("web driver is tried %d times, want 1", calls)
+	}
+}
+
+// TestParseWebPageBadURL checks malformed page url is reported by ErrBadURL and not fetched
+func TestParseWebPageBadURL(t *testing.T) {
+	html := new(fakeFetcher)
+	task := newTestTask(t, html, new(fakeFetcher))
+
+	if _, err := task.parseWebPage("http://down.example.com/%zz"); err != ErrBadURL {
+		t.Fatalf("error is %v, want %v", err, ErrBadURL)
+	}
+	if calls := atomic.LoadInt32(&html.calls); calls != 0 {
+		t.Fatalf("page is fetched %d times, want 0", calls)
+	}
+}
+
+// TestQuerySiteResourceRateLimited checks request over limits of host is answered by RateLimitError without waiting
+func TestQuerySiteResourceRateLimited(t *testing.T) {
+	task := newTestTask(t, &fakeFetcher{err: errors.New("site down")}, new(fakeFetcher))
+	task.httpService = hs.GetHTTPInstance()
+	task.politeness = &Politeness{
+		hosts:	make(map[string]*hostBucket),
+		def:	cm.PolitenessPolicy{Rate: 0.01, Burst: 1},
+	}
+
+	task.QuerySiteResource(testPageURL, true)  // takes the only token of host
+
+	started := time.Now()
+	_, _, err := task.QuerySiteResource(testPageURL, true)
+	var limited *RateLimitError
+	if !errors.As(err, &limited) || limited.Host != "down.example.com" || ErrorCode(err) != CodeRateLimited {
+		t.Fatalf("error is %v, want rate limited of down.example.com", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("request waits %s for host over limits", elapsed)
+	}
+	if seconds := limited.RetryAfterSeconds(); seconds < 90 || seconds > 100 {
+		t.Fatalf("retry after %d seconds, want about 100", seconds)
+	}
+}
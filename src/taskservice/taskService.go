@@ -5,7 +5,11 @@
 package taskservice
 
 import (
+	"errors"
+	"net/url"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/astaxie/beego"
 	log "github.com/sirupsen/logrus"
@@ -13,17 +17,29 @@ import (
 	cm "siteResService/src/common"
 	hs "siteResService/src/httpservice"
 	mc "siteResService/src/mysqlclient"
+	qu "siteResService/src/queue"
 	sc "siteResService/src/scheduler"
 	st "siteResService/src/taskservice/sites"
+	ut "siteResService/src/util"
 )
 
 // TaskService represents task service
 type TaskService struct {
-	ResChan			chan *cm.ProInfo
+	ResChan			chan *cm.ParseResult  // pages parsed, saved to file and published by dispatch
 	PubChan 		chan string
 	httpService   	*hs.ServiceHTTP
 	db         		*mc.MySQLClient
 	site			*st.SiteService
+	fetchers		map[string]Fetcher  // template character mapping fetcher
+	fetcherLock		sync.RWMutex
+	politeness		*Politeness
+	scheduler		*sc.Scheduler  // for add deferred tasks back
+	store			ResultStore  // parse results, nil if not stored
+	storeMaxAge		time.Duration  // stored result older than this is parsed again
+	jobs			*JobManager  // asynchronous crawl jobs
+	webhook			*Webhook  // callbacks of events and jobs
+	StoreHitCounter		uint64  // calculation num of query served by stored result, must use by atomic !!!
+	StoreMissCounter	uint64  // calculation num of query not stored or too old, must use by atomic !!!
 }
 
 var instance *TaskService
@@ -48,12 +64,50 @@ func GetTaskInstance(db ...*mc.MySQLClient) *TaskService {
 // init for init task service
 func (t *TaskService) init(db *mc.MySQLClient) {
 	size := beego.AppConfig.DefaultInt("channelSize", cm.MaxChannelSize)
-	t.ResChan = make(chan *cm.ProInfo, size)
+	t.ResChan = make(chan *cm.ParseResult, size)
 	t.PubChan = make(chan string, size)
 
 	t.db = db
 	t.httpService = hs.GetHTTPInstance()
 	t.site = st.GetSiteServiceInstance()
+	t.initFetchers()
+	t.politeness = newPoliteness(t)
+	t.scheduler = sc.GetScheduler()
+	t.initResultStore()
+	t.jobs = newJobManager()
+	t.webhook = newWebhook()
+}
+
+// Politeness returns per host limits of task service
+func (t *TaskService) Politeness() *Politeness {
+	return t.politeness
+}
+
+// labelsOfURL returns host and labels of page url, labels is nil if no template of host
+func (t *TaskService) labelsOfURL(pageURL string) (string, *cm.LabelsParse) {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return "", nil
+	}
+	labels, _ := t.site.LoadLabels(ut.GetMD5(u.Host))
+
+	return u.Host, labels
+}
+
+// cached returns true if page of url is cached within ttl, cached page do not need politeness limits
+func (t *TaskService) cached(pageURL string, labels *cm.LabelsParse) bool {
+	var cacheTTL int
+	if labels != nil {
+		cacheTTL = labels.CacheTTL
+	}
+	cache := t.httpService.ResponseCache()
+	ttl := cache.TTL(cacheTTL)
+	if _, ok := cache.Fresh(hs.CacheKey("GET", pageURL, nil), ttl); ok {
+		return true
+	}
+	_, ok := cache.Fresh(hs.CacheKey(hs.CacheMethodWeb, pageURL, nil), ttl)
+
+	return ok
 }
 
 // TaskQueryResource for get site resource by pageURL
@@ -61,12 +115,134 @@ func (t *TaskService) TaskQueryResource(data *sc.DataBlock) {
 	resTitle := data.Extra.(string)
 	pageURL := data.Message.(string)
 
-	t.QueryResource(pageURL, resTitle)
+	t.QueryResource(pageURL, resTitle, false)
+}
+
+// emitResult for send site resource parsed to ResChan with id of event or job
+func (t *TaskService) emitResult(id string, pi *cm.ProInfo) {
+	t.ResChan <- &cm.ParseResult{ID: id, Info: pi}
+}
+
+// finishTask for update status of job url or post result to callback of event, by data.Extra of task,
+// site resource parsed is sent to ResChan, then page message is acked or failed in crawl queue
+func (t *TaskService) finishTask(data *sc.DataBlock, pi *cm.ProInfo, err error) {
+	var id string
+	var msg *cm.PageMessage
+	switch extra := data.Extra.(type) {
+	case *JobItem:
+		extra.finish(pi, err)
+		id = extra.job.ID
+	case *cm.PageMessage:
+		t.webhook.SendEvent(extra, pi, err)
+		id = extra.ID
+		msg = extra
+	}
+
+	if err == nil && pi != nil {
+		t.emitResult(id, pi)
+	}
+	if msg != nil {
+		qu.GetQueue().Finish(msg.QueueID, err)
+	}
+}
+
+// ErrDeadlineExceeded returned when task of page url is not started before its deadline
+var ErrDeadlineExceeded = errors.New("page url is not parsed before deadline")
+
+// ParseTask returns task of parse page url of data, priority and deadline are taken from data.Extra,
+// task whose deadline passed fails by ErrDeadlineExceeded
+func (t *TaskService) ParseTask(data *sc.DataBlock) sc.Task {
+	task := sc.Task{
+		CtrlInfo:	&sc.ControlInfo{Name: cm.HTTPCtrlName, CtrlNum: cm.HTTPCtrlNum},
+		Data:		data,
+		DoTask:		t.TaskParseURL,
+		OnDone:		t.doneTask,
+		OnExpired:	t.expireTask,
+	}
+	switch extra := data.Extra.(type) {
+	case *JobItem:
+		task.Priority = extra.job.Priority
+		task.Deadline = extra.job.Deadline
+	case *cm.PageMessage:
+		task.Priority = extra.Priority
+	}
+
+	return task
 }
 
-// TaskParseURL for parse landing URL
-func (t *TaskService) TaskParseURL(data *sc.DataBlock) {
+// expireTask for fail task of page url whose deadline passed
+func (t *TaskService) expireTask(data *sc.DataBlock) {
+	t.finishTask(data, nil, ErrDeadlineExceeded)
+}
+
+// doneTask for fail task of page url whose parse panicked or which is dropped by Drain,
+// so job, event and crawl queue do not wait for it, other errors are finished by TaskParseURL
+func (t *TaskService) doneTask(data *sc.DataBlock, err error) {
+	if errors.Is(err, sc.ErrClosed) {
+		if msg, ok := data.Extra.(*cm.PageMessage); ok && msg.QueueID != 0 {  // lease is released when queue closes, redelivered later
+			return
+		}
+		t.finishTask(data, nil, err)
+
+		return
+	}
+	if sc.IsPanic(err) {
+		t.finishTask(data, nil, err)
+	}
+}
+
+// TaskParseURL for parse landing URL, task is deferred instead of dropped if host is over limits,
+// cached page is parsed without limits, data.Extra is *JobItem of job url or *cm.PageMessage of event
+func (t *TaskService) TaskParseURL(data *sc.DataBlock) error {
 	pageURL := data.Message.(string)
+	item, _ := data.Extra.(*JobItem)
+
+	if msg, ok := data.Extra.(*cm.PageMessage); ok && msg.UseStored {
+		if pi, ok := t.loadResult(pageURL); ok {
+			t.finishTask(data, pi, nil)
+
+			return nil
+		}
+	}
+
+	if !t.politeness.Allowed(pageURL) {
+		t.finishTask(data, nil, ErrRobotsDisallowed)
+
+		return ErrRobotsDisallowed
+	}
+
+	host, labels := t.labelsOfURL(pageURL)
+	if !t.cached(pageURL, labels) {
+		release, wait := t.politeness.TryAcquire(host, labels)
+		if release == nil {
+			atomic.AddUint64(&t.politeness.DeferCounter, 1)
+
+			// debug
+			log.WithFields(log.Fields{
+				"host":		host,
+				"pageURL":	pageURL,
+				"wait":		wait,
+			}).Debug("host is over limits, defer task by TaskParseURL")
+
+			t.scheduler.AddTaskAfter(wait, t.ParseTask(data))
+
+			return nil
+		}
+		defer release()
+	}
+
+	item.start()
+	pi, err := t.parseWebPage(pageURL)
+	observeParse(err)
+	t.finishTask(data, pi, err)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"pageURL":	pageURL,
+			"class":	hs.ErrorClass(err),
+			"siteDown":	hs.IsSiteDown(err),
+			"error":	err.Error(),
+		}).Warn("parse landing url failed by TaskParseURL")
+	}
 
-	t.parseWebPage(pageURL)
+	return err
 }
\ No newline at end of file
@@ -0,0 +1,31 @@
+/*
+  Package task for finish tasks dropped by scheduler
+*/
+
+package taskservice
+
+import (
+	"errors"
+	"testing"
+
+	sc "siteResService/src/scheduler"
+)
+
+// TestDoneTaskClosed checks job url dropped by Drain is failed and job callback is called
+func TestDoneTaskClosed(t *testing.T) {
+	called := 0
+	job := &Job{ID: "drain", pending: 1, onDone: func(*Job) { called++ }}
+	item := &JobItem{job: job, URL: testPageURL, status: JobQueued}
+	job.Items = []*JobItem{item}
+
+	task := new(TaskService)
+	task.doneTask(&sc.DataBlock{Message: testPageURL, Extra: item}, sc.ErrClosed)
+
+	status, _, err := item.State()
+	if status != JobFailed || !errors.Is(err, sc.ErrClosed) {
+		t.Fatalf("status %s, error %v, want %s by scheduler closed", status, err, JobFailed)
+	}
+	if !job.Done() || called != 1 {
+		t.Fatalf("job done %v, callback called %d times, want done and called once", job.Done(), called)
+	}
+}
@@ -0,0 +1,107 @@
+/*
+  Package task for dry run templates against their sample pages
+*/
+
+package taskservice
+
+import (
+	"errors"
+	"path"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+
+	cm "siteResService/src/common"
+	hs "siteResService/src/httpservice"
+	st "siteResService/src/taskservice/sites"
+)
+
+// TemplateReport represents validation result of one domain template
+type TemplateReport struct {
+	Domain		string
+	Version		int
+	Character	string
+	SampleURL	string
+	Source		string  // where the page comes from, saved file path or sample url
+	Error		string  // why the page can not be loaded
+	Fields		[]*st.FieldReport
+	Legal		bool  // whether checkResLegal passes
+}
+
+// validatePage for load page of template and fill report
+func (t *TaskService) validatePage(labels *cm.LabelsParse, fixtureDir string, report *TemplateReport) error {
+	var page *Page
+	if len(fixtureDir) > 0 {
+		// saved copy: <domain>.html for main page, <domain>.order.html for order page, <domain>.json for json
+		report.Source = path.Join(fixtureDir, labels.Domain)
+		page, _ = NewFixtureFetcher(fixtureDir).Fetch(labels.SampleURL, labels)
+	}
+
+	if page == nil {  // do not have saved copy, fetch sample page
+		if len(labels.SampleURL) <= 0 {
+			return errors.New("do not have sample url or saved page")
+		}
+
+		report.Source = labels.SampleURL
+		var err error
+		if page, err = t.fetch(labels.Character, labels.SampleURL, labels); err != nil {
+			return errors.New("can not fetch sample page: " + err.Error())
+		}
+	}
+
+	if labels.Character == cm.JSONFormat {
+		if page.Body == nil {
+			return errors.New("do not have json body")
+		}
+		report.Fields = t.site.ValidateLabelsJSON(page.URL, page.Body, labels)
+	} else {
+		if page.Doc == nil {
+			return errors.New("do not have html document")
+		}
+		report.Fields = t.site.ValidateLabelsHTML(page.URL, page.Doc, page.OrderDoc, labels)
+	}
+	report.Legal = checkResLegal(t.parsePage(page, labels))
+
+	return nil
+}
+
+// ValidateTemplates returns reports of all domain templates of site sorted by domain,
+// pages are loaded from saved copies in fixtureDir if exist, otherwise fetched from sample url,
+// only fetchers are made for it, not the whole task service
+func ValidateTemplates(site *st.SiteService, fixtureDir string) []*TemplateReport {
+	t := &TaskService{site: site, httpService: hs.GetHTTPInstance()}
+	t.initFetchers()
+
+	return t.validateTemplates(fixtureDir)
+}
+
+// validateTemplates returns reports of all domain templates sorted by domain
+func (t *TaskService) validateTemplates(fixtureDir string) []*TemplateReport {
+	var reports []*TemplateReport
+	for _, labels := range t.site.AllLabels() {
+		report := &TemplateReport{
+			Domain:		labels.Domain,
+			Version:	labels.Version,
+			Character:	labels.Character,
+			SampleURL:	labels.SampleURL,
+		}
+
+		if err := t.validatePage(labels, fixtureDir, report); err != nil {
+			report.Error = err.Error()
+
+			log.WithFields(log.Fields{
+				"domain":	labels.Domain,
+				"source":	report.Source,
+				"error":	err.Error(),
+			}).Error("can not load page by ValidateTemplates")
+		}
+
+		reports = append(reports, report)
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Domain < reports[j].Domain
+	})
+
+	return reports
+}
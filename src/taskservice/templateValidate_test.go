@@ -0,0 +1,40 @@
+/*
+  Package task for dry run templates against saved pages
+*/
+
+package taskservice
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// testValidatePage for saved page of down.example.com matched by testTemplate
+const testValidatePage = `<html><body><img class="cover" src="/a.jpg"><h1 class="title">Validate</h1>` +
+	`<span class="price">10</span><div class="desc">desc</div></body></html>`
+
+// TestValidateTemplates checks templates are validated against saved pages by site service without task service
+func TestValidateTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(path.Join(dir, "down.example.com.html"), []byte(testValidatePage), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	site := newTestTask(t, nil, nil).site
+	reports := ValidateTemplates(site, dir)
+	if len(reports) != 1 || reports[0].Domain != "down.example.com" || len(reports[0].Error) > 0 {
+		t.Fatalf("reports %+v, want one report of down.example.com without error", reports)
+	}
+
+	for _, f := range reports[0].Fields {
+		if f.Field == "title" && len(f.Matched) <= 0 {
+			t.Fatalf("title is not matched, fell through %v", f.FellThrough)
+		}
+	}
+}
@@ -0,0 +1,466 @@
+/*
+  Package task for post parse results to callback urls of events and jobs
+*/
+
+package taskservice
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/astaxie/beego"
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+
+	cm "siteResService/src/common"
+	hs "siteResService/src/httpservice"
+)
+
+// types of callback payload
+const (
+	CallbackEvent	= "event"
+	CallbackJob		= "job"
+)
+
+// headers of callback request, signature is hex HMAC-SHA256 of "<timestamp>.<body>"
+const (
+	HeaderWebhookID			= "X-Webhook-Id"
+	HeaderWebhookTimestamp	= "X-Webhook-Timestamp"
+	HeaderWebhookSignature	= "X-Webhook-Signature"
+)
+
+// ErrCallbackForbidden returned when callback host is not in allow hosts or is a private address
+var ErrCallbackForbidden = errors.New("callback host is not allowed")
+
+// ErrCallbackQueueFull returned when callbacks waiting to be sent are full, callback is written to dead letter
+var ErrCallbackQueueFull = errors.New("callback queue is full")
+
+// privateNets for networks callbacks are not posted to unless "webhook::allowPrivate" is true
+var privateNets = parseNets("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7")
+
+// parseNets returns networks of cidrs
+func parseNets(cidrs ...string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		if _, n, err := net.ParseCIDR(cidr); err == nil {
+			nets = append(nets, n)
+		}
+	}
+
+	return nets
+}
+
+// isPrivateIP returns true if ip is loopback, link local, unspecified or in private networks
+func isPrivateIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CallbackResult represents result of one page url posted to callback
+type CallbackResult struct {
+	URL			string					`json:"url"`
+	Status		string					`json:"status"`  // parsed or failed
+	Class		string					`json:"class,omitempty"`  // class of fetch failure
+	Reason		string					`json:"reason,omitempty"`
+	Resource	map[string]interface{}	`json:"resource,omitempty"`
+}
+
+// CallbackPayload represents json body posted to callback url
+type CallbackPayload struct {
+	ID			string				`json:"id"`  // event id or job id
+	Type		string				`json:"type"`  // event or job
+	Results		[]*CallbackResult	`json:"results"`
+	Timestamp	int64				`json:"timestamp"`  // unix time of results
+}
+
+// webhookDelivery represents one callback waiting to be sent
+type webhookDelivery struct {
+	url			string
+	id			string
+	body		[]byte
+}
+
+// deadLetter represents one line of dead letter file
+type deadLetter struct {
+	Callback	string				`json:"callback"`
+	ID			string				`json:"id"`
+	Attempts	int					`json:"attempts"`
+	Error		string				`json:"error"`
+	Failed		time.Time			`json:"failed"`
+	Payload		jsoniter.RawMessage	`json:"payload"`
+}
+
+// Webhook represents sender of callbacks, failed callbacks are retried with backoff then written to dead letter file
+type Webhook struct {
+	client			*http.Client
+	secret			[]byte
+	allowHosts		map[string]bool  // empty means any public host
+	allowPrivate	bool  // post to loopback and private addresses, only for trusted callers
+	retry			int
+	backoff			int  // milliseconds
+	backoffMax		int  // milliseconds
+	deadLetter		string
+	deadLock		sync.Mutex
+	queue			chan *webhookDelivery
+	pending			int64  // num of callbacks queued or sending, must use by atomic !!!
+	SentCounter		uint64  // calculation num of callbacks sent, must use by atomic !!!
+	RetryCounter	uint64  // calculation num of callback retries, must use by atomic !!!
+	DeadCounter		uint64  // calculation num of callbacks failed after all retries, must use by atomic !!!
+}
+
+// newWebhook returns pointer of Webhook instance read from app.conf, sending routines are started
+func newWebhook() *Webhook {
+	w := new(Webhook)
+	w.allowPrivate = beego.AppConfig.DefaultBool("webhook::allowPrivate", cm.WebhookAllowPrivate)
+	w.allowHosts = make(map[string]bool)
+	for _, host := range strings.Split(beego.AppConfig.DefaultString("webhook::allowHosts", ""), ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); len(host) > 0 {
+			w.allowHosts[host] = true
+		}
+	}
+
+	// address is checked when dialing, so host resolved or redirected to private address is not posted either
+	timeout := time.Duration(beego.AppConfig.DefaultInt("webhook::timeout", cm.WebhookTimeout)) * time.Second
+	dialer := &net.Dialer{Timeout: timeout, Control: w.checkDial}
+	w.client = &http.Client{
+		Transport:	&http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: timeout},
+		Timeout:	timeout,
+		CheckRedirect:	func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+
+			return w.Check(req.URL.String())
+		},
+	}
+	w.secret = loadWebhookSecret()
+	w.retry = beego.AppConfig.DefaultInt("webhook::retry", cm.WebhookRetry)
+	w.backoff = beego.AppConfig.DefaultInt("webhook::backoff", cm.WebhookBackoff)
+	w.backoffMax = beego.AppConfig.DefaultInt("webhook::backoffMax", cm.WebhookBackoffMax)
+	w.deadLetter = beego.AppConfig.DefaultString("webhook::deadLetter", cm.WebhookDeadLetter)
+	w.queue = make(chan *webhookDelivery, beego.AppConfig.DefaultInt("webhook::queueSize", cm.WebhookQueueSize))
+
+	workers := beego.AppConfig.DefaultInt("webhook::workers", cm.WebhookWorkers)
+	for i := 0; i < workers; i++ {
+		go w.run()
+	}
+
+	return w
+}
+
+// loadWebhookSecret returns "webhook::secret", or secret kept in "webhook::secretFile" which is generated if not exist,
+// so callbacks are always signed, receivers get the secret from the file
+func loadWebhookSecret() []byte {
+	if secret := beego.AppConfig.DefaultString("webhook::secret", cm.WebhookSecret); len(secret) > 0 {
+		return []byte(secret)
+	}
+
+	file := beego.AppConfig.DefaultString("webhook::secretFile", cm.WebhookSecretFile)
+	if dat, err := ioutil.ReadFile(file); err == nil && len(strings.TrimSpace(string(dat))) > 0 {
+		return []byte(strings.TrimSpace(string(dat)))
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.WithFields(log.Fields{
+			"error":	err.Error(),
+		}).Fatal("can not generate secret of callbacks")
+	}
+	secret := hex.EncodeToString(key)
+
+	os.MkdirAll(path.Dir(file), os.ModePerm)
+	if err := ioutil.WriteFile(file, []byte(secret + "\n"), 0600); err != nil {
+		log.WithFields(log.Fields{
+			"file":		file,
+			"error":	err.Error(),
+		}).Error("can not save secret of callbacks, receivers can not check signatures until webhook::secret is set")
+	} else {
+		log.WithFields(log.Fields{
+			"file":		file,
+		}).Warn("webhook::secret is not set, generate secret of callbacks")
+	}
+
+	return []byte(secret)
+}
+
+// Check returns error if callback url is illegal, not in "webhook::allowHosts",
+// or a private address literal, host names are checked again by address when dialing
+func (w *Webhook) Check(callback string) error {
+	if err := CheckPageURL(callback); err != nil {
+		return err
+	}
+
+	u, _ := url.Parse(callback)
+	host := strings.ToLower(u.Hostname())
+	if len(w.allowHosts) > 0 && !w.allowHosts[host] {
+		return fmt.Errorf("%w: %s", ErrCallbackForbidden, host)
+	}
+	if ip := net.ParseIP(host); ip != nil && !w.allowPrivate && isPrivateIP(ip) {
+		return fmt.Errorf("%w: %s", ErrCallbackForbidden, host)
+	}
+
+	return nil
+}
+
+// checkDial returns error if address dialed by callback is private, for Control of net.Dialer
+func (w *Webhook) checkDial(network string, address string, c syscall.RawConn) error {
+	if w.allowPrivate {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+		return fmt.Errorf("%w: %s", ErrCallbackForbidden, host)
+	}
+
+	return nil
+}
+
+// Sign returns hex HMAC-SHA256 of "<timestamp>.<body>" by secret, receivers check X-Webhook-Signature by it
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newCallbackResult returns result of page url by parse result or error, resource has selected fields only
+func newCallbackResult(pageURL string, pi *cm.ProInfo, err error, fields []string) *CallbackResult {
+	if err != nil {
+		return &CallbackResult{URL: pageURL, Status: JobFailed, Class: hs.ErrorClass(err), Reason: err.Error()}
+	}
+
+	r := &CallbackResult{URL: pageURL, Status: JobParsed}
+	if pi != nil {
+		r.Resource, _ = SelectResource(pi, fields)
+	}
+
+	return r
+}
+
+// Send for queue payload to be posted to callback url, it never blocks,
+// callback not allowed or over "webhook::queueSize" is written to dead letter
+func (w *Webhook) Send(callback string, payload *CallbackPayload) {
+	body, err := jsoniter.Marshal(payload)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"id":		payload.ID,
+			"error":	err.Error(),
+		}).Error("can not marshal callback payload by Send")
+
+		return
+	}
+
+	d := &webhookDelivery{url: callback, id: payload.ID, body: body}
+	if err := w.Check(callback); err != nil {
+		w.dead(d, 0, err)
+
+		return
+	}
+
+	atomic.AddInt64(&w.pending, 1)
+	select {
+	case w.queue <- d:
+	default:  // parse workers must not wait for slow receivers
+		atomic.AddInt64(&w.pending, -1)
+		w.dead(d, 0, ErrCallbackQueueFull)
+	}
+}
+
+// SendEvent for post result of page of event to its callback url, do nothing if event has no callback
+func (w *Webhook) SendEvent(msg *cm.PageMessage, pi *cm.ProInfo, err error) {
+	if msg == nil || len(msg.Callback) <= 0 {
+		return
+	}
+
+	w.Send(msg.Callback, &CallbackPayload{
+		ID:			msg.ID,
+		Type:		CallbackEvent,
+		Results:	[]*CallbackResult{newCallbackResult(msg.URL, pi, err, msg.Fields)},
+		Timestamp:	time.Now().Unix(),
+	})
+}
+
+// SendJob for post results of all urls of finished job to its callback url
+func (w *Webhook) SendJob(job *Job) {
+	if len(job.Callback) <= 0 {
+		return
+	}
+
+	payload := &CallbackPayload{ID: job.ID, Type: CallbackJob, Timestamp: time.Now().Unix()}
+	for _, item := range job.Items {
+		_, pi, err := item.State()
+		payload.Results = append(payload.Results, newCallbackResult(item.URL, pi, err, nil))
+	}
+	w.Send(job.Callback, payload)
+}
+
+// run for send queued callbacks
+func (w *Webhook) run() {
+	for d := range w.queue {
+		w.deliver(d)
+		atomic.AddInt64(&w.pending, -1)
+	}
+}
+
+// Wait returns num of callbacks not sent yet, it waits until all queued callbacks sent or failed, or timeout
+func (w *Webhook) Wait(timeout time.Duration) int64 {
+	deadline := time.Now().Add(timeout)
+	pending := atomic.LoadInt64(&w.pending)
+	for pending > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		pending = atomic.LoadInt64(&w.pending)
+	}
+
+	return pending
+}
+
+// post returns error if callback is not accepted, retry is false if receiver rejects it for good
+func (w *Webhook) post(d *webhookDelivery) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, d.url, bytes.NewReader(d.body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderWebhookID, d.id)
+	req.Header.Set(HeaderWebhookTimestamp, timestamp)
+	if len(w.secret) > 0 {
+		req.Header.Set(HeaderWebhookSignature, Sign(w.secret, timestamp, d.body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return !errors.Is(err, ErrCallbackForbidden), err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("callback responds status %d", resp.StatusCode)
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return false, err
+	}
+
+	return true, err
+}
+
+// deliver for post callback, retried with backoff, written to dead letter file if failed after all retries
+func (w *Webhook) deliver(d *webhookDelivery) {
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		var retry bool
+		retry, err = w.post(d)
+		if err == nil {
+			atomic.AddUint64(&w.SentCounter, 1)
+
+			return
+		}
+		if !retry || attempt > w.retry {
+			break
+		}
+		atomic.AddUint64(&w.RetryCounter, 1)
+
+		wait := hs.Backoff(attempt, w.backoff, w.backoffMax)
+		log.WithFields(log.Fields{
+			"callback":	d.url,
+			"id":		d.id,
+			"attempt":	attempt,
+			"wait":		wait,
+			"error":	err.Error(),
+		}).Warn("retry callback by deliver")
+		time.Sleep(wait)
+	}
+
+	w.dead(d, attempt, err)
+}
+
+// dead for count failed callback and write it to dead letter file
+func (w *Webhook) dead(d *webhookDelivery, attempt int, err error) {
+	atomic.AddUint64(&w.DeadCounter, 1)
+	log.WithFields(log.Fields{
+		"callback":	d.url,
+		"id":		d.id,
+		"attempts":	attempt,
+		"error":	err.Error(),
+	}).Error("callback failed, write to dead letter by dead")
+
+	w.writeDeadLetter(&deadLetter{
+		Callback:	d.url,
+		ID:			d.id,
+		Attempts:	attempt,
+		Error:		err.Error(),
+		Failed:		time.Now(),
+		Payload:	d.body,
+	})
+}
+
+// writeDeadLetter for append failed callback as one json line to dead letter file
+func (w *Webhook) writeDeadLetter(l *deadLetter) {
+	if len(w.deadLetter) <= 0 {
+		return
+	}
+
+	line, err := jsoniter.Marshal(l)
+	if err != nil {
+		return
+	}
+
+	w.deadLock.Lock()
+	defer w.deadLock.Unlock()
+
+	os.MkdirAll(path.Dir(w.deadLetter), os.ModePerm)
+	file, err := os.OpenFile(w.deadLetter, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"file":		w.deadLetter,
+			"error":	err.Error(),
+		}).Error("can not open dead letter file by writeDeadLetter")
+
+		return
+	}
+	defer file.Close()
+
+	file.Write(append(line, '\n'))
+}
+
+// Webhook returns sender of callbacks
+func (t *TaskService) Webhook() *Webhook {
+	return t.webhook
+}
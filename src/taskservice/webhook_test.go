@@ -0,0 +1,62 @@
+/*
+  Package task for callbacks not blocking parse and not posted to private addresses
+*/
+
+package taskservice
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestWebhookSendNotBlock checks callbacks over queue size are written to dead letter instead of blocking
+func TestWebhookSendNotBlock(t *testing.T) {
+	w := newWebhook()  // queue of one callback, no sending routines, see TestMain
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			w.Send("https://example.com/hook", &CallbackPayload{ID: "job"})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Send blocks when queue is full")
+	}
+	if dead := atomic.LoadUint64(&w.DeadCounter); dead != 2 {
+		t.Fatalf("dead callbacks %d, want 2", dead)
+	}
+	if pending := atomic.LoadInt64(&w.pending); pending != 1 {
+		t.Fatalf("pending callbacks %d, want 1", pending)
+	}
+}
+
+// TestWebhookPrivateAddress checks callbacks are not posted to private addresses literal or resolved
+func TestWebhookPrivateAddress(t *testing.T) {
+	w := newWebhook()
+
+	for _, callback := range []string{"http://127.0.0.1/hook", "http://10.1.2.3/hook", "http://[::1]/hook", "http://169.254.169.254/"} {
+		if err := w.Check(callback); !errors.Is(err, ErrCallbackForbidden) {
+			t.Fatalf("callback %s is allowed, error %v", callback, err)
+		}
+	}
+	if err := w.Check("https://example.com/hook"); err != nil {
+		t.Fatalf("public callback is not allowed: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	local := "http://localhost:" + strconv.Itoa(server.Listener.Addr().(*net.TCPAddr).Port) + "/hook"
+	if retry, err := w.post(&webhookDelivery{url: local, id: "job"}); !errors.Is(err, ErrCallbackForbidden) || retry {
+		t.Fatalf("callback resolved to loopback is posted, error %v", err)
+	}
+}
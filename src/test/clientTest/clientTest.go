@@ -6,14 +6,11 @@ import (
 
 	"github.com/astaxie/beego"
 	"github.com/micro/go-micro"
-	"github.com/micro/go-micro/broker"
-	"github.com/micro/go-micro/registry"
-	"github.com/micro/go-micro/registry/etcd"
-	"github.com/micro/go-plugins/broker/nsq"
 	"github.com/pborman/uuid"
 	log "github.com/sirupsen/logrus"
 
 	cm "siteResService/src/common"
+	ms "siteResService/src/microservice"
 	pb "siteResService/src/proto"
 )
 
@@ -50,27 +47,11 @@ func sendEv(pub micro.Publisher, topic string, msgs []string) {
 }
 
 func main() {
-	nsqIP := beego.AppConfig.DefaultString("nsq::ip", "localhost")
-	nsqPort := beego.AppConfig.DefaultString("nsq::port", "4150")
-	var BrokerHosts = []string{
-		0: nsqIP + ":" + nsqPort,
-	}
-
-	etcdIP := beego.AppConfig.DefaultString("etcd::ip", "localhost")
-	etcdPort := beego.AppConfig.DefaultString("etcd::port", "2379")
-	var RegistryHosts = []string{
-		0: etcdIP + ":" + etcdPort,
-	}
-
 	// create a service
 	service := micro.NewService(
 		micro.Name("go.micro.test.client"),
-		micro.Broker(nsq.NewBroker(func(o *broker.Options) {
-			o.Addrs = BrokerHosts
-		})),
-		micro.Registry(etcd.NewRegistry(func(o *registry.Options) { // specified using etcd registry
-			o.Addrs = RegistryHosts
-		})),
+		micro.Broker(ms.NewBroker()),  // broker and registry chosen by configure
+		micro.Registry(ms.NewRegistry()),
 	)
 
 	service.Init()
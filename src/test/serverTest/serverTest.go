@@ -5,15 +5,12 @@ import (
 
 	"github.com/astaxie/beego"
 	"github.com/micro/go-micro"
-	"github.com/micro/go-micro/broker"
 	"github.com/micro/go-micro/metadata"
-	"github.com/micro/go-micro/registry"
-	"github.com/micro/go-micro/registry/etcd"
 	"github.com/micro/go-micro/server"
-	"github.com/micro/go-plugins/broker/nsq"
 	log "github.com/sirupsen/logrus"
 
 	cm "siteResService/src/common"
+	ms "siteResService/src/microservice"
 	pb "siteResService/src/proto"
 )
 
@@ -22,38 +19,25 @@ import (
 *    for test service function
  ********************************************************************/
 
-// Alternatively a function can be used
-func process(ctx context.Context, event *pb.Event) error {
+// Alternatively a function can be used, site resources parsed are published to topic.pub
+func process(ctx context.Context, res *pb.SiteResource) error {
 	md, _ := metadata.FromContext(ctx)
 	log.WithFields(log.Fields{
 		"metadata": md,
-		"event":    event,
-	}).Info("[server test]  Received event")
+		"id":       res.GetId(),
+		"pageURL":  res.GetPageUrl(),
+		"title":    res.GetTitle(),
+		"template": res.GetTemplate(),
+	}).Info("[server test]  Received site resource")
 
 	return nil
 }
 
 func main() {
-	nsqIP := beego.AppConfig.DefaultString("nsq::ip", "localhost")
-	nsqPort := beego.AppConfig.DefaultString("nsq::port", "4150")
-	var BrokerHosts = []string{
-		0: nsqIP + ":" + nsqPort,
-	}
-
-	etcdIP := beego.AppConfig.DefaultString("etcd::ip", "localhost")
-	etcdPort := beego.AppConfig.DefaultString("etcd::port", "2379")
-	var RegistryHosts = []string{
-		0: etcdIP + ":" + etcdPort,
-	}
-
 	service := micro.NewService(
 		micro.Name("go.micro.test.server"),
-		micro.Broker(nsq.NewBroker(func(o *broker.Options) { // specified using nsq broker
-			o.Addrs = BrokerHosts
-		})),
-		micro.Registry(etcd.NewRegistry(func(o *registry.Options) { // specified using etcd registry
-			o.Addrs = RegistryHosts
-		})),
+		micro.Broker(ms.NewBroker()),  // broker and registry chosen by configure
+		micro.Registry(ms.NewRegistry()),
 	)
 
 	// micro service init